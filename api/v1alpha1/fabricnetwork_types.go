@@ -30,6 +30,27 @@ type FabricNetworkSpec struct {
 	// Additional values passed to all Argo workflows
 	Argo Argo `json:"argo,omitempty"`
 
+	// What runs the steps of channel-flow, chaincode-flow and peer-org-flow. Argo submits them as Argo Workflows,
+	// Jobs runs the same steps as ordered Kubernetes Jobs for clusters without Argo. Defaults to Argo
+	// +kubebuilder:validation:Enum=Argo;Jobs
+	FlowEngine FlowEngine `json:"flowEngine,omitempty"`
+
+	// Opt-in retry policy for failed Argo flows. If not set, a failed flow sets the state to Failed
+	RetryPolicy *RetryPolicy `json:"retryPolicy,omitempty"`
+
+	// What to do with the PersistentVolumeClaims of hlf-kube StatefulSets when FabricNetwork is deleted. Defaults to Retain
+	// +kubebuilder:validation:Enum=Retain;Delete
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+	// What to do with the PersistentVolumeClaims of removed peers and organizations. Defaults to Retain
+	// +kubebuilder:validation:Enum=Retain;Delete
+	ScaleDownPolicy DeletionPolicy `json:"scaleDownPolicy,omitempty"`
+
+	// How the hlf-kube Helm release is installed, upgraded and kept in sync
+	Helm HelmSettings `json:"helm,omitempty"`
+
+	// Where PIVT charts are loaded from and which version is used
+	Charts Charts `json:"charts,omitempty"`
+
 	// Additional values passed to hlf-kube Helm chart
 	// +kubebuilder:pruning:PreserveUnknownFields
 	HlfKube runtime.RawExtension `json:"hlf-kube,omitempty"`
@@ -49,13 +70,99 @@ type FabricNetworkStatus struct {
 	State    State  `json:"state,omitempty"`
 	Message  string `json:"message,omitempty"`
 	Workflow string `json:"workflow,omitempty"`
+	// Flow engine running Workflow, empty means Argo
+	FlowEngine FlowEngine `json:"flowEngine,omitempty"`
+	// Name of the hlf-kube Helm release. Empty for FabricNetworks installed before the release name is derived from FabricNetwork name
+	HelmRelease string `json:"helmRelease,omitempty"`
+
+	// Conditions of the FabricNetwork. State is kept for compatibility, Conditions contain the details.
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// The generation of the FabricNetwork which is last processed by Fabric Operator
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// The last time FabricNetwork entered each state, keyed by state
+	PhaseTimestamps map[string]metav1.Time `json:"phaseTimestamps,omitempty"`
+
 	// +kubebuilder:validation:Enum=None;PeerOrgFlow
 	NextFlow NextFlow `json:"nextflow,omitempty"`
 
+	// Number of failed attempts of the current flow. Reset when the flow completes
+	FlowAttempts int32 `json:"flowAttempts,omitempty"`
+	// Reason of the last flow failure
+	LastFailureReason string `json:"lastFailureReason,omitempty"`
+	// Details of the failed step of the last flow failure, if the flow engine reports one
+	LastFailedStep *FailedStep `json:"lastFailedStep,omitempty"`
+	// The failed flow will be re-submitted after this time
+	NextRetryTime *metav1.Time `json:"nextRetryTime,omitempty"`
+	// Chaincodes included in the submitted chaincode-flow, empty means all chaincodes
+	ChaincodeFlowIncludes []string `json:"chaincodeFlowIncludes,omitempty"`
+	// The state FabricNetwork failed in, only set when State is Failed. Resuming restarts this state
+	FailedState State `json:"failedState,omitempty"`
+	// The failed workflow, only set when State is Failed
+	FailedWorkflow string `json:"failedWorkflow,omitempty"`
+
 	Chaincode  ChaincodeConfig `json:"chaincode,omitempty"`
 	Topology   Topology        `json:"topology,omitempty"`
 	Channels   []Channel       `json:"channels,omitempty"`
 	Chaincodes []Chaincode     `json:"chaincodes,omitempty"`
+
+	// PersistentVolumeClaims of removed peers and organizations, which are retained according to scaleDownPolicy
+	OrphanedPVCs []string `json:"orphanedPVCs,omitempty"`
+
+	// Status of the hlf-kube Helm release, like deployed, failed or pending-upgrade
+	HelmReleaseStatus string `json:"helmReleaseStatus,omitempty"`
+	// Revision of the hlf-kube Helm release
+	HelmReleaseRevision int32 `json:"helmReleaseRevision,omitempty"`
+	// Resources of the hlf-kube Helm release which are changed out of band
+	HelmDrift []string `json:"helmDrift,omitempty"`
+	// Version of the hlf-kube chart the Helm release is installed or last upgraded with.
+	// Later upgrades and flows use the same version unless spec.charts.version is changed
+	ChartVersion string `json:"chartVersion,omitempty"`
+
+	// Readiness of StatefulSets and Deployments of the hlf-kube Helm release
+	Components []ComponentStatus `json:"components,omitempty"`
+
+	// Validation errors of FabricNetwork, only set when State is Invalid or Rejected, or New if configtx.yaml is broken
+	ValidationErrors []ValidationError `json:"validationErrors,omitempty"`
+}
+
+// ValidationError is a validation error of a single FabricNetwork field
+type ValidationError struct {
+	// Path of the invalid field, like spec.topology.peerOrgs[0].peerCount
+	Field string `json:"field"`
+	// Reason of the error
+	Message string `json:"message"`
+}
+
+// FailedStep is a failed step of a flow
+type FailedStep struct {
+	// Name of the step, i.e. hlf-channels-x7k2p[0].create-channels[0].create-channel(0:...)
+	Name string `json:"name"`
+	// Workflow template the step runs
+	Template string `json:"template,omitempty"`
+	// Exit message of the step
+	Message string `json:"message,omitempty"`
+	// Last lines of the logs of the step
+	LogTail string `json:"logTail,omitempty"`
+	// ConfigMap containing the logs of the failed step and, as long as they fit, of the other steps of the failed flow, keyed by step.
+	// Kept after the flow is deleted
+	LogsConfigMap string `json:"logsConfigMap,omitempty"`
+}
+
+// ComponentStatus is the readiness of a StatefulSet or Deployment of the hlf-kube Helm release
+type ComponentStatus struct {
+	// StatefulSet or Deployment
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	// Fabric component type, like orderer, peer, ca, kafka or zookeeper. Empty if not known
+	Type          string `json:"type,omitempty"`
+	Ready         bool   `json:"ready"`
+	Replicas      int32  `json:"replicas"`
+	ReadyReplicas int32  `json:"readyReplicas"`
+	// Why the component is not ready
+	Message string `json:"message,omitempty"`
 }
 
 type State string
@@ -66,6 +173,7 @@ const (
 	StateRejected                   State = "Rejected"
 	StateInvalid                    State = "Invalid"
 	StateFailed                     State = "Failed"
+	StateDegraded                   State = "Degraded"
 	StateHelmChartInstalled         State = "HelmChartInstalled"
 	StateHelmChartNeedsUpdate       State = "HelmChartNeedsUpdate"
 	StateHelmChartNeedsDoubleUpdate State = "HelmChartNeedsDoubleUpdate"
@@ -78,6 +186,53 @@ const (
 	StatePeerOrgFlowCompleted       State = "PeerOrgFlowCompleted"
 )
 
+// Condition types of FabricNetwork
+const (
+	// FabricNetwork is ready, all the other conditions are satisfied
+	ConditionReady = "Ready"
+	// hlf-kube Helm release is installed and all of its components are ready
+	ConditionHelmReleaseReady = "HelmReleaseReady"
+	// channel-flow is completed
+	ConditionChannelsReady = "ChannelsReady"
+	// chaincode-flow is completed
+	ConditionChaincodesReady = "ChaincodesReady"
+	// crypto material is created, extended or downloaded
+	ConditionCertificatesReady = "CertificatesReady"
+	// components of a running FabricNetwork are not healthy. failed flows are reported by the conditions above
+	ConditionDegraded = "Degraded"
+)
+
+// ResumeAnnotation on a Failed FabricNetwork makes Fabric Operator restart the failed state with the same parameters.
+// Fabric Operator removes the annotation after processing it
+const ResumeAnnotation = "raft.io/resume"
+
+type DeletionPolicy string
+
+const (
+	// PersistentVolumeClaims are left behind
+	DeletionPolicyRetain DeletionPolicy = "Retain"
+	// PersistentVolumeClaims are deleted
+	DeletionPolicyDelete DeletionPolicy = "Delete"
+)
+
+type FlowEngine string
+
+const (
+	// flows are submitted as Argo Workflows
+	FlowEngineArgo FlowEngine = "Argo"
+	// flows are run as ordered Kubernetes Jobs
+	FlowEngineJobs FlowEngine = "Jobs"
+)
+
+type DriftPolicy string
+
+const (
+	// Out of band changes to hlf-kube Helm release are reported in status and events
+	DriftPolicyReport DriftPolicy = "Report"
+	// Out of band changes to hlf-kube Helm release are reverted by upgrading the release with the same chart and values
+	DriftPolicyRevert DriftPolicy = "Revert"
+)
+
 type NextFlow string
 
 const (
@@ -88,6 +243,10 @@ const (
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
 // +kubebuilder:resource:path=fabricnetworks,shortName=fn
+// +kubebuilder:printcolumn:name="State",type=string,JSONPath=`.status.state`
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Message",type=string,JSONPath=`.status.message`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // FabricNetwork is the Schema for the fabricnetworks API
 type FabricNetwork struct {
@@ -111,7 +270,7 @@ type FabricNetworkList struct {
 // file can only be used via CLI
 type Configtx struct {
 	File string `json:"file,omitempty"`
-	// +kubebuilder:validation:Enum=hlf-configtx.yaml
+	// Either hlf-configtx--<FabricNetwork name> or legacy hlf-configtx.yaml
 	Secret string `json:"secret,omitempty"`
 }
 
@@ -135,7 +294,7 @@ func (g Genesis) IsProvided() bool {
 type CryptoConfig struct {
 	// Folder containing crypto-material
 	Folder string `json:"folder,omitempty"`
-	// +kubebuilder:validation:Enum=hlf-crypto-config
+	// Either hlf-crypto-config--<FabricNetwork name> or legacy hlf-crypto-config
 	Secret string `json:"secret,omitempty"`
 }
 
@@ -271,6 +430,68 @@ type CcChannel struct {
 type Argo struct {
 	// Service account to run all Argo worklow pods with.
 	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+	// Garbage collection of finished flows. If not set, flows are kept until FabricNetwork is deleted or re-created
+	Retention *Retention `json:"retention,omitempty"`
+}
+
+// Retention defines which finished flows are kept, per flow type. Running flows and the flows in status are never deleted
+type Retention struct {
+	// Number of most recent successful flows kept per flow type. All are kept if not set
+	// +kubebuilder:validation:Minimum=0
+	KeepSuccessful *int32 `json:"keepSuccessful,omitempty"`
+	// Number of most recent failed flows kept per flow type. All are kept if not set
+	// +kubebuilder:validation:Minimum=0
+	KeepFailed *int32 `json:"keepFailed,omitempty"`
+	// Flows finished longer ago than this are deleted, regardless of keepSuccessful and keepFailed
+	TTL *metav1.Duration `json:"ttl,omitempty"`
+}
+
+// HelmSettings defines how the hlf-kube Helm release is managed
+type HelmSettings struct {
+	// If true, Helm waits for the release to be ready and rolls back a failed install or upgrade
+	Atomic bool `json:"atomic,omitempty"`
+	// Timeout of atomic Helm actions. A release is considered stuck if it stays in a pending state longer than this. Defaults to 10m
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+	// What to do with out of band changes to the Helm release. Defaults to Report
+	// +kubebuilder:validation:Enum=Report;Revert
+	DriftPolicy DriftPolicy `json:"driftPolicy,omitempty"`
+}
+
+// Charts defines where PIVT charts hlf-kube, channel-flow, chaincode-flow and peer-org-flow are loaded from
+type Charts struct {
+	// Helm repository to pull the charts from, either an HTTP(S) chart repository or an OCI registry like oci://registry/path.
+	// If not set, charts embedded in the operator are used
+	Repository string `json:"repository,omitempty"`
+	// Exact version of the charts. If not set, the version in status.chartVersion is used,
+	// or the latest version for a new FabricNetwork
+	Version string `json:"version,omitempty"`
+}
+
+// RetryPolicy defines how failed Argo flows are re-submitted
+type RetryPolicy struct {
+	// Maximum number of re-submissions of a failed flow
+	// +kubebuilder:validation:Minimum=0
+	MaxRetries int32 `json:"maxRetries"`
+	// Wait time before the first re-submission, doubled after each failure. Defaults to 30s
+	Backoff *metav1.Duration `json:"backoff,omitempty"`
+	// Upper limit of the wait time between re-submissions. Defaults to 10m
+	MaxBackoff *metav1.Duration `json:"maxBackoff,omitempty"`
+
+	// Overrides for channel-flow
+	ChannelFlow *FlowRetryPolicy `json:"channel-flow,omitempty"`
+	// Overrides for chaincode-flow
+	ChaincodeFlow *FlowRetryPolicy `json:"chaincode-flow,omitempty"`
+	// Overrides for peer-org-flow
+	PeerOrgFlow *FlowRetryPolicy `json:"peer-org-flow,omitempty"`
+}
+
+// FlowRetryPolicy overrides the global retry settings for a single flow
+type FlowRetryPolicy struct {
+	// Maximum number of re-submissions of a failed flow
+	// +kubebuilder:validation:Minimum=0
+	MaxRetries *int32 `json:"maxRetries,omitempty"`
+	// Wait time before the first re-submission, doubled after each failure
+	Backoff *metav1.Duration `json:"backoff,omitempty"`
 }
 
 func init() {
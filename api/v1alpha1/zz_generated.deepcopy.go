@@ -6,12 +6,18 @@ package v1alpha1
 
 import (
 	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Argo) DeepCopyInto(out *Argo) {
 	*out = *in
+	if in.Retention != nil {
+		in, out := &in.Retention, &out.Retention
+		*out = new(Retention)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Argo.
@@ -106,6 +112,36 @@ func (in *Channel) DeepCopy() *Channel {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Charts) DeepCopyInto(out *Charts) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Charts.
+func (in *Charts) DeepCopy() *Charts {
+	if in == nil {
+		return nil
+	}
+	out := new(Charts)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ComponentStatus) DeepCopyInto(out *ComponentStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ComponentStatus.
+func (in *ComponentStatus) DeepCopy() *ComponentStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ComponentStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Configtx) DeepCopyInto(out *Configtx) {
 	*out = *in
@@ -211,7 +247,14 @@ func (in *FabricNetworkSpec) DeepCopyInto(out *FabricNetworkSpec) {
 	}
 	in.Topology.DeepCopyInto(&out.Topology)
 	in.Network.DeepCopyInto(&out.Network)
-	out.Argo = in.Argo
+	in.Argo.DeepCopyInto(&out.Argo)
+	if in.RetryPolicy != nil {
+		in, out := &in.RetryPolicy, &out.RetryPolicy
+		*out = new(RetryPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	in.Helm.DeepCopyInto(&out.Helm)
+	out.Charts = in.Charts
 	in.HlfKube.DeepCopyInto(&out.HlfKube)
 	in.ChannelFlow.DeepCopyInto(&out.ChannelFlow)
 	in.ChaincodeFlow.DeepCopyInto(&out.ChaincodeFlow)
@@ -231,6 +274,34 @@ func (in *FabricNetworkSpec) DeepCopy() *FabricNetworkSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *FabricNetworkStatus) DeepCopyInto(out *FabricNetworkStatus) {
 	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.PhaseTimestamps != nil {
+		in, out := &in.PhaseTimestamps, &out.PhaseTimestamps
+		*out = make(map[string]metav1.Time, len(*in))
+		for key, val := range *in {
+			(*out)[key] = *val.DeepCopy()
+		}
+	}
+	if in.LastFailedStep != nil {
+		in, out := &in.LastFailedStep, &out.LastFailedStep
+		*out = new(FailedStep)
+		**out = **in
+	}
+	if in.NextRetryTime != nil {
+		in, out := &in.NextRetryTime, &out.NextRetryTime
+		*out = (*in).DeepCopy()
+	}
+	if in.ChaincodeFlowIncludes != nil {
+		in, out := &in.ChaincodeFlowIncludes, &out.ChaincodeFlowIncludes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	out.Chaincode = in.Chaincode
 	in.Topology.DeepCopyInto(&out.Topology)
 	if in.Channels != nil {
@@ -247,6 +318,26 @@ func (in *FabricNetworkStatus) DeepCopyInto(out *FabricNetworkStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.OrphanedPVCs != nil {
+		in, out := &in.OrphanedPVCs, &out.OrphanedPVCs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.HelmDrift != nil {
+		in, out := &in.HelmDrift, &out.HelmDrift
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Components != nil {
+		in, out := &in.Components, &out.Components
+		*out = make([]ComponentStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.ValidationErrors != nil {
+		in, out := &in.ValidationErrors, &out.ValidationErrors
+		*out = make([]ValidationError, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FabricNetworkStatus.
@@ -259,6 +350,46 @@ func (in *FabricNetworkStatus) DeepCopy() *FabricNetworkStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FailedStep) DeepCopyInto(out *FailedStep) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FailedStep.
+func (in *FailedStep) DeepCopy() *FailedStep {
+	if in == nil {
+		return nil
+	}
+	out := new(FailedStep)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FlowRetryPolicy) DeepCopyInto(out *FlowRetryPolicy) {
+	*out = *in
+	if in.MaxRetries != nil {
+		in, out := &in.MaxRetries, &out.MaxRetries
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Backoff != nil {
+		in, out := &in.Backoff, &out.Backoff
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FlowRetryPolicy.
+func (in *FlowRetryPolicy) DeepCopy() *FlowRetryPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(FlowRetryPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Genesis) DeepCopyInto(out *Genesis) {
 	*out = *in
@@ -274,6 +405,26 @@ func (in *Genesis) DeepCopy() *Genesis {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HelmSettings) DeepCopyInto(out *HelmSettings) {
+	*out = *in
+	if in.Timeout != nil {
+		in, out := &in.Timeout, &out.Timeout
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HelmSettings.
+func (in *HelmSettings) DeepCopy() *HelmSettings {
+	if in == nil {
+		return nil
+	}
+	out := new(HelmSettings)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Network) DeepCopyInto(out *Network) {
 	*out = *in
@@ -338,6 +489,76 @@ func (in *PeerOrg) DeepCopy() *PeerOrg {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Retention) DeepCopyInto(out *Retention) {
+	*out = *in
+	if in.KeepSuccessful != nil {
+		in, out := &in.KeepSuccessful, &out.KeepSuccessful
+		*out = new(int32)
+		**out = **in
+	}
+	if in.KeepFailed != nil {
+		in, out := &in.KeepFailed, &out.KeepFailed
+		*out = new(int32)
+		**out = **in
+	}
+	if in.TTL != nil {
+		in, out := &in.TTL, &out.TTL
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Retention.
+func (in *Retention) DeepCopy() *Retention {
+	if in == nil {
+		return nil
+	}
+	out := new(Retention)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RetryPolicy) DeepCopyInto(out *RetryPolicy) {
+	*out = *in
+	if in.Backoff != nil {
+		in, out := &in.Backoff, &out.Backoff
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.MaxBackoff != nil {
+		in, out := &in.MaxBackoff, &out.MaxBackoff
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.ChannelFlow != nil {
+		in, out := &in.ChannelFlow, &out.ChannelFlow
+		*out = new(FlowRetryPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ChaincodeFlow != nil {
+		in, out := &in.ChaincodeFlow, &out.ChaincodeFlow
+		*out = new(FlowRetryPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PeerOrgFlow != nil {
+		in, out := &in.PeerOrgFlow, &out.PeerOrgFlow
+		*out = new(FlowRetryPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RetryPolicy.
+func (in *RetryPolicy) DeepCopy() *RetryPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(RetryPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Topology) DeepCopyInto(out *Topology) {
 	*out = *in
@@ -364,3 +585,18 @@ func (in *Topology) DeepCopy() *Topology {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ValidationError) DeepCopyInto(out *ValidationError) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ValidationError.
+func (in *ValidationError) DeepCopy() *ValidationError {
+	if in == nil {
+		return nil
+	}
+	out := new(ValidationError)
+	in.DeepCopyInto(out)
+	return out
+}
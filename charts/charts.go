@@ -0,0 +1,25 @@
+// Package charts embeds PIVT Helm charts into the operator binary
+package charts
+
+import (
+	"embed"
+	"io/fs"
+)
+
+// hlf-kube, channel-flow, chaincode-flow and peer-org-flow charts are copied to fabric-kube folder
+// before the operator is built, see Dockerfile
+//
+//go:embed all:fabric-kube
+var embedded embed.FS
+
+// FabricKube returns the embedded fabric-kube folder, or nil if charts are not embedded
+func FabricKube() fs.FS {
+	if _, err := fs.Stat(embedded, "fabric-kube/hlf-kube/Chart.yaml"); err != nil {
+		return nil
+	}
+	sub, err := fs.Sub(embedded, "fabric-kube")
+	if err != nil {
+		return nil
+	}
+	return sub
+}
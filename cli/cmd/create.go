@@ -3,7 +3,6 @@ package cmd
 import (
 	"bytes"
 	"context"
-	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -12,6 +11,7 @@ import (
 
 	"github.com/raftAtGit/hl-fabric-operator/api/v1alpha1"
 	apiClient "github.com/raftAtGit/hl-fabric-operator/cli/cmd/client"
+	"github.com/raftAtGit/hl-fabric-operator/validation"
 	"github.com/spf13/cobra"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
@@ -49,16 +49,16 @@ func init() {
 }
 
 func submitNewNetwork(ctx context.Context, cl client.Client, args []string) error {
-	if err := checkOtherFabricNetworksExist(ctx, cl, namespace); err != nil {
-		return err
-	}
-
 	networkFile := args[0]
 	network, err := loadFabricNetwork(networkFile)
 	if err != nil {
 		return err
 	}
 
+	if err := checkConflictsInNamespace(ctx, cl, namespace, network); err != nil {
+		return err
+	}
+
 	if err = validateNewNetwork(ctx, cl, network); err != nil {
 		return err
 	}
@@ -68,7 +68,7 @@ func submitNewNetwork(ctx context.Context, cl client.Client, args []string) erro
 			return err
 		}
 		network.Spec.Configtx.File = ""
-		network.Spec.Configtx.Secret = "hlf-configtx.yaml"
+		network.Spec.Configtx.Secret = validation.ConfigtxSecretName(network.Name)
 	}
 
 	if network.Spec.CryptoConfig.Folder != "" {
@@ -76,7 +76,7 @@ func submitNewNetwork(ctx context.Context, cl client.Client, args []string) erro
 			return err
 		}
 		network.Spec.CryptoConfig.Folder = ""
-		network.Spec.CryptoConfig.Secret = "hlf-crypto-config"
+		network.Spec.CryptoConfig.Secret = validation.CryptoConfigSecretName(network.Name)
 	}
 
 	if network.Spec.Chaincode.Folder != "" {
@@ -96,109 +96,44 @@ func submitNewNetwork(ctx context.Context, cl client.Client, args []string) erro
 }
 
 func validateNewNetwork(ctx context.Context, cl client.Client, network *v1alpha1.FabricNetwork) error {
-	if network.Spec.Topology.TLSEnabled && !network.Spec.Topology.UseActualDomains {
-		return errors.New("tlsEnabled is true but useActualDomains is false")
-	}
-	if network.Spec.Configtx.Secret == "" && network.Spec.Configtx.File == "" {
-		return errors.New("Either configtx.secret or configtx.file is required")
-	}
-	if network.Spec.Configtx.Secret != "" && network.Spec.Configtx.File != "" {
-		return errors.New("Both configtx.secret and configtx.file are provided, only either one is required")
-	}
-	if network.Spec.Configtx.Secret != "" && network.Spec.Configtx.Secret != "hlf-configtx.yaml" {
-		return errors.New("configtx.secret should be named 'hlf-configtx.yaml'")
-	}
-	if network.Spec.Configtx.Secret == "" && !overwrite {
-		exists, err := secretExists(ctx, cl, namespace, "hlf-configtx.yaml")
-		if err != nil {
-			return err
-		}
-		if exists {
-			return fmt.Errorf("A Secret with name hlf-configtx.yaml already exists in namespace %v. Provide --overwrite flag to force overwrite", namespace)
-		}
-	}
-
-	if network.Spec.Configtx.Secret != "" {
-		exists, err := secretExists(ctx, cl, namespace, network.Spec.Configtx.Secret)
-		if err != nil {
-			return err
-		}
-		if !exists {
-			return fmt.Errorf("configtx.secret %v does not exist in namespace %v", network.Spec.Configtx.Secret, namespace)
-		}
-	}
+	allErrs := validation.ValidateSpec(network)
 
-	if network.Spec.Genesis.IsProvided() && !network.Spec.CryptoConfig.IsProvided() {
-		return errors.New("Genesis block is provided but CryptoConfig is not provided. Genesis block will not match generated certificates")
-	}
-	if network.Spec.Genesis.Secret != "" && network.Spec.Genesis.File != "" {
-		return errors.New("Both genesis.secret and genesis.file are provided, at most one is allowed")
-	}
-	if network.Spec.Genesis.Secret != "" {
-		if network.Spec.Genesis.Secret != "hlf-genesis.block" {
-			return errors.New("genesis.secret should be named 'hlf-genesis.block'")
-		}
-		exists, err := secretExists(ctx, cl, namespace, network.Spec.Genesis.Secret)
-		if err != nil {
-			return err
-		}
-		if !exists {
-			return fmt.Errorf("genesis.secret %v does not exist in namespace %v", network.Spec.Genesis.Secret, namespace)
-		}
+	refErrs, err := validation.ValidateReferences(ctx, cl, namespace, network)
+	if err != nil {
+		return err
 	}
+	allErrs = append(allErrs, refErrs...)
 
-	for _, chaincode := range network.Spec.Network.Chaincodes {
-
-		if network.Spec.Chaincode.Folder == "" {
-			name := "hlf-chaincode--" + chaincode.Name
-			exists, err := configMapExists(ctx, cl, namespace, name)
-			if err != nil {
-				return err
-			}
-			if !exists {
-				return fmt.Errorf("Chaincode ConfigMap %v does not exist in namespace %v", name, namespace)
-			}
-		}
-
-		if network.Spec.Chaincode.Language == "" && chaincode.Language == "" {
-			return fmt.Errorf("Global chaincode language is not specified. Language for chaincode %v is required", chaincode.Name)
-		}
-
-		if network.Spec.Chaincode.Version == "" && chaincode.Version == "" {
-			return fmt.Errorf("Global chaincode version is not specified. Version for chaincode %v is required", chaincode.Name)
-		}
+	if len(allErrs) != 0 {
+		return allErrs.ToAggregate()
 	}
 
-	if network.Spec.CryptoConfig.Secret != "" && network.Spec.CryptoConfig.Folder != "" {
-		return errors.New("Both crypto-config.secret and crypto-config.folder are provided, at most one is allowed")
-	}
-	if network.Spec.CryptoConfig.Secret != "" {
-		if network.Spec.CryptoConfig.Secret != "hlf-crypto-config" {
-			return errors.New("crypto-config.secret should be named 'hlf-crypto-config'")
-		}
-		exists, err := secretExists(ctx, cl, namespace, network.Spec.CryptoConfig.Secret)
+	if network.Spec.Configtx.Secret == "" && !overwrite {
+		name := validation.ConfigtxSecretName(network.Name)
+		exists, err := secretExists(ctx, cl, namespace, name)
 		if err != nil {
 			return err
 		}
-		if !exists {
-			return fmt.Errorf("crypto-config.secret %v does not exist in namespace %v", network.Spec.CryptoConfig.Secret, namespace)
+		if exists {
+			return fmt.Errorf("A Secret with name %v already exists in namespace %v. Provide --overwrite flag to force overwrite", name, namespace)
 		}
 	}
+
 	if network.Spec.CryptoConfig.Folder != "" && !overwrite {
-		exists, err := secretExists(ctx, cl, namespace, "hlf-crypto-config")
+		name := validation.CryptoConfigSecretName(network.Name)
+		exists, err := secretExists(ctx, cl, namespace, name)
 		if err != nil {
 			return err
 		}
 		if exists {
-			return fmt.Errorf("A Secret with name hlf-crypto-config already exists in namespace %v. Provide --overwrite flag to force overwrite", namespace)
+			return fmt.Errorf("A Secret with name %v already exists in namespace %v. Provide --overwrite flag to force overwrite", name, namespace)
 		}
 	}
 
-	//TODO other checks
 	return nil
 }
 
-func checkOtherFabricNetworksExist(ctx context.Context, cl client.Client, namespace string) error {
+func checkConflictsInNamespace(ctx context.Context, cl client.Client, namespace string, network *v1alpha1.FabricNetwork) error {
 	networkList := &v1alpha1.FabricNetworkList{}
 	opts := []client.ListOption{
 		client.InNamespace(namespace),
@@ -209,8 +144,8 @@ func checkOtherFabricNetworksExist(ctx context.Context, cl client.Client, namesp
 	}
 	debug("got FabricNetworkList, size: %v", len(networkList.Items))
 
-	if len(networkList.Items) != 0 {
-		return fmt.Errorf("There is already %v FabricNetwork(s) in namespace %v. Only one is allowed", len(networkList.Items), namespace)
+	if allErrs := validation.ValidateNoConflicts(network, networkList.Items); len(allErrs) != 0 {
+		return fmt.Errorf("FabricNetwork conflicts with other FabricNetworks in namespace %v: %v", namespace, allErrs.ToAggregate())
 	}
 	return nil
 }
@@ -230,9 +165,10 @@ func createOrUpdateConfigtxSecret(ctx context.Context, cl client.Client, network
 		return err
 	}
 
+	name := validation.ConfigtxSecretName(network.Name)
 	secret := &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      "hlf-configtx.yaml",
+			Name:      name,
 			Namespace: namespace,
 			Labels: map[string]string{
 				"raft.io/fabric-operator-cli-created-for": network.Name,
@@ -243,7 +179,7 @@ func createOrUpdateConfigtxSecret(ctx context.Context, cl client.Client, network
 		},
 	}
 
-	exists, err := secretExists(ctx, cl, namespace, "hlf-configtx.yaml")
+	exists, err := secretExists(ctx, cl, namespace, name)
 	if err != nil {
 		return err
 	}
@@ -253,13 +189,13 @@ func createOrUpdateConfigtxSecret(ctx context.Context, cl client.Client, network
 			fmt.Printf("configtx secret update failed: %v \n", err)
 			return err
 		}
-		info("updated configtx Secret hlf-configtx.yaml")
+		info("updated configtx Secret %v", name)
 	} else {
 		if err := cl.Create(ctx, secret); err != nil {
 			fmt.Printf("configtx secret creation failed: %v \n", err)
 			return err
 		}
-		info("created configtx Secret hlf-configtx.yaml")
+		info("created configtx Secret %v", name)
 	}
 	return nil
 }
@@ -276,7 +212,7 @@ func createOrUpdateChaincodeConfigMaps(ctx context.Context, cl client.Client, ne
 
 	for _, chaincode := range network.Spec.Network.Chaincodes {
 		debug("creating %v", strings.ToLower(chaincode.Name))
-		name := "hlf-chaincode--" + strings.ToLower(chaincode.Name)
+		name := validation.ChaincodeConfigMapName(chaincode.Name)
 		exists, err := configMapExists(ctx, cl, namespace, name)
 		if err != nil {
 			return err
@@ -344,9 +280,10 @@ func createOrUpdateCryptoConfigSecret(ctx context.Context, cl client.Client, net
 		return err
 	}
 
+	name := validation.CryptoConfigSecretName(network.Name)
 	secret := &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      "hlf-crypto-config",
+			Name:      name,
 			Namespace: namespace,
 			Labels: map[string]string{
 				"raft.io/fabric-operator-cli-created-for": network.Name,
@@ -357,7 +294,7 @@ func createOrUpdateCryptoConfigSecret(ctx context.Context, cl client.Client, net
 		},
 	}
 
-	exists, err := secretExists(ctx, cl, namespace, "hlf-crypto-config")
+	exists, err := secretExists(ctx, cl, namespace, name)
 	if err != nil {
 		return err
 	}
@@ -367,13 +304,13 @@ func createOrUpdateCryptoConfigSecret(ctx context.Context, cl client.Client, net
 			fmt.Printf("crypto-config secret update failed: %v \n", err)
 			return err
 		}
-		info("updated crypto-config Secret hlf-crypto-config")
+		info("updated crypto-config Secret %v", name)
 	} else {
 		if err := cl.Create(ctx, secret); err != nil {
 			fmt.Printf("crypto-config secret creation failed: %v \n", err)
 			return err
 		}
-		info("created crypto-config Secret hlf-crypto-config")
+		info("created crypto-config Secret %v", name)
 	}
 	return nil
 }
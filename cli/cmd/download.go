@@ -8,6 +8,7 @@ import (
 
 	"github.com/raftAtGit/hl-fabric-operator/api/v1alpha1"
 	apiClient "github.com/raftAtGit/hl-fabric-operator/cli/cmd/client"
+	"github.com/raftAtGit/hl-fabric-operator/validation"
 	"github.com/spf13/cobra"
 
 	// corev1 "k8s.io/api/core/v1"
@@ -32,12 +33,6 @@ var downloadCmd = &cobra.Command{
 	},
 }
 
-const (
-	configTxSecret     = "hlf-configtx.yaml"
-	genesisSecret      = "hlf-genesis.block"
-	cryptoConfigSecret = "hlf-crypto-config"
-)
-
 func init() {
 	rootCmd.AddCommand(downloadCmd)
 
@@ -56,7 +51,7 @@ func downloadResources(ctx context.Context, cl client.Client, args []string) err
 	createDirIfNotExists(outputDir)
 
 	secret := &corev1.Secret{}
-	if err := cl.Get(ctx, types.NamespacedName{Namespace: namespace, Name: configTxSecret}, secret); err != nil {
+	if err := cl.Get(ctx, types.NamespacedName{Namespace: namespace, Name: network.Spec.Configtx.Secret}, secret); err != nil {
 		return err
 	}
 	file := path.Join(outputDir, "configtx.yaml")
@@ -66,7 +61,7 @@ func downloadResources(ctx context.Context, cl client.Client, args []string) err
 	info("downloaded configtx to %v", file)
 
 	secret = &corev1.Secret{}
-	if err := cl.Get(ctx, types.NamespacedName{Namespace: namespace, Name: genesisSecret}, secret); err != nil {
+	if err := cl.Get(ctx, types.NamespacedName{Namespace: namespace, Name: validation.GenesisSecret}, secret); err != nil {
 		return err
 	}
 	file = path.Join(outputDir, "genesis.block")
@@ -76,7 +71,7 @@ func downloadResources(ctx context.Context, cl client.Client, args []string) err
 	info("downloaded genesis block to %v", file)
 
 	secret = &corev1.Secret{}
-	if err := cl.Get(ctx, types.NamespacedName{Namespace: namespace, Name: cryptoConfigSecret}, secret); err != nil {
+	if err := cl.Get(ctx, types.NamespacedName{Namespace: namespace, Name: validation.CryptoConfigSecret(network)}, secret); err != nil {
 		return err
 	}
 
@@ -10,6 +10,7 @@ import (
 	"github.com/raftAtGit/hl-fabric-operator/api/v1alpha1"
 	apiClient "github.com/raftAtGit/hl-fabric-operator/cli/cmd/client"
 	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
@@ -57,14 +58,18 @@ func executeList(ctx context.Context, cl client.Client, args []string) {
 
 	table := uitable.New()
 	if allNamespaces {
-		table.AddRow("NAMESPACE", "NAME", "STATUS", "MESSAGE", "WORKFLOW")
+		table.AddRow("NAMESPACE", "NAME", "STATUS", "READY", "HELM", "CHANNELS", "CHAINCODES", "MESSAGE", "WORKFLOW")
 		for _, n := range networkList.Items {
-			table.AddRow(n.Namespace, n.Name, n.Status.State, n.Status.Message, n.Status.Workflow)
+			table.AddRow(n.Namespace, n.Name, n.Status.State, conditionStatus(n, v1alpha1.ConditionReady),
+				conditionStatus(n, v1alpha1.ConditionHelmReleaseReady), conditionStatus(n, v1alpha1.ConditionChannelsReady),
+				conditionStatus(n, v1alpha1.ConditionChaincodesReady), n.Status.Message, n.Status.Workflow)
 		}
 	} else {
-		table.AddRow("NAME", "STATUS", "MESSAGE", "WORKFLOW")
+		table.AddRow("NAME", "STATUS", "READY", "HELM", "CHANNELS", "CHAINCODES", "MESSAGE", "WORKFLOW")
 		for _, n := range networkList.Items {
-			table.AddRow(n.Name, n.Status.State, n.Status.Message, n.Status.Workflow)
+			table.AddRow(n.Name, n.Status.State, conditionStatus(n, v1alpha1.ConditionReady),
+				conditionStatus(n, v1alpha1.ConditionHelmReleaseReady), conditionStatus(n, v1alpha1.ConditionChannelsReady),
+				conditionStatus(n, v1alpha1.ConditionChaincodesReady), n.Status.Message, n.Status.Workflow)
 		}
 	}
 	if err := encodeTable(os.Stdout, table); err != nil {
@@ -72,3 +77,12 @@ func executeList(ctx context.Context, cl client.Client, args []string) {
 	}
 
 }
+
+// returns the status of given condition or "-" if condition does not exist
+func conditionStatus(network v1alpha1.FabricNetwork, conditionType string) string {
+	condition := meta.FindStatusCondition(network.Status.Conditions, conditionType)
+	if condition == nil {
+		return "-"
+	}
+	return string(condition.Status)
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/raftAtGit/hl-fabric-operator/api/v1alpha1"
+	apiClient "github.com/raftAtGit/hl-fabric-operator/cli/cmd/client"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// resumeCmd represents the resume command
+var resumeCmd = &cobra.Command{
+	Use:   "resume FABRIC_NETWORK_NAME",
+	Args:  cobra.ExactArgs(1),
+	Short: "Resume a failed FabricNetwork",
+	Long:  `Resume a failed FabricNetwork from the state it failed in. Failed flow is re-submitted with the same parameters`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, client := apiClient.NewClient()
+
+		if err := resumeNetwork(ctx, client, args); err != nil {
+			fail("%v", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(resumeCmd)
+}
+
+func resumeNetwork(ctx context.Context, cl client.Client, args []string) error {
+	name := args[0]
+
+	network := &v1alpha1.FabricNetwork{}
+	if err := cl.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, network); err != nil {
+		return err
+	}
+	debug("Got FabricNetwork: %v", network.Name)
+
+	if network.Status.State != v1alpha1.StateFailed {
+		return fmt.Errorf("FabricNetwork %v is not failed, state is %v", network.Name, network.Status.State)
+	}
+
+	if network.Annotations == nil {
+		network.Annotations = make(map[string]string)
+	}
+	network.Annotations[v1alpha1.ResumeAnnotation] = "true"
+
+	if err := cl.Update(ctx, network); err != nil {
+		return err
+	}
+	info("resuming FabricNetwork %v from state %v", network.Name, network.Status.FailedState)
+
+	return nil
+}
@@ -3,9 +3,15 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
+	"path/filepath"
 
+	"github.com/raftAtGit/hl-fabric-operator/api/v1alpha1"
 	apiClient "github.com/raftAtGit/hl-fabric-operator/cli/cmd/client"
+	"github.com/raftAtGit/hl-fabric-operator/validation"
 	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
@@ -49,13 +55,20 @@ func updateNetwork(ctx context.Context, cl client.Client, args []string) error {
 	if err = validateNewNetwork(ctx, cl, network); err != nil {
 		return err
 	}
+	anchorPeerCounts, err := loadAnchorPeerCounts(ctx, cl, network, networkFile)
+	if err != nil {
+		return err
+	}
+	if allErrs := validation.ValidateTransition(old, network, anchorPeerCounts); len(allErrs) != 0 {
+		return allErrs.ToAggregate()
+	}
 
 	if network.Spec.Configtx.File != "" {
 		if err := createOrUpdateConfigtxSecret(ctx, cl, network, networkFile); err != nil {
 			return err
 		}
 		network.Spec.Configtx.File = ""
-		network.Spec.Configtx.Secret = "hlf-configtx.yaml"
+		network.Spec.Configtx.Secret = validation.ConfigtxSecretName(network.Name)
 	}
 
 	if network.Spec.CryptoConfig.Folder != "" {
@@ -63,7 +76,7 @@ func updateNetwork(ctx context.Context, cl client.Client, args []string) error {
 			return err
 		}
 		network.Spec.CryptoConfig.Folder = ""
-		network.Spec.CryptoConfig.Secret = "hlf-crypto-config"
+		network.Spec.CryptoConfig.Secret = validation.CryptoConfigSecretName(network.Name)
 	}
 
 	if network.Spec.Chaincode.Folder != "" {
@@ -82,3 +95,29 @@ func updateNetwork(ctx context.Context, cl client.Client, args []string) error {
 
 	return nil
 }
+
+// returns the peerCount needed by the anchor peers of the channels, read from configtx.yaml file or Secret
+func loadAnchorPeerCounts(ctx context.Context, cl client.Client, network *v1alpha1.FabricNetwork, networkFile string) (map[string]int32, error) {
+	var configtx []byte
+	switch {
+	case network.Spec.Configtx.File != "":
+		configtxFile := network.Spec.Configtx.File
+		if !filepath.IsAbs(configtxFile) {
+			configtxFile = filepath.Join(filepath.Dir(networkFile), configtxFile)
+		}
+		bytes, err := ioutil.ReadFile(configtxFile)
+		if err != nil {
+			return nil, err
+		}
+		configtx = bytes
+	case network.Spec.Configtx.Secret != "":
+		secret := &corev1.Secret{}
+		if err := cl.Get(ctx, types.NamespacedName{Namespace: namespace, Name: network.Spec.Configtx.Secret}, secret); err != nil {
+			return nil, err
+		}
+		configtx = secret.Data["configtx.yaml"]
+	default:
+		return nil, nil
+	}
+	return validation.AnchorPeerCounts(network, configtx)
+}
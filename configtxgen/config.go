@@ -0,0 +1,361 @@
+package configtxgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/msp"
+	"github.com/hyperledger/fabric/protos/orderer/etcdraft"
+	"sigs.k8s.io/yaml"
+)
+
+// orderer types
+const (
+	ordererTypeSolo     = "solo"
+	ordererTypeKafka    = "kafka"
+	ordererTypeEtcdRaft = etcdraft.TypeKey
+)
+
+// configtx.yaml, only profiles are used since other sections are referenced from profiles with YAML anchors
+type topLevel struct {
+	Profiles map[string]*Profile `json:"Profiles"`
+}
+
+// Profile is a profile in configtx.yaml, same as configtxgen's profile
+type Profile struct {
+	Consortium   string                 `json:"Consortium"`
+	Application  *Application           `json:"Application"`
+	Orderer      *Orderer               `json:"Orderer"`
+	Consortiums  map[string]*Consortium `json:"Consortiums"`
+	Capabilities map[string]bool        `json:"Capabilities"`
+	Policies     map[string]*Policy     `json:"Policies"`
+}
+
+// Policy is a channel config policy
+type Policy struct {
+	Type string `json:"Type"`
+	Rule string `json:"Rule"`
+}
+
+// Consortium is a group of organizations which may create channels with each other
+type Consortium struct {
+	Organizations []*Organization `json:"Organizations"`
+}
+
+// Application is the application section of a profile
+type Application struct {
+	Organizations []*Organization    `json:"Organizations"`
+	Capabilities  map[string]bool    `json:"Capabilities"`
+	Policies      map[string]*Policy `json:"Policies"`
+	ACLs          map[string]string  `json:"ACLs"`
+}
+
+// Organization is an orderer or peer organization
+type Organization struct {
+	Name     string             `json:"Name"`
+	ID       string             `json:"ID"`
+	MSPDir   string             `json:"MSPDir"`
+	MSPType  string             `json:"MSPType"`
+	Policies map[string]*Policy `json:"Policies"`
+
+	AnchorPeers      []*AnchorPeer `json:"AnchorPeers"`
+	OrdererEndpoints []string      `json:"OrdererEndpoints"`
+
+	// deprecated in Fabric, only used for default policies
+	AdminPrincipal string `json:"AdminPrincipal"`
+}
+
+// AnchorPeer is an anchor peer of a peer organization
+type AnchorPeer struct {
+	Host string `json:"Host"`
+	Port int    `json:"Port"`
+}
+
+// Orderer is the orderer section of a profile
+type Orderer struct {
+	OrdererType   string             `json:"OrdererType"`
+	Addresses     []string           `json:"Addresses"`
+	BatchTimeout  string             `json:"BatchTimeout"`
+	BatchSize     BatchSize          `json:"BatchSize"`
+	Kafka         Kafka              `json:"Kafka"`
+	EtcdRaft      *EtcdRaft          `json:"EtcdRaft"`
+	Organizations []*Organization    `json:"Organizations"`
+	MaxChannels   uint64             `json:"MaxChannels"`
+	Capabilities  map[string]bool    `json:"Capabilities"`
+	Policies      map[string]*Policy `json:"Policies"`
+}
+
+// BatchSize configures the size of blocks
+type BatchSize struct {
+	MaxMessageCount   uint32   `json:"MaxMessageCount"`
+	AbsoluteMaxBytes  ByteSize `json:"AbsoluteMaxBytes"`
+	PreferredMaxBytes ByteSize `json:"PreferredMaxBytes"`
+}
+
+// Kafka configures the Kafka based orderer
+type Kafka struct {
+	Brokers []string `json:"Brokers"`
+}
+
+// EtcdRaft configures the Raft based orderer
+type EtcdRaft struct {
+	Consenters []*Consenter     `json:"Consenters"`
+	Options    *EtcdRaftOptions `json:"Options"`
+}
+
+// Consenter is a Raft orderer node. TLS certificates are paths relative to configtx.yaml
+type Consenter struct {
+	Host          string `json:"Host"`
+	Port          uint32 `json:"Port"`
+	ClientTLSCert string `json:"ClientTLSCert"`
+	ServerTLSCert string `json:"ServerTLSCert"`
+}
+
+// EtcdRaftOptions are the options of Raft based orderer
+type EtcdRaftOptions struct {
+	TickInterval         string   `json:"TickInterval"`
+	ElectionTick         uint32   `json:"ElectionTick"`
+	HeartbeatTick        uint32   `json:"HeartbeatTick"`
+	MaxInflightBlocks    uint32   `json:"MaxInflightBlocks"`
+	SnapshotIntervalSize ByteSize `json:"SnapshotIntervalSize"`
+}
+
+// ByteSize is a number of bytes, either a plain number or a string like "98 MB" or "512 KB"
+type ByteSize uint32
+
+var byteSizeRegexp = regexp.MustCompile(`^([0-9]+)\s*(?i)(k|m|g)b?$`)
+
+// UnmarshalJSON parses the byte size same as configtxgen
+func (b *ByteSize) UnmarshalJSON(data []byte) error {
+	var n uint32
+	if err := json.Unmarshal(data, &n); err == nil {
+		*b = ByteSize(n)
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("invalid byte size %v", string(data))
+	}
+	size, err := parseByteSize(s)
+	if err != nil {
+		return err
+	}
+	*b = ByteSize(size)
+	return nil
+}
+
+func parseByteSize(s string) (uint32, error) {
+	match := byteSizeRegexp.FindStringSubmatch(strings.TrimSpace(s))
+	if match == nil {
+		size, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("invalid byte size %v", s)
+		}
+		return uint32(size), nil
+	}
+	size, err := strconv.ParseUint(match[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid byte size %v", s)
+	}
+	switch strings.ToLower(match[2]) {
+	case "g":
+		size = size << 30
+	case "m":
+		size = size << 20
+	case "k":
+		size = size << 10
+	}
+	if size > math.MaxUint32 {
+		return 0, fmt.Errorf("byte size %v overflows uint32", s)
+	}
+	return uint32(size), nil
+}
+
+// defaults of configtxgen
+const (
+	defaultOrdererType          = ordererTypeSolo
+	defaultBatchTimeout         = 2 * time.Second
+	defaultMaxMessageCount      = 500
+	defaultAbsoluteMaxBytes     = 10 * 1024 * 1024
+	defaultPreferredMaxBytes    = 2 * 1024 * 1024
+	defaultTickInterval         = "500ms"
+	defaultElectionTick         = 10
+	defaultHeartbeatTick        = 1
+	defaultMaxInflightBlocks    = 5
+	defaultSnapshotIntervalSize = 20 * 1024 * 1024
+	adminRoleAdminPrincipal     = "Role.ADMIN"
+)
+
+var (
+	defaultOrdererAddresses = []string{"127.0.0.1:7050"}
+	defaultKafkaBrokers     = []string{"127.0.0.1:9092"}
+)
+
+// loads the profile from configtx.yaml, applies the defaults of configtxgen and
+// resolves MSP folders and TLS certificates relative to configDir
+func loadProfile(configtx []byte, configDir string, name string) (*Profile, error) {
+	config := topLevel{}
+	if err := yaml.Unmarshal(configtx, &config); err != nil {
+		return nil, &Error{Profile: name, Err: fmt.Errorf("failed parsing configtx.yaml: %w", err)}
+	}
+	profile, ok := config.Profiles[name]
+	if !ok || profile == nil {
+		return nil, &Error{Profile: name, Err: fmt.Errorf("profile is not found in configtx.yaml")}
+	}
+	if err := profile.complete(configDir); err != nil {
+		return nil, withProfile(name, err)
+	}
+	return profile, nil
+}
+
+func (p *Profile) complete(configDir string) error {
+	if p.Application != nil {
+		for _, org := range p.Application.Organizations {
+			if err := org.complete(configDir); err != nil {
+				return err
+			}
+		}
+	}
+	for _, consortium := range p.Consortiums {
+		if consortium == nil {
+			continue
+		}
+		for _, org := range consortium.Organizations {
+			if err := org.complete(configDir); err != nil {
+				return err
+			}
+		}
+	}
+	if p.Orderer != nil {
+		for _, org := range p.Orderer.Organizations {
+			if err := org.complete(configDir); err != nil {
+				return err
+			}
+		}
+		if err := p.Orderer.complete(configDir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (org *Organization) complete(configDir string) error {
+	if org == nil {
+		return fmt.Errorf("organization list contains an empty item")
+	}
+	if org.Name == "" {
+		return fmt.Errorf("organization with ID %q has no Name", org.ID)
+	}
+	if org.MSPDir == "" {
+		return &Error{Org: org.Name, Err: fmt.Errorf("MSPDir is not set")}
+	}
+	if org.MSPType == "" {
+		org.MSPType = msp.ProviderTypeToString(msp.FABRIC)
+	}
+	if org.AdminPrincipal == "" {
+		org.AdminPrincipal = adminRoleAdminPrincipal
+	}
+	org.MSPDir = translatePath(configDir, org.MSPDir)
+	return nil
+}
+
+func (o *Orderer) complete(configDir string) error {
+	if o.OrdererType == "" {
+		o.OrdererType = defaultOrdererType
+	}
+	if o.Addresses == nil {
+		o.Addresses = defaultOrdererAddresses
+	}
+	if o.BatchTimeout == "" {
+		o.BatchTimeout = defaultBatchTimeout.String()
+	}
+	if _, err := time.ParseDuration(o.BatchTimeout); err != nil {
+		return fmt.Errorf("invalid Orderer.BatchTimeout %v: %w", o.BatchTimeout, err)
+	}
+	if o.BatchSize.MaxMessageCount == 0 {
+		o.BatchSize.MaxMessageCount = defaultMaxMessageCount
+	}
+	if o.BatchSize.AbsoluteMaxBytes == 0 {
+		o.BatchSize.AbsoluteMaxBytes = defaultAbsoluteMaxBytes
+	}
+	if o.BatchSize.PreferredMaxBytes == 0 {
+		o.BatchSize.PreferredMaxBytes = defaultPreferredMaxBytes
+	}
+
+	switch o.OrdererType {
+	case ordererTypeSolo:
+	case ordererTypeKafka:
+		if o.Kafka.Brokers == nil {
+			o.Kafka.Brokers = defaultKafkaBrokers
+		}
+	case ordererTypeEtcdRaft:
+		return o.EtcdRaft.complete(configDir)
+	default:
+		return fmt.Errorf("unknown orderer type %v", o.OrdererType)
+	}
+	return nil
+}
+
+func (r *EtcdRaft) complete(configDir string) error {
+	if r == nil {
+		return fmt.Errorf("%v configuration is missing in Orderer.EtcdRaft", ordererTypeEtcdRaft)
+	}
+	if r.Options == nil {
+		r.Options = &EtcdRaftOptions{}
+	}
+	if r.Options.TickInterval == "" {
+		r.Options.TickInterval = defaultTickInterval
+	}
+	if r.Options.ElectionTick == 0 {
+		r.Options.ElectionTick = defaultElectionTick
+	}
+	if r.Options.HeartbeatTick == 0 {
+		r.Options.HeartbeatTick = defaultHeartbeatTick
+	}
+	if r.Options.MaxInflightBlocks == 0 {
+		r.Options.MaxInflightBlocks = defaultMaxInflightBlocks
+	}
+	if r.Options.SnapshotIntervalSize == 0 {
+		r.Options.SnapshotIntervalSize = defaultSnapshotIntervalSize
+	}
+
+	if _, err := time.ParseDuration(r.Options.TickInterval); err != nil {
+		return fmt.Errorf("invalid Orderer.EtcdRaft.Options.TickInterval %v: %w", r.Options.TickInterval, err)
+	}
+	if r.Options.ElectionTick <= r.Options.HeartbeatTick {
+		return fmt.Errorf("Orderer.EtcdRaft.Options.ElectionTick must be greater than HeartbeatTick")
+	}
+	if len(r.Consenters) == 0 {
+		return fmt.Errorf("Orderer.EtcdRaft does not specify any consenter")
+	}
+	for i, c := range r.Consenters {
+		switch {
+		case c == nil || c.Host == "":
+			return fmt.Errorf("consenter %d in Orderer.EtcdRaft does not specify Host", i)
+		case c.Port == 0:
+			return fmt.Errorf("consenter %v in Orderer.EtcdRaft does not specify Port", c.Host)
+		case c.ClientTLSCert == "":
+			return fmt.Errorf("consenter %v:%d in Orderer.EtcdRaft does not specify ClientTLSCert", c.Host, c.Port)
+		case c.ServerTLSCert == "":
+			return fmt.Errorf("consenter %v:%d in Orderer.EtcdRaft does not specify ServerTLSCert", c.Host, c.Port)
+		}
+		c.ClientTLSCert = translatePath(configDir, c.ClientTLSCert)
+		c.ServerTLSCert = translatePath(configDir, c.ServerTLSCert)
+	}
+	return nil
+}
+
+// relative paths in configtx.yaml are relative to its folder
+func translatePath(configDir string, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(configDir, path)
+}
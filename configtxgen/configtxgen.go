@@ -0,0 +1,85 @@
+// Package configtxgen creates genesis blocks and channel creation transactions from configtx.yaml, same as Fabric's configtxgen tool
+package configtxgen
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/common/genesis"
+	cb "github.com/hyperledger/fabric/protos/common"
+	"github.com/hyperledger/fabric/protos/utils"
+)
+
+// Error is a failure caused by a profile in configtx.yaml, and an organization in it if known
+type Error struct {
+	// Profile in configtx.yaml
+	Profile string
+	// Name of organization, empty if the failure is not specific to an organization
+	Org string
+	Err error
+}
+
+func (e *Error) Error() string {
+	if e.Org != "" {
+		return fmt.Sprintf("profile %v, organization %v: %v", e.Profile, e.Org, e.Err)
+	}
+	return fmt.Sprintf("profile %v: %v", e.Profile, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// sets the profile of an organization error, wraps other errors
+func withProfile(profile string, err error) error {
+	var e *Error
+	if errors.As(err, &e) {
+		e.Profile = profile
+		return e
+	}
+	return &Error{Profile: profile, Err: err}
+}
+
+// GenesisBlock creates the genesis block of the system channel from the profile, same as
+// configtxgen -profile <profile> -channelID <channelID> -outputBlock.
+// MSP folders and TLS certificates in configtx.yaml are relative to configDir
+func GenesisBlock(configtx []byte, configDir string, profile string, channelID string) ([]byte, error) {
+	conf, err := loadProfile(configtx, configDir, profile)
+	if err != nil {
+		return nil, err
+	}
+	if conf.Orderer == nil {
+		return nil, &Error{Profile: profile, Err: fmt.Errorf("profile has no Orderer section")}
+	}
+
+	channelGroup, err := newChannelGroup(conf)
+	if err != nil {
+		return nil, withProfile(profile, err)
+	}
+	block := genesis.NewFactoryImpl(channelGroup).Block(channelID)
+	return proto.Marshal(block)
+}
+
+// ChannelCreationTx creates the unsigned transaction creating the channel from the profile, same as
+// configtxgen -profile <profile> -channelID <channelID> -outputCreateChannelTx.
+// MSP folders in configtx.yaml are relative to configDir
+func ChannelCreationTx(configtx []byte, configDir string, profile string, channelID string) ([]byte, error) {
+	conf, err := loadProfile(configtx, configDir, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	configUpdate, err := newChannelCreateConfigUpdate(channelID, conf)
+	if err != nil {
+		return nil, withProfile(profile, err)
+	}
+	configUpdateEnv := &cb.ConfigUpdateEnvelope{
+		ConfigUpdate: utils.MarshalOrPanic(configUpdate),
+	}
+	envelope, err := utils.CreateSignedEnvelope(cb.HeaderType_CONFIG_UPDATE, channelID, nil, configUpdateEnv, 0, 0)
+	if err != nil {
+		return nil, withProfile(profile, err)
+	}
+	return proto.Marshal(envelope)
+}
@@ -0,0 +1,338 @@
+package configtxgen
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/common/channelconfig"
+	cb "github.com/hyperledger/fabric/protos/common"
+	ab "github.com/hyperledger/fabric/protos/orderer"
+	"github.com/hyperledger/fabric/protos/orderer/etcdraft"
+	"github.com/hyperledger/fabric/protos/utils"
+
+	"github.com/raftAtGit/hl-fabric-operator/cryptogen"
+)
+
+const testConfigtx = `
+Organizations:
+  - &Pivt
+    Name: PivtMSP
+    ID: PivtMSP
+    MSPDir: crypto-config/ordererOrganizations/pivt.nl/msp
+    Policies: &PivtPolicies
+      Readers:
+        Type: Signature
+        Rule: "OR('PivtMSP.member')"
+      Writers:
+        Type: Signature
+        Rule: "OR('PivtMSP.member')"
+      Admins:
+        Type: Signature
+        Rule: "OR('PivtMSP.admin')"
+  - &Karga
+    Name: KargaMSP
+    ID: KargaMSP
+    MSPDir: crypto-config/peerOrganizations/aptalkarga.tr/msp
+    AnchorPeers:
+      - Host: peer0.aptalkarga.tr
+        Port: 7051
+  - &Atlantis
+    Name: AtlantisMSP
+    ID: AtlantisMSP
+    MSPDir: crypto-config/peerOrganizations/atlantis.com/msp
+
+Capabilities:
+  Channel: &ChannelCapabilities
+    V1_4_3: true
+  Orderer: &OrdererCapabilities
+    V1_4_2: true
+
+Orderer: &OrdererDefaults
+  OrdererType: etcdraft
+  Addresses:
+    - orderer0.pivt.nl:7050
+  BatchTimeout: 1s
+  BatchSize:
+    MaxMessageCount: 5
+    AbsoluteMaxBytes: 98 MB
+    PreferredMaxBytes: 1024 KB
+  EtcdRaft:
+    Consenters:
+      - Host: orderer0.pivt.nl
+        Port: 7050
+        ClientTLSCert: crypto-config/ordererOrganizations/pivt.nl/orderers/orderer0.pivt.nl/tls/server.crt
+        ServerTLSCert: crypto-config/ordererOrganizations/pivt.nl/orderers/orderer0.pivt.nl/tls/server.crt
+  Organizations:
+  Capabilities:
+    <<: *OrdererCapabilities
+
+Application: &ApplicationDefaults
+  Organizations:
+
+Profiles:
+  OrdererGenesis:
+    Capabilities:
+      <<: *ChannelCapabilities
+    Orderer:
+      <<: *OrdererDefaults
+      Organizations:
+        - *Pivt
+    Consortiums:
+      TheConsortium:
+        Organizations:
+          - *Karga
+          - *Atlantis
+  common:
+    Consortium: TheConsortium
+    Application:
+      <<: *ApplicationDefaults
+      Organizations:
+        - *Karga
+        - *Atlantis
+`
+
+// creates crypto material of the organizations in configtx.yaml in a temporary directory
+func testConfigDir(t *testing.T) string {
+	dir := t.TempDir()
+	config := &cryptogen.Config{
+		OrdererOrgs: []cryptogen.OrdererOrg{{
+			Name:          "Pivt",
+			Domain:        "pivt.nl",
+			EnableNodeOUs: true,
+			Specs:         []cryptogen.Host{{Hostname: "orderer0"}},
+		}},
+		PeerOrgs: []cryptogen.PeerOrg{
+			{Name: "Karga", Domain: "aptalkarga.tr", EnableNodeOUs: true, Template: cryptogen.Count{Count: 1}, Users: cryptogen.Count{Count: 1}},
+			{Name: "Atlantis", Domain: "atlantis.com", EnableNodeOUs: true, Template: cryptogen.Count{Count: 1}, Users: cryptogen.Count{Count: 1}},
+		},
+	}
+	if err := cryptogen.Generate(config, filepath.Join(dir, "crypto-config")); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func groupNames(group *cb.ConfigGroup) []string {
+	names := []string{}
+	for name := range group.Groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestGenesisBlock(t *testing.T) {
+	dir := testConfigDir(t)
+
+	data, err := GenesisBlock([]byte(testConfigtx), dir, "OrdererGenesis", "testchainid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block := &cb.Block{}
+	if err := proto.Unmarshal(data, block); err != nil {
+		t.Fatal(err)
+	}
+	if block.Header.Number != 0 {
+		t.Errorf("block number is %v, expected 0", block.Header.Number)
+	}
+	envelope, err := utils.ExtractEnvelope(block, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := utils.UnmarshalPayload(envelope.Payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := utils.UnmarshalChannelHeader(payload.Header.ChannelHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.ChannelId != "testchainid" {
+		t.Errorf("channel id is %v, expected testchainid", header.ChannelId)
+	}
+	if header.Type != int32(cb.HeaderType_CONFIG) {
+		t.Errorf("header type is %v, expected CONFIG", header.Type)
+	}
+
+	configEnv := &cb.ConfigEnvelope{}
+	if err := proto.Unmarshal(payload.Data, configEnv); err != nil {
+		t.Fatal(err)
+	}
+	channelGroup := configEnv.Config.ChannelGroup
+	if got := groupNames(channelGroup); strings.Join(got, ",") != "Consortiums,Orderer" {
+		t.Errorf("channel groups are %v, expected Consortiums and Orderer", got)
+	}
+	ordererGroup := channelGroup.Groups[channelconfig.OrdererGroupKey]
+	if got := groupNames(ordererGroup); strings.Join(got, ",") != "PivtMSP" {
+		t.Errorf("orderer orgs are %v, expected PivtMSP", got)
+	}
+	consortium, ok := channelGroup.Groups[channelconfig.ConsortiumsGroupKey].Groups["TheConsortium"]
+	if !ok {
+		t.Fatal("TheConsortium is missing")
+	}
+	if got := groupNames(consortium); strings.Join(got, ",") != "AtlantisMSP,KargaMSP" {
+		t.Errorf("consortium orgs are %v, expected AtlantisMSP and KargaMSP", got)
+	}
+
+	batchSize := &ab.BatchSize{}
+	if err := proto.Unmarshal(ordererGroup.Values[channelconfig.BatchSizeKey].Value, batchSize); err != nil {
+		t.Fatal(err)
+	}
+	if batchSize.MaxMessageCount != 5 || batchSize.AbsoluteMaxBytes != 98*1024*1024 || batchSize.PreferredMaxBytes != 1024*1024 {
+		t.Errorf("unexpected batch size %v", batchSize)
+	}
+
+	consensusType := &ab.ConsensusType{}
+	if err := proto.Unmarshal(ordererGroup.Values[channelconfig.ConsensusTypeKey].Value, consensusType); err != nil {
+		t.Fatal(err)
+	}
+	if consensusType.Type != "etcdraft" {
+		t.Errorf("consensus type is %v, expected etcdraft", consensusType.Type)
+	}
+	metadata := &etcdraft.ConfigMetadata{}
+	if err := proto.Unmarshal(consensusType.Metadata, metadata); err != nil {
+		t.Fatal(err)
+	}
+	if len(metadata.Consenters) != 1 {
+		t.Fatalf("%v consenters, expected 1", len(metadata.Consenters))
+	}
+	tlsCert, err := os.ReadFile(filepath.Join(dir, "crypto-config/ordererOrganizations/pivt.nl/orderers/orderer0.pivt.nl/tls/server.crt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(metadata.Consenters[0].ServerTlsCert, tlsCert) {
+		t.Error("server TLS certificate of consenter is not the certificate of orderer0")
+	}
+	if metadata.Options.ElectionTick != defaultElectionTick {
+		t.Errorf("election tick is %v, expected default %v", metadata.Options.ElectionTick, defaultElectionTick)
+	}
+
+	// the block must be a valid channel configuration
+	if _, err := channelconfig.NewBundle("testchainid", configEnv.Config); err != nil {
+		t.Errorf("invalid channel configuration: %v", err)
+	}
+}
+
+func TestChannelCreationTx(t *testing.T) {
+	dir := testConfigDir(t)
+
+	data, err := ChannelCreationTx([]byte(testConfigtx), dir, "common", "common")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	envelope := &cb.Envelope{}
+	if err := proto.Unmarshal(data, envelope); err != nil {
+		t.Fatal(err)
+	}
+	payload, err := utils.UnmarshalPayload(envelope.Payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := utils.UnmarshalChannelHeader(payload.Header.ChannelHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Type != int32(cb.HeaderType_CONFIG_UPDATE) {
+		t.Errorf("header type is %v, expected CONFIG_UPDATE", header.Type)
+	}
+
+	configUpdateEnv := &cb.ConfigUpdateEnvelope{}
+	if err := proto.Unmarshal(payload.Data, configUpdateEnv); err != nil {
+		t.Fatal(err)
+	}
+	configUpdate := &cb.ConfigUpdate{}
+	if err := proto.Unmarshal(configUpdateEnv.ConfigUpdate, configUpdate); err != nil {
+		t.Fatal(err)
+	}
+	if configUpdate.ChannelId != "common" {
+		t.Errorf("channel id is %v, expected common", configUpdate.ChannelId)
+	}
+
+	consortium := &cb.Consortium{}
+	if err := proto.Unmarshal(configUpdate.WriteSet.Values[channelconfig.ConsortiumKey].Value, consortium); err != nil {
+		t.Fatal(err)
+	}
+	if consortium.Name != "TheConsortium" {
+		t.Errorf("consortium is %v, expected TheConsortium", consortium.Name)
+	}
+	application := configUpdate.WriteSet.Groups[channelconfig.ApplicationGroupKey]
+	if got := groupNames(application); strings.Join(got, ",") != "AtlantisMSP,KargaMSP" {
+		t.Errorf("application orgs are %v, expected AtlantisMSP and KargaMSP", got)
+	}
+
+}
+
+func TestErrors(t *testing.T) {
+	dir := testConfigDir(t)
+
+	tests := []struct {
+		name     string
+		configtx string
+		profile  string
+		org      string
+		contains string
+	}{
+		{
+			name:     "missing profile",
+			configtx: testConfigtx,
+			profile:  "NoSuchProfile",
+			contains: "not found",
+		},
+		{
+			name:     "missing MSP folder",
+			configtx: strings.Replace(testConfigtx, "peerOrganizations/atlantis.com/msp", "peerOrganizations/nowhere.com/msp", 1),
+			profile:  "OrdererGenesis",
+			org:      "AtlantisMSP",
+			contains: "nowhere.com",
+		},
+		{
+			name:     "invalid policy rule",
+			configtx: strings.Replace(testConfigtx, "OR('PivtMSP.admin')", "OR('PivtMSP.admin'", 1),
+			profile:  "OrdererGenesis",
+			org:      "PivtMSP",
+			contains: "Admins",
+		},
+		{
+			name:     "missing consenter certificate",
+			configtx: strings.Replace(testConfigtx, "ClientTLSCert: crypto-config/ordererOrganizations/pivt.nl/orderers/orderer0.pivt.nl/tls/server.crt", "ClientTLSCert: missing.crt", 1),
+			profile:  "OrdererGenesis",
+			contains: "client cert",
+		},
+		{
+			name:     "no orderer",
+			configtx: testConfigtx,
+			profile:  "common",
+			contains: "no Orderer",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := GenesisBlock([]byte(test.configtx), dir, test.profile, "testchainid")
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			var e *Error
+			if !errors.As(err, &e) {
+				t.Fatalf("expected an *Error, got %T: %v", err, err)
+			}
+			if e.Profile != test.profile {
+				t.Errorf("profile of error is %q, expected %q", e.Profile, test.profile)
+			}
+			if e.Org != test.org {
+				t.Errorf("organization of error is %q, expected %q", e.Org, test.org)
+			}
+			if !strings.Contains(err.Error(), test.contains) {
+				t.Errorf("error %q does not contain %q", err, test.contains)
+			}
+		})
+	}
+}
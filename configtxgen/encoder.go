@@ -0,0 +1,356 @@
+package configtxgen
+
+// modified from:
+// https://github.com/hyperledger/fabric/blob/v1.4.9/common/tools/configtxgen/encoder/encoder.go
+// Fabric's encoder reads configtx.yaml with viper and cannot be built together with Argo's mapstructure version
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric/common/cauthdsl"
+	"github.com/hyperledger/fabric/common/channelconfig"
+	"github.com/hyperledger/fabric/common/policies"
+	"github.com/hyperledger/fabric/common/tools/configtxlator/update"
+	"github.com/hyperledger/fabric/msp"
+	cb "github.com/hyperledger/fabric/protos/common"
+	"github.com/hyperledger/fabric/protos/orderer/etcdraft"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"github.com/hyperledger/fabric/protos/utils"
+)
+
+const (
+	ordererAdminsPolicyName  = "/Channel/Orderer/Admins"
+	blockValidationPolicyKey = "BlockValidation"
+
+	signaturePolicyType    = "Signature"
+	implicitMetaPolicyType = "ImplicitMeta"
+)
+
+func addValue(cg *cb.ConfigGroup, value channelconfig.ConfigValue, modPolicy string) {
+	cg.Values[value.Key()] = &cb.ConfigValue{
+		Value:     utils.MarshalOrPanic(value.Value()),
+		ModPolicy: modPolicy,
+	}
+}
+
+func addPolicy(cg *cb.ConfigGroup, policy policies.ConfigPolicy, modPolicy string) {
+	cg.Policies[policy.Key()] = &cb.ConfigPolicy{
+		Policy:    policy.Value(),
+		ModPolicy: modPolicy,
+	}
+}
+
+func addPolicies(cg *cb.ConfigGroup, policyMap map[string]*Policy, modPolicy string) error {
+	for name, policy := range policyMap {
+		if policy == nil {
+			return fmt.Errorf("policy %v is empty", name)
+		}
+		switch policy.Type {
+		case implicitMetaPolicyType:
+			imp, err := policies.ImplicitMetaFromString(policy.Rule)
+			if err != nil {
+				return fmt.Errorf("invalid implicit meta rule %q of policy %v: %w", policy.Rule, name, err)
+			}
+			cg.Policies[name] = &cb.ConfigPolicy{
+				ModPolicy: modPolicy,
+				Policy: &cb.Policy{
+					Type:  int32(cb.Policy_IMPLICIT_META),
+					Value: utils.MarshalOrPanic(imp),
+				},
+			}
+		case signaturePolicyType:
+			sp, err := cauthdsl.FromString(policy.Rule)
+			if err != nil {
+				return fmt.Errorf("invalid signature rule %q of policy %v: %w", policy.Rule, name, err)
+			}
+			cg.Policies[name] = &cb.ConfigPolicy{
+				ModPolicy: modPolicy,
+				Policy: &cb.Policy{
+					Type:  int32(cb.Policy_SIGNATURE),
+					Value: utils.MarshalOrPanic(sp),
+				},
+			}
+		default:
+			return fmt.Errorf("unknown type %q of policy %v", policy.Type, name)
+		}
+	}
+	return nil
+}
+
+// adds Readers/Writers/Admins policies with Any/Any/Majority rules
+func addImplicitMetaPolicyDefaults(cg *cb.ConfigGroup) {
+	addPolicy(cg, policies.ImplicitMetaMajorityPolicy(channelconfig.AdminsPolicyKey), channelconfig.AdminsPolicyKey)
+	addPolicy(cg, policies.ImplicitMetaAnyPolicy(channelconfig.ReadersPolicyKey), channelconfig.AdminsPolicyKey)
+	addPolicy(cg, policies.ImplicitMetaAnyPolicy(channelconfig.WritersPolicyKey), channelconfig.AdminsPolicyKey)
+}
+
+// adds orderer's Readers/Writers/Admins/BlockValidation policies with Any/Any/Majority/Any rules
+func addOrdererImplicitMetaPolicyDefaults(cg *cb.ConfigGroup) {
+	cg.Policies[blockValidationPolicyKey] = &cb.ConfigPolicy{
+		Policy:    policies.ImplicitMetaAnyPolicy(channelconfig.WritersPolicyKey).Value(),
+		ModPolicy: channelconfig.AdminsPolicyKey,
+	}
+	addImplicitMetaPolicyDefaults(cg)
+}
+
+// adds Readers/Writers/Admins policies requiring one signature from the MSP. in dev mode any member is an admin
+func addSignaturePolicyDefaults(cg *cb.ConfigGroup, mspID string, devMode bool) {
+	if devMode {
+		addPolicy(cg, policies.SignaturePolicy(channelconfig.AdminsPolicyKey, cauthdsl.SignedByMspMember(mspID)), channelconfig.AdminsPolicyKey)
+	} else {
+		addPolicy(cg, policies.SignaturePolicy(channelconfig.AdminsPolicyKey, cauthdsl.SignedByMspAdmin(mspID)), channelconfig.AdminsPolicyKey)
+	}
+	addPolicy(cg, policies.SignaturePolicy(channelconfig.ReadersPolicyKey, cauthdsl.SignedByMspMember(mspID)), channelconfig.AdminsPolicyKey)
+	addPolicy(cg, policies.SignaturePolicy(channelconfig.WritersPolicyKey, cauthdsl.SignedByMspMember(mspID)), channelconfig.AdminsPolicyKey)
+}
+
+// creates the root of channel configuration with orderer, application and consortiums groups defined in the profile
+func newChannelGroup(conf *Profile) (*cb.ConfigGroup, error) {
+	channelGroup := cb.NewConfigGroup()
+	if len(conf.Policies) == 0 {
+		addImplicitMetaPolicyDefaults(channelGroup)
+	} else if err := addPolicies(channelGroup, conf.Policies, channelconfig.AdminsPolicyKey); err != nil {
+		return nil, fmt.Errorf("invalid channel policies: %w", err)
+	}
+
+	addValue(channelGroup, channelconfig.HashingAlgorithmValue(), channelconfig.AdminsPolicyKey)
+	addValue(channelGroup, channelconfig.BlockDataHashingStructureValue(), channelconfig.AdminsPolicyKey)
+	if conf.Orderer != nil && len(conf.Orderer.Addresses) > 0 {
+		addValue(channelGroup, channelconfig.OrdererAddressesValue(conf.Orderer.Addresses), ordererAdminsPolicyName)
+	}
+	if conf.Consortium != "" {
+		addValue(channelGroup, channelconfig.ConsortiumValue(conf.Consortium), channelconfig.AdminsPolicyKey)
+	}
+	if len(conf.Capabilities) > 0 {
+		addValue(channelGroup, channelconfig.CapabilitiesValue(conf.Capabilities), channelconfig.AdminsPolicyKey)
+	}
+
+	var err error
+	if conf.Orderer != nil {
+		if channelGroup.Groups[channelconfig.OrdererGroupKey], err = newOrdererGroup(conf.Orderer); err != nil {
+			return nil, err
+		}
+	}
+	if conf.Application != nil {
+		if channelGroup.Groups[channelconfig.ApplicationGroupKey], err = newApplicationGroup(conf.Application); err != nil {
+			return nil, err
+		}
+	}
+	if conf.Consortiums != nil {
+		if channelGroup.Groups[channelconfig.ConsortiumsGroupKey], err = newConsortiumsGroup(conf.Consortiums); err != nil {
+			return nil, err
+		}
+	}
+
+	channelGroup.ModPolicy = channelconfig.AdminsPolicyKey
+	return channelGroup, nil
+}
+
+// creates the orderer group with batch, consensus settings and orderer organizations
+func newOrdererGroup(conf *Orderer) (*cb.ConfigGroup, error) {
+	ordererGroup := cb.NewConfigGroup()
+	if len(conf.Policies) == 0 {
+		addOrdererImplicitMetaPolicyDefaults(ordererGroup)
+	} else if err := addPolicies(ordererGroup, conf.Policies, channelconfig.AdminsPolicyKey); err != nil {
+		return nil, fmt.Errorf("invalid orderer policies: %w", err)
+	}
+
+	batchTimeout, err := time.ParseDuration(conf.BatchTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Orderer.BatchTimeout %v: %w", conf.BatchTimeout, err)
+	}
+	addValue(ordererGroup, channelconfig.BatchSizeValue(
+		conf.BatchSize.MaxMessageCount,
+		uint32(conf.BatchSize.AbsoluteMaxBytes),
+		uint32(conf.BatchSize.PreferredMaxBytes),
+	), channelconfig.AdminsPolicyKey)
+	addValue(ordererGroup, channelconfig.BatchTimeoutValue(batchTimeout.String()), channelconfig.AdminsPolicyKey)
+	addValue(ordererGroup, channelconfig.ChannelRestrictionsValue(conf.MaxChannels), channelconfig.AdminsPolicyKey)
+	if len(conf.Capabilities) > 0 {
+		addValue(ordererGroup, channelconfig.CapabilitiesValue(conf.Capabilities), channelconfig.AdminsPolicyKey)
+	}
+
+	var consensusMetadata []byte
+	switch conf.OrdererType {
+	case ordererTypeSolo:
+	case ordererTypeKafka:
+		addValue(ordererGroup, channelconfig.KafkaBrokersValue(conf.Kafka.Brokers), channelconfig.AdminsPolicyKey)
+	case ordererTypeEtcdRaft:
+		if consensusMetadata, err = etcdraft.Marshal(conf.EtcdRaft.metadata()); err != nil {
+			return nil, fmt.Errorf("invalid Orderer.EtcdRaft: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown orderer type %v", conf.OrdererType)
+	}
+	addValue(ordererGroup, channelconfig.ConsensusTypeValue(conf.OrdererType, consensusMetadata), channelconfig.AdminsPolicyKey)
+
+	for _, org := range conf.Organizations {
+		if ordererGroup.Groups[org.Name], err = newOrdererOrgGroup(org); err != nil {
+			return nil, err
+		}
+	}
+
+	ordererGroup.ModPolicy = channelconfig.AdminsPolicyKey
+	return ordererGroup, nil
+}
+
+// etcdraft metadata with certificate paths, etcdraft.Marshal replaces them with file contents
+func (r *EtcdRaft) metadata() *etcdraft.ConfigMetadata {
+	md := &etcdraft.ConfigMetadata{
+		Options: &etcdraft.Options{
+			TickInterval:         r.Options.TickInterval,
+			ElectionTick:         r.Options.ElectionTick,
+			HeartbeatTick:        r.Options.HeartbeatTick,
+			MaxInflightBlocks:    r.Options.MaxInflightBlocks,
+			SnapshotIntervalSize: uint32(r.Options.SnapshotIntervalSize),
+		},
+	}
+	for _, c := range r.Consenters {
+		md.Consenters = append(md.Consenters, &etcdraft.Consenter{
+			Host:          c.Host,
+			Port:          c.Port,
+			ClientTlsCert: []byte(c.ClientTLSCert),
+			ServerTlsCert: []byte(c.ServerTLSCert),
+		})
+	}
+	return md
+}
+
+// creates the group of an organization with its MSP and policies. failures point at the organization
+func newOrgGroup(conf *Organization) (*cb.ConfigGroup, error) {
+	mspConfig, err := msp.GetVerifyingMspConfig(conf.MSPDir, conf.ID, conf.MSPType)
+	if err != nil {
+		return nil, &Error{Org: conf.Name, Err: fmt.Errorf("failed loading MSP from %v: %w", conf.MSPDir, err)}
+	}
+
+	orgGroup := cb.NewConfigGroup()
+	if len(conf.Policies) == 0 {
+		addSignaturePolicyDefaults(orgGroup, conf.ID, conf.AdminPrincipal != adminRoleAdminPrincipal)
+	} else if err := addPolicies(orgGroup, conf.Policies, channelconfig.AdminsPolicyKey); err != nil {
+		return nil, &Error{Org: conf.Name, Err: err}
+	}
+	addValue(orgGroup, channelconfig.MSPValue(mspConfig), channelconfig.AdminsPolicyKey)
+
+	orgGroup.ModPolicy = channelconfig.AdminsPolicyKey
+	return orgGroup, nil
+}
+
+func newOrdererOrgGroup(conf *Organization) (*cb.ConfigGroup, error) {
+	orgGroup, err := newOrgGroup(conf)
+	if err != nil {
+		return nil, err
+	}
+	if len(conf.OrdererEndpoints) > 0 {
+		addValue(orgGroup, channelconfig.EndpointsValue(conf.OrdererEndpoints), channelconfig.AdminsPolicyKey)
+	}
+	return orgGroup, nil
+}
+
+// creates the application group with peer organizations, which are involved in chaincodes
+func newApplicationGroup(conf *Application) (*cb.ConfigGroup, error) {
+	applicationGroup := cb.NewConfigGroup()
+	if len(conf.Policies) == 0 {
+		addImplicitMetaPolicyDefaults(applicationGroup)
+	} else if err := addPolicies(applicationGroup, conf.Policies, channelconfig.AdminsPolicyKey); err != nil {
+		return nil, fmt.Errorf("invalid application policies: %w", err)
+	}
+	if len(conf.ACLs) > 0 {
+		addValue(applicationGroup, channelconfig.ACLValues(conf.ACLs), channelconfig.AdminsPolicyKey)
+	}
+	if len(conf.Capabilities) > 0 {
+		addValue(applicationGroup, channelconfig.CapabilitiesValue(conf.Capabilities), channelconfig.AdminsPolicyKey)
+	}
+
+	for _, org := range conf.Organizations {
+		var err error
+		if applicationGroup.Groups[org.Name], err = newApplicationOrgGroup(org); err != nil {
+			return nil, err
+		}
+	}
+
+	applicationGroup.ModPolicy = channelconfig.AdminsPolicyKey
+	return applicationGroup, nil
+}
+
+// creates the group of a peer organization with its anchor peers
+func newApplicationOrgGroup(conf *Organization) (*cb.ConfigGroup, error) {
+	orgGroup, err := newOrgGroup(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	var anchorPeers []*pb.AnchorPeer
+	for _, anchorPeer := range conf.AnchorPeers {
+		anchorPeers = append(anchorPeers, &pb.AnchorPeer{
+			Host: anchorPeer.Host,
+			Port: int32(anchorPeer.Port),
+		})
+	}
+	// no empty anchor peers value, otherwise channel creation computes a delta from the system channel
+	if len(anchorPeers) > 0 {
+		addValue(orgGroup, channelconfig.AnchorPeersValue(anchorPeers), channelconfig.AdminsPolicyKey)
+	}
+	return orgGroup, nil
+}
+
+// creates the consortiums group of the system channel. it is modified only by orderer admins
+func newConsortiumsGroup(conf map[string]*Consortium) (*cb.ConfigGroup, error) {
+	consortiumsGroup := cb.NewConfigGroup()
+	// only used by the implicit meta policy of the channel, so control of the system channel belongs to orderer admins
+	addPolicy(consortiumsGroup, policies.SignaturePolicy(channelconfig.AdminsPolicyKey, cauthdsl.AcceptAllPolicy), ordererAdminsPolicyName)
+
+	for name, consortium := range conf {
+		consortiumGroup := cb.NewConfigGroup()
+		if consortium != nil {
+			for _, org := range consortium.Organizations {
+				var err error
+				if consortiumGroup.Groups[org.Name], err = newOrgGroup(org); err != nil {
+					return nil, err
+				}
+			}
+		}
+		addValue(consortiumGroup, channelconfig.ChannelCreationPolicyValue(policies.ImplicitMetaAnyPolicy(channelconfig.AdminsPolicyKey).Value()), ordererAdminsPolicyName)
+		consortiumGroup.ModPolicy = ordererAdminsPolicyName
+		consortiumsGroup.Groups[name] = consortiumGroup
+	}
+
+	consortiumsGroup.ModPolicy = ordererAdminsPolicyName
+	return consortiumsGroup, nil
+}
+
+// creates the config update which creates the channel, assuming there is no system channel context
+func newChannelCreateConfigUpdate(channelID string, conf *Profile) (*cb.ConfigUpdate, error) {
+	if conf.Application == nil {
+		return nil, fmt.Errorf("profile has no Application section")
+	}
+	if conf.Consortium == "" {
+		return nil, fmt.Errorf("profile has no Consortium")
+	}
+
+	template, err := newChannelGroup(conf)
+	if err != nil {
+		return nil, err
+	}
+	template.Groups[channelconfig.ApplicationGroupKey].Values = nil
+	template.Groups[channelconfig.ApplicationGroupKey].Policies = nil
+
+	channelGroup, err := newChannelGroup(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	configUpdate, err := update.Compute(&cb.Config{ChannelGroup: template}, &cb.Config{ChannelGroup: channelGroup})
+	if err != nil {
+		return nil, fmt.Errorf("failed computing config update: %w", err)
+	}
+
+	// consortium of the channel is required in the write set
+	configUpdate.ChannelId = channelID
+	configUpdate.ReadSet.Values[channelconfig.ConsortiumKey] = &cb.ConfigValue{Version: 0}
+	configUpdate.WriteSet.Values[channelconfig.ConsortiumKey] = &cb.ConfigValue{
+		Version: 0,
+		Value:   utils.MarshalOrPanic(&cb.Consortium{Name: conf.Consortium}),
+	}
+	return configUpdate, nil
+}
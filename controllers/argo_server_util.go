@@ -0,0 +1,164 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+)
+
+// ArgoServerOptions are the settings to reach Argo Server
+type ArgoServerOptions struct {
+	// URL of Argo Server, i.e. https://argo-server.argo:2746
+	URL string
+	// File containing the bearer token to authenticate with. Read on every request, so rotated tokens are picked up
+	TokenFile string
+	// PEM encoded CA certificates to verify the TLS certificate of Argo Server. System CAs are used if empty
+	CAFile string
+	// Skip verifying the TLS certificate of Argo Server
+	InsecureSkipVerify bool
+}
+
+// ArgoServerClient manages workflows through the REST API of Argo Server
+type ArgoServerClient struct {
+	url       string
+	tokenFile string
+	client    *http.Client
+}
+
+var workflowsResource = schema.GroupResource{Group: wfv1.SchemeGroupVersion.Group, Resource: "workflows"}
+
+// NewArgoServerClient creates a client for the Argo Server in options
+func NewArgoServerClient(options ArgoServerOptions) (*ArgoServerClient, error) {
+	u, err := url.Parse(options.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("Invalid Argo Server URL %q, expected http(s)://host:port", options.URL)
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: options.InsecureSkipVerify}
+	if options.CAFile != "" {
+		caCerts, err := os.ReadFile(options.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caCerts) {
+			return nil, fmt.Errorf("No CA certificates found in %v", options.CAFile)
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	return &ArgoServerClient{
+		url:       strings.TrimSuffix(options.URL, "/"),
+		tokenFile: options.TokenFile,
+		client:    &http.Client{Transport: transport, Timeout: 30 * time.Second},
+	}, nil
+}
+
+// sends the request to Argo Server and decodes the response into out, if not nil.
+// returns a NotFound error if the workflow does not exist
+func (c *ArgoServerClient) do(ctx context.Context, method string, path string, name string, in interface{}, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, c.url+path, body)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if c.tokenFile != "" {
+		token, err := os.ReadFile(c.tokenFile)
+		if err != nil {
+			return fmt.Errorf("Reading Argo Server token failed: %w", err)
+		}
+		request.Header.Set("Authorization", "Bearer "+strings.TrimPrefix(strings.TrimSpace(string(token)), "Bearer "))
+	}
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+
+	if response.StatusCode == http.StatusNotFound {
+		return errors.NewNotFound(workflowsResource, name)
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		apiError := struct {
+			Message string `json:"message"`
+		}{}
+		if json.Unmarshal(data, &apiError) != nil || apiError.Message == "" {
+			apiError.Message = strings.TrimSpace(string(data))
+		}
+		return fmt.Errorf("Argo Server returned %v: %v", response.Status, apiError.Message)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+func (c *ArgoServerClient) createWorkflow(ctx context.Context, workflow *wfv1.Workflow) (*wfv1.Workflow, error) {
+	request := map[string]interface{}{"namespace": workflow.Namespace, "workflow": workflow}
+	created := &wfv1.Workflow{}
+	if err := c.do(ctx, http.MethodPost, "/api/v1/workflows/"+url.PathEscape(workflow.Namespace), workflow.GenerateName, request, created); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+func (c *ArgoServerClient) getWorkflow(ctx context.Context, namespace string, name string) (*wfv1.Workflow, error) {
+	workflow := &wfv1.Workflow{}
+	if err := c.do(ctx, http.MethodGet, workflowPath(namespace, name), name, nil, workflow); err != nil {
+		return nil, err
+	}
+	return workflow, nil
+}
+
+func (c *ArgoServerClient) terminateWorkflow(ctx context.Context, namespace string, name string) error {
+	request := map[string]string{"namespace": namespace, "name": name}
+	return c.do(ctx, http.MethodPut, workflowPath(namespace, name)+"/terminate", name, request, nil)
+}
+
+// returns the workflows matching the label selector, only with metadata and phase and finish time of status
+func (c *ArgoServerClient) listWorkflows(ctx context.Context, namespace string, selector string) ([]wfv1.Workflow, error) {
+	query := url.Values{}
+	query.Set("listOptions.labelSelector", selector)
+	query.Set("fields", "items.metadata.name,items.metadata.labels,items.metadata.creationTimestamp,items.status.phase,items.status.finishedAt")
+
+	list := &wfv1.WorkflowList{}
+	if err := c.do(ctx, http.MethodGet, "/api/v1/workflows/"+url.PathEscape(namespace)+"?"+query.Encode(), "", nil, list); err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+func (c *ArgoServerClient) deleteWorkflow(ctx context.Context, namespace string, name string) error {
+	return c.do(ctx, http.MethodDelete, workflowPath(namespace, name), name, nil, nil)
+}
+
+func workflowPath(namespace string, name string) string {
+	return "/api/v1/workflows/" + url.PathEscape(namespace) + "/" + url.PathEscape(name)
+}
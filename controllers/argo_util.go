@@ -4,59 +4,27 @@ import (
 	"context"
 	"fmt"
 
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sLabels "k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
 	runtimeClient "sigs.k8s.io/controller-runtime/pkg/client"
 
-	wf "github.com/argoproj/argo-workflows/v3/pkg/apiclient/workflow"
 	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
 
-	"github.com/argoproj/argo-workflows/v3/cmd/argo/commands/client"
 	argoCommon "github.com/argoproj/argo-workflows/v3/workflow/common"
 	argoJson "github.com/argoproj/pkg/json"
 
 	"github.com/raftAtGit/hl-fabric-operator/api/v1alpha1"
 )
 
-type wfStatus string
-
-const (
-	wfSubmitted wfStatus = "Submitted"
-	wfCompleted wfStatus = "Completed"
-	wfFailed    wfStatus = "Failed"
-)
-
-func (r *FabricNetworkReconciler) startChannelFlow(ctx context.Context, network *v1alpha1.FabricNetwork) (string, error) {
-	wfManifest, err := r.renderChannelFlow(ctx, network)
-	if err != nil {
-		r.Log.Error(err, "Rendering channel-flow failed")
-		return "", err
-	}
-
-	return r.submitWorkflow(ctx, network, wfManifest)
+// runs flows as Argo Workflows
+type argoEngine struct {
+	r *FabricNetworkReconciler
 }
 
-// empty array for includeChaincodes means, all chaincodes
-func (r *FabricNetworkReconciler) startChaincodeFlow(ctx context.Context, network *v1alpha1.FabricNetwork, includeChaincodes []string) (string, error) {
-	wfManifest, err := r.renderChaincodeFlow(ctx, network, includeChaincodes)
-	if err != nil {
-		r.Log.Error(err, "Rendering chaincode-flow failed")
-		return "", err
-	}
-
-	return r.submitWorkflow(ctx, network, wfManifest)
-}
-
-func (r *FabricNetworkReconciler) startPeerOrgFlow(ctx context.Context, network *v1alpha1.FabricNetwork) (string, error) {
-	wfManifest, err := r.renderPeerOrgFlow(ctx, network)
-	if err != nil {
-		r.Log.Error(err, "Rendering peer-org-flow failed")
-		return "", err
-	}
-
-	return r.submitWorkflow(ctx, network, wfManifest)
-}
-
-func (r *FabricNetworkReconciler) submitWorkflow(ctx context.Context, network *v1alpha1.FabricNetwork, wfManifest string) (string, error) {
+func (e *argoEngine) Submit(ctx context.Context, network *v1alpha1.FabricNetwork, wfManifest string, labels map[string]string) (string, error) {
+	r := e.r
 
 	wfs, err := r.unmarshalWorkflows([]byte(wfManifest), true)
 	if err != nil {
@@ -70,50 +38,89 @@ func (r *FabricNetworkReconciler) submitWorkflow(ctx context.Context, network *v
 	if wfs[0].Labels == nil {
 		wfs[0].Labels = make(map[string]string)
 	}
-	wfs[0].Labels["raft.io/fabric-operator-created-for"] = network.Name
-
-	ctx, apiClient := client.NewAPIClient(ctx)
-	serviceClient := apiClient.NewWorkflowServiceClient()
-
-	options := &metav1.CreateOptions{}
-
-	created, err := serviceClient.CreateWorkflow(ctx, &wf.WorkflowCreateRequest{
-		Namespace:     network.Namespace,
-		Workflow:      &wfs[0],
-		ServerDryRun:  false,
-		CreateOptions: options,
-	})
+	for key, value := range labels {
+		wfs[0].Labels[key] = value
+	}
 
+	workflow := &wfs[0]
+	workflow.Namespace = network.Namespace
+	if r.ArgoServer != nil {
+		workflow, err = r.ArgoServer.createWorkflow(ctx, workflow)
+	} else {
+		err = r.Create(ctx, workflow)
+	}
 	if err != nil {
 		r.Log.Error(err, "Failed to submit workflow")
+		r.Recorder.Eventf(network, corev1.EventTypeWarning, "WorkflowSubmitFailed", "Submitting workflow %v failed: %v", wfs[0].GenerateName, err)
 		return "", err
 	}
-	r.Log.Info("Submitted workflow", "name", created.ObjectMeta.Name)
-	return created.ObjectMeta.Name, nil
+	r.Log.Info("Submitted workflow", "name", workflow.Name)
+	return workflow.Name, nil
 }
 
-func (r *FabricNetworkReconciler) getWorkflowStatus(ctx context.Context, network *v1alpha1.FabricNetwork, wfName string) (wfStatus, error) {
-	ctx, apiClient := client.NewAPIClient(ctx)
-	serviceClient := apiClient.NewWorkflowServiceClient()
+// returns the workflow from Argo Server if configured, otherwise from the cache of the manager
+func (e *argoEngine) getWorkflow(ctx context.Context, namespace string, wfName string) (*wfv1.Workflow, error) {
+	if e.r.ArgoServer != nil {
+		return e.r.ArgoServer.getWorkflow(ctx, namespace, wfName)
+	}
+	workflow := &wfv1.Workflow{}
+	if err := e.r.Get(ctx, types.NamespacedName{Namespace: namespace, Name: wfName}, workflow); err != nil {
+		return nil, err
+	}
+	return workflow, nil
+}
 
-	workflow, err := serviceClient.GetWorkflow(ctx, &wf.WorkflowGetRequest{
-		Namespace: network.Namespace,
-		Name:      wfName,
-	})
+// returns the workflows matching the labels from Argo Server if configured, otherwise from the cache of the manager
+func (e *argoEngine) listWorkflows(ctx context.Context, namespace string, labels map[string]string) ([]wfv1.Workflow, error) {
+	if e.r.ArgoServer != nil {
+		return e.r.ArgoServer.listWorkflows(ctx, namespace, k8sLabels.SelectorFromSet(labels).String())
+	}
+	wfList := &wfv1.WorkflowList{}
+	if err := e.r.List(ctx, wfList, runtimeClient.InNamespace(namespace), runtimeClient.MatchingLabels(labels)); err != nil {
+		return nil, err
+	}
+	return wfList.Items, nil
+}
 
+func (e *argoEngine) List(ctx context.Context, namespace string, labels map[string]string) ([]flowInfo, error) {
+	workflows, err := e.listWorkflows(ctx, namespace, labels)
+	if err != nil {
+		return nil, err
+	}
+	flows := []flowInfo{}
+	for _, workflow := range workflows {
+		flows = append(flows, flowInfo{
+			Name:       workflow.Name,
+			Type:       workflow.Labels[flowTypeLabel],
+			Status:     workflowStatus(&workflow),
+			CreatedAt:  workflow.CreationTimestamp.Time,
+			FinishedAt: workflow.Status.FinishedAt.Time,
+		})
+	}
+	return flows, nil
+}
+
+// returns the status of the workflow and the message of the workflow, if any
+func (e *argoEngine) Status(ctx context.Context, network *v1alpha1.FabricNetwork, wfName string) (wfStatus, string, error) {
+	r := e.r
+	workflow, err := e.getWorkflow(ctx, network.Namespace, wfName)
 	if err != nil {
 		r.Log.Error(err, "Failed to get workflow")
-		return "", err
+		return "", "", err
 	}
 	r.Log.Info("Got workflow", "name", wfName, "phase", workflow.Status.Phase)
 
+	return workflowStatus(workflow), workflow.Status.Message, nil
+}
+
+func workflowStatus(workflow *wfv1.Workflow) wfStatus {
 	switch workflow.Status.Phase {
 	case wfv1.WorkflowSucceeded:
-		return wfCompleted, nil
-	case wfv1.WorkflowFailed:
-		return wfFailed, nil
+		return wfCompleted
+	case wfv1.WorkflowFailed, wfv1.WorkflowError:
+		return wfFailed
 	default:
-		return wfSubmitted, nil
+		return wfSubmitted
 	}
 }
 
@@ -136,20 +143,74 @@ func (r *FabricNetworkReconciler) unmarshalWorkflows(wfBytes []byte, strict bool
 	return yamlWfs, nil
 }
 
-func (r *FabricNetworkReconciler) deleteWorkflows(ctx context.Context, namespace string, name string) error {
-	wfList := &wfv1.WorkflowList{}
-	listOpts := []runtimeClient.ListOption{
-		runtimeClient.InNamespace(namespace),
-		runtimeClient.MatchingLabels(map[string]string{"raft.io/fabric-operator-created-for": name}),
+// terminates the workflow, exit handlers are not run
+func (e *argoEngine) Cancel(ctx context.Context, network *v1alpha1.FabricNetwork, wfName string) error {
+	workflow, err := e.getWorkflow(ctx, network.Namespace, wfName)
+	if err != nil {
+		return runtimeClient.IgnoreNotFound(err)
 	}
+	if workflow.Status.Fulfilled() {
+		return nil
+	}
+	if e.r.ArgoServer != nil {
+		return e.r.ArgoServer.terminateWorkflow(ctx, network.Namespace, wfName)
+	}
+	patch := runtimeClient.MergeFrom(workflow.DeepCopy())
+	workflow.Spec.Shutdown = wfv1.ShutdownStrategyTerminate
+	return e.r.Patch(ctx, workflow, patch)
+}
 
-	if err := r.List(ctx, wfList, listOpts...); err != nil {
+// returns the logs of the main containers of the workflow pods, by node name
+func (e *argoEngine) Logs(ctx context.Context, namespace string, wfName string) (map[string]string, error) {
+	return e.r.podLogs(ctx, namespace, "workflows.argoproj.io/workflow="+wfName, "main", func(pod *corev1.Pod) string {
+		return pod.Annotations["workflows.argoproj.io/node-name"]
+	})
+}
+
+// returns the pod node of the workflow which failed first
+func (e *argoEngine) FailedStep(ctx context.Context, namespace string, wfName string) (*v1alpha1.FailedStep, error) {
+	workflow, err := e.getWorkflow(ctx, namespace, wfName)
+	if err != nil {
+		return nil, err
+	}
+	var failed *wfv1.NodeStatus
+	for _, node := range workflow.Status.Nodes {
+		if node.Type != wfv1.NodeTypePod || (node.Phase != wfv1.NodeFailed && node.Phase != wfv1.NodeError) {
+			continue
+		}
+		if failed == nil || node.FinishedAt.Before(&failed.FinishedAt) ||
+			(node.FinishedAt.Equal(&failed.FinishedAt) && node.Name < failed.Name) {
+			node := node
+			failed = &node
+		}
+	}
+	if failed == nil {
+		return nil, nil
+	}
+	template := failed.TemplateName
+	if template == "" && failed.TemplateRef != nil {
+		template = failed.TemplateRef.Name + "/" + failed.TemplateRef.Template
+	}
+	return &v1alpha1.FailedStep{Name: failed.Name, Template: template, Message: failed.Message}, nil
+}
+
+func (e *argoEngine) Delete(ctx context.Context, namespace string, wfName string) error {
+	if e.r.ArgoServer != nil {
+		return e.r.ArgoServer.deleteWorkflow(ctx, namespace, wfName)
+	}
+	return e.r.Delete(ctx, &wfv1.Workflow{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: wfName}})
+}
+
+func (e *argoEngine) DeleteAll(ctx context.Context, namespace string, name string) error {
+	r := e.r
+	workflows, err := e.listWorkflows(ctx, namespace, map[string]string{"raft.io/fabric-operator-created-for": name})
+	if err != nil {
 		r.Log.Error(err, "Failed to get WorkflowList")
 		return err
 	}
 
-	for _, wf := range wfList.Items {
-		if err := r.Delete(ctx, &wf); err != nil {
+	for _, wf := range workflows {
+		if err := e.Delete(ctx, namespace, wf.Name); runtimeClient.IgnoreNotFound(err) != nil {
 			return err
 		}
 		r.Log.Info("deleted workflow", "workflow", wf.Name)
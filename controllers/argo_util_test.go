@@ -0,0 +1,230 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/raftAtGit/hl-fabric-operator/api/v1alpha1"
+)
+
+func TestArgoEngine(t *testing.T) {
+	ctx := context.Background()
+	network := &v1alpha1.FabricNetwork{ObjectMeta: metav1.ObjectMeta{Name: "simple", Namespace: "argo-test"}}
+	r := testReconciler(t, network)
+
+	name, err := r.startFlow(ctx, network, "channel-flow", renderTestFlow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if network.Status.FlowEngine != v1alpha1.FlowEngineArgo {
+		t.Errorf("flow engine in status is %v, expected Argo", network.Status.FlowEngine)
+	}
+	network.Status.State = v1alpha1.StateChannelFlowSubmitted
+	network.Status.Workflow = name
+
+	workflow := &wfv1.Workflow{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: network.Namespace, Name: name}, workflow); err != nil {
+		t.Fatal(err)
+	}
+	if workflow.Labels["raft.io/fabric-operator-created-for"] != "simple" {
+		t.Errorf("workflow is not labeled with the FabricNetwork: %v", workflow.Labels)
+	}
+	if status, _, err := r.getFlowStatus(ctx, network); err != nil || status != wfSubmitted {
+		t.Fatalf("status is %v %v, expected Submitted", status, err)
+	}
+
+	if err := r.cancelFlow(ctx, network); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: network.Namespace, Name: name}, workflow); err != nil {
+		t.Fatal(err)
+	}
+	if workflow.Spec.Shutdown != wfv1.ShutdownStrategyTerminate {
+		t.Errorf("shutdown of cancelled workflow is %q, expected Terminate", workflow.Spec.Shutdown)
+	}
+
+	failTestWorkflow(t, r, network.Namespace, name)
+	status, message, err := r.getFlowStatus(ctx, network)
+	if err != nil || status != wfFailed || message != "Stopped with strategy 'Terminate'" {
+		t.Fatalf("status is %v %q %v, expected Failed", status, message, err)
+	}
+
+	if err := r.deleteFlows(ctx, network.Namespace, network.Name); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: network.Namespace, Name: name}, workflow); !errors.IsNotFound(err) {
+		t.Errorf("workflow is not deleted: %v", err)
+	}
+}
+
+// sets the phase of the workflow to Failed, as Argo does for terminated workflows
+func failTestWorkflow(t *testing.T, r *FabricNetworkReconciler, namespace string, name string) {
+	workflow := &wfv1.Workflow{}
+	if err := r.Get(context.Background(), types.NamespacedName{Namespace: namespace, Name: name}, workflow); err != nil {
+		t.Fatal(err)
+	}
+	workflow.Status.Phase = wfv1.WorkflowFailed
+	workflow.Status.Message = "Stopped with strategy 'Terminate'"
+	if err := r.Update(context.Background(), workflow); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fake Argo Server keeping workflows in memory
+type testArgoServer struct {
+	t         *testing.T
+	workflows map[string]*wfv1.Workflow
+	requests  []string
+}
+
+func (s *testArgoServer) ServeHTTP(w http.ResponseWriter, request *http.Request) {
+	s.requests = append(s.requests, request.Method+" "+request.URL.Path)
+	if request.Header.Get("Authorization") != "Bearer secret-token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"code":16,"message":"token not valid"}`))
+		return
+	}
+
+	path := strings.Split(strings.TrimPrefix(request.URL.Path, "/api/v1/workflows/"), "/")
+	switch {
+	case request.Method == http.MethodPost && len(path) == 1:
+		body := struct {
+			Workflow *wfv1.Workflow `json:"workflow"`
+		}{}
+		if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+			s.t.Error(err)
+		}
+		body.Workflow.Name = body.Workflow.GenerateName + "xyz12"
+		s.workflows[body.Workflow.Name] = body.Workflow
+		json.NewEncoder(w).Encode(body.Workflow)
+
+	case request.Method == http.MethodGet && len(path) == 1:
+		selector, err := labels.Parse(request.URL.Query().Get("listOptions.labelSelector"))
+		if err != nil {
+			s.t.Error(err)
+		}
+		list := &wfv1.WorkflowList{}
+		for _, workflow := range s.workflows {
+			if selector.Matches(labels.Set(workflow.Labels)) {
+				list.Items = append(list.Items, *workflow)
+			}
+		}
+		json.NewEncoder(w).Encode(list)
+
+	case s.workflows[path[1]] == nil:
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"code":5,"message":"workflows.argoproj.io \"` + path[1] + `\" not found"}`))
+
+	case request.Method == http.MethodGet:
+		json.NewEncoder(w).Encode(s.workflows[path[1]])
+
+	case request.Method == http.MethodPut && len(path) == 3 && path[2] == "terminate":
+		s.workflows[path[1]].Status.Phase = wfv1.WorkflowFailed
+		json.NewEncoder(w).Encode(s.workflows[path[1]])
+
+	case request.Method == http.MethodDelete:
+		delete(s.workflows, path[1])
+		w.Write([]byte(`{}`))
+
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func TestArgoEngineWithArgoServer(t *testing.T) {
+	ctx := context.Background()
+	argoServer := &testArgoServer{t: t, workflows: map[string]*wfv1.Workflow{}}
+	server := httptest.NewTLSServer(argoServer)
+	defer server.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("secret-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	client, err := NewArgoServerClient(ArgoServerOptions{URL: server.URL, TokenFile: tokenFile, InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	network := &v1alpha1.FabricNetwork{ObjectMeta: metav1.ObjectMeta{Name: "simple", Namespace: "argo-test"}}
+	r := testReconciler(t, network)
+	r.ArgoServer = client
+
+	name, err := r.startFlow(ctx, network, "channel-flow", renderTestFlow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "hlf-channels-xyz12" {
+		t.Errorf("workflow name is %v, expected the one from Argo Server", name)
+	}
+	if argoServer.workflows[name].Labels["raft.io/fabric-operator-created-for"] != "simple" {
+		t.Errorf("workflow is not labeled with the FabricNetwork")
+	}
+	// the workflow is not created through the Kubernetes API
+	if err := r.Get(ctx, types.NamespacedName{Namespace: network.Namespace, Name: name}, &wfv1.Workflow{}); !errors.IsNotFound(err) {
+		t.Errorf("workflow is created in Kubernetes: %v", err)
+	}
+	network.Status.State = v1alpha1.StateChannelFlowSubmitted
+	network.Status.Workflow = name
+
+	if status, _, err := r.getFlowStatus(ctx, network); err != nil || status != wfSubmitted {
+		t.Fatalf("status is %v %v, expected Submitted", status, err)
+	}
+	if err := r.cancelFlow(ctx, network); err != nil {
+		t.Fatal(err)
+	}
+	if status, _, err := r.getFlowStatus(ctx, network); err != nil || status != wfFailed {
+		t.Fatalf("status is %v %v, expected Failed", status, err)
+	}
+
+	if err := r.deleteFlows(ctx, network.Namespace, network.Name); err != nil {
+		t.Fatal(err)
+	}
+	if len(argoServer.workflows) != 0 {
+		t.Errorf("%d workflows left in Argo Server", len(argoServer.workflows))
+	}
+	if _, _, err := r.getFlowStatus(ctx, network); !errors.IsNotFound(err) {
+		t.Errorf("expected a NotFound error for deleted workflow, got %v", err)
+	}
+
+	// TLS certificate of the server is not trusted without InsecureSkipVerify
+	client, err = NewArgoServerClient(ArgoServerOptions{URL: server.URL, TokenFile: tokenFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.getWorkflow(ctx, network.Namespace, name); err == nil || !strings.Contains(err.Error(), "certificate") {
+		t.Errorf("expected a certificate error, got %v", err)
+	}
+}
+
+func TestArgoServerErrors(t *testing.T) {
+	argoServer := &testArgoServer{t: t, workflows: map[string]*wfv1.Workflow{}}
+	server := httptest.NewServer(argoServer)
+	defer server.Close()
+
+	if _, err := NewArgoServerClient(ArgoServerOptions{URL: "argo-server:2746"}); err == nil {
+		t.Error("expected an error for URL without scheme")
+	}
+
+	// no token
+	client, err := NewArgoServerClient(ArgoServerOptions{URL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.getWorkflow(context.Background(), "argo-test", "hlf-channels-xyz12")
+	if err == nil || !strings.Contains(err.Error(), "token not valid") {
+		t.Errorf("expected the message of Argo Server in error, got %v", err)
+	}
+}
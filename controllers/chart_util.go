@@ -0,0 +1,326 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	hchart "helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/ignore"
+	"helm.sh/helm/v3/pkg/registry"
+	"helm.sh/helm/v3/pkg/repo"
+	"helm.sh/helm/v3/pkg/strvals"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/yaml"
+
+	"github.com/raftAtGit/hl-fabric-operator/api/v1alpha1"
+	"github.com/raftAtGit/hl-fabric-operator/charts"
+)
+
+// files of PIVT charts, keyed by chart source, name and version. charts are read once and loaded from memory for each use,
+// since Helm modifies the loaded charts while installing or rendering them
+type chartFilesCache struct {
+	mu    sync.Mutex
+	files map[string][]*loader.BufferedFile
+}
+
+var pivtCharts = &chartFilesCache{files: make(map[string][]*loader.BufferedFile)}
+
+// returns the files of the chart, reads them with the given function if not read before
+func (c *chartFilesCache) get(key string, read func() ([]*loader.BufferedFile, error)) ([]*loader.BufferedFile, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if files, ok := c.files[key]; ok {
+		return files, nil
+	}
+	files, err := read()
+	if err != nil {
+		return nil, err
+	}
+	c.files[key] = files
+	return files, nil
+}
+
+// returns the version of PIVT charts the FabricNetwork uses, empty means the latest one
+func chartVersion(network *v1alpha1.FabricNetwork) string {
+	if network.Spec.Charts.Version != "" {
+		return network.Spec.Charts.Version
+	}
+	return network.Status.ChartVersion
+}
+
+// loads the PIVT chart of the FabricNetwork from memory, with additional files if any.
+// charts are pulled from the Helm repository in spec, otherwise embedded charts or the charts in PivtDir are used
+func loadChart(network *v1alpha1.FabricNetwork, name string, extraFiles ...*loader.BufferedFile) (*hchart.Chart, error) {
+	version := chartVersion(network)
+
+	var files []*loader.BufferedFile
+	var err error
+	if repository := network.Spec.Charts.Repository; repository != "" {
+		files, err = pivtCharts.get(repository+"/"+name+":"+version, func() ([]*loader.BufferedFile, error) {
+			return pullChartFiles(network.Namespace, repository, name, version)
+		})
+	} else {
+		files, err = pivtCharts.get(name, func() ([]*loader.BufferedFile, error) {
+			return readChartFiles(localCharts(), name)
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	all := make([]*loader.BufferedFile, 0, len(files)+len(extraFiles))
+	all = append(all, files...)
+	all = append(all, extraFiles...)
+	chart, err := loader.LoadFiles(all)
+	if err != nil {
+		return nil, err
+	}
+
+	// only hlf-kube is pinned for local charts, workflow charts always come with it
+	if name == "hlf-kube" && version != "" && chart.Metadata.Version != version {
+		return nil, fmt.Errorf("hlf-kube chart version %v is not available, operator has version %v. Set spec.charts.repository to pull it",
+			version, chart.Metadata.Version)
+	}
+	return chart, nil
+}
+
+// returns the fabric-kube folder of PIVT, embedded in the operator if exists otherwise in PivtDir
+func localCharts() fs.FS {
+	if fabricKube := charts.FabricKube(); fabricKube != nil {
+		return fabricKube
+	}
+	return os.DirFS(settings.PivtDir + "/fabric-kube")
+}
+
+// pulls the chart from an HTTP(S) chart repository or an OCI registry and returns its files
+func pullChartFiles(namespace string, repository string, name string, version string) ([]*loader.BufferedFile, error) {
+	getters := getter.All(helmSettings.get(namespace))
+
+	chartURL := ""
+	if registry.IsOCI(repository) {
+		chartURL = strings.TrimSuffix(repository, "/") + "/" + name
+		if version != "" {
+			chartURL += ":" + version
+		}
+	} else {
+		var err error
+		if chartURL, err = repo.FindChartInRepoURL(repository, name, version, "", "", "", getters); err != nil {
+			return nil, err
+		}
+	}
+
+	u, err := url.Parse(chartURL)
+	if err != nil {
+		return nil, err
+	}
+	g, err := getters.ByScheme(u.Scheme)
+	if err != nil {
+		return nil, err
+	}
+	data, err := g.Get(chartURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed pulling chart %v: %w", chartURL, err)
+	}
+	return loader.LoadArchiveFiles(data)
+}
+
+// reads the files of chart folder respecting .helmignore, same as Helm's directory loader
+func readChartFiles(fsys fs.FS, dir string) ([]*loader.BufferedFile, error) {
+	rules := ignore.Empty()
+	if data, err := fs.ReadFile(fsys, path.Join(dir, ignore.HelmIgnore)); err == nil {
+		if rules, err = ignore.Parse(bytes.NewReader(data)); err != nil {
+			return nil, err
+		}
+	}
+	rules.AddDefaults()
+
+	files := []*loader.BufferedFile{}
+	err := fs.WalkDir(fsys, dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		n := strings.TrimPrefix(strings.TrimPrefix(name, dir), "/")
+		if n == "" {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if rules.Ignore(n, fi) {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if rules.Ignore(n, fi) || !fi.Mode().IsRegular() {
+			return nil
+		}
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		files = append(files, &loader.BufferedFile{Name: n, Data: bytes.TrimPrefix(data, []byte("\xEF\xBB\xBF"))})
+		return nil
+	})
+	return files, err
+}
+
+// loads the hlf-kube chart with the crypto material and genesis block of the FabricNetwork as chart files
+func hlfKubeChart(network *v1alpha1.FabricNetwork, artifacts *networkArtifacts) (*hchart.Chart, error) {
+	files, err := readTar(bytes.NewReader(artifacts.cryptoConfig))
+	if err != nil {
+		return nil, err
+	}
+	extraFiles := make([]*loader.BufferedFile, 0, len(files)+1)
+	for name, data := range files {
+		extraFiles = append(extraFiles, &loader.BufferedFile{Name: "crypto-config/" + name, Data: data})
+	}
+	if artifacts.genesisBlock != nil {
+		extraFiles = append(extraFiles, &loader.BufferedFile{Name: "channel-artifacts/genesis.block", Data: artifacts.genesisBlock})
+	}
+
+	chart, err := loadChart(network, "hlf-kube", extraFiles...)
+	if err != nil {
+		return nil, err
+	}
+	if chart.Metadata.Annotations == nil {
+		chart.Metadata.Annotations = make(map[string]string)
+	}
+	chart.Metadata.Annotations["raft.io/fabric-operator-created-for"] = network.Name
+
+	return chart, nil
+}
+
+// assembles the values passed to PIVT charts. values are merged in the given order, later ones override the earlier ones,
+// and set values in Helm's --set format are applied last
+func (r *FabricNetworkReconciler) getChartValues(ctx context.Context, network *v1alpha1.FabricNetwork, chartValues []map[string]interface{}, extraValues []string) (map[string]interface{}, error) {
+	hostAliases, err := r.getHostAliases(ctx, network)
+	if err != nil {
+		return nil, err
+	}
+
+	base := []interface{}{
+		networkContainer{Network: network.Spec.Network},
+		newCryptoConfig(network),
+		helmValues{HostAliases: hostAliases},
+	}
+	values := map[string]interface{}{}
+	for _, b := range base {
+		v, err := toValues(b)
+		if err != nil {
+			return nil, err
+		}
+		values = mergeMaps(values, v)
+	}
+	for _, v := range chartValues {
+		values = mergeMaps(values, v)
+	}
+
+	genesisProvided := false
+	if network.Spec.Genesis.Secret != "" {
+		genesisProvided = true
+	}
+	setValues := append([]string{
+		// TODO
+		"hyperledgerVersion=" + network.Spec.Topology.Version,
+		"tlsEnabled=" + strconv.FormatBool(network.Spec.Topology.TLSEnabled),
+		"useActualDomains=" + strconv.FormatBool(network.Spec.Topology.UseActualDomains),
+		"configMap.chaincode=false",
+		"secret.configtx=false",
+		"secret.genesis=" + strconv.FormatBool(!genesisProvided),
+	}, extraValues...)
+	for _, value := range setValues {
+		if err := strvals.ParseInto(value, values); err != nil {
+			return nil, fmt.Errorf("failed parsing value %v: %w", value, err)
+		}
+	}
+
+	return values, nil
+}
+
+// returns the additional values of a PIVT chart provided in FabricNetwork spec
+func rawValues(raw []byte) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	if len(raw) == 0 {
+		return values, nil
+	}
+	if err := json.Unmarshal(raw, &values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// returns the values shared by all Argo workflows
+func sharedWorkflowValues(network *v1alpha1.FabricNetwork) (map[string]interface{}, error) {
+	return toValues(argoContainer{Argo: network.Spec.Argo})
+}
+
+// returns configtx.yaml of FabricNetwork as values, peer-org-flow reads organizations from it
+func (r *FabricNetworkReconciler) configtxValues(ctx context.Context, network *v1alpha1.FabricNetwork) (map[string]interface{}, error) {
+	configtx, err := r.getConfigtx(ctx, network)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]interface{}{}
+	if err := yaml.Unmarshal(configtx, &values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// returns the contents of configtx.yaml of the FabricNetwork
+func (r *FabricNetworkReconciler) getConfigtx(ctx context.Context, network *v1alpha1.FabricNetwork) ([]byte, error) {
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: network.Spec.Configtx.Secret, Namespace: network.Namespace}, secret); err != nil {
+		r.Log.Error(err, "Couldnt get configtx secret", "configtx", network.Spec.Configtx.Secret)
+		return nil, err
+	}
+	return secret.Data["configtx.yaml"], nil
+}
+
+// converts the object to values, as if it's written to a values file and read back
+func toValues(o interface{}) (map[string]interface{}, error) {
+	bytes, err := json.Marshal(o)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]interface{}{}
+	if err := json.Unmarshal(bytes, &values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// merges values same as Helm merges values files
+func mergeMaps(a, b map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(a))
+	for k, v := range a {
+		out[k] = v
+	}
+	for k, v := range b {
+		if v, ok := v.(map[string]interface{}); ok {
+			if bv, ok := out[k]; ok {
+				if bv, ok := bv.(map[string]interface{}); ok {
+					out[k] = mergeMaps(bv, v)
+					continue
+				}
+			}
+		}
+		out[k] = v
+	}
+	return out
+}
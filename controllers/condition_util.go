@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/raftAtGit/hl-fabric-operator/api/v1alpha1"
+)
+
+// updates the conditions of FabricNetwork according to the transition from previous state to the current one.
+// conditions which are not affected by the transition are kept as they are, so the reason of a failure is not lost
+func setConditions(network *v1alpha1.FabricNetwork, previous v1alpha1.State) {
+	status := &network.Status
+	state := status.State
+
+	set := func(conditionType string, conditionStatus metav1.ConditionStatus, reason string, message string) {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               conditionType,
+			Status:             conditionStatus,
+			Reason:             reason,
+			Message:            message,
+			ObservedGeneration: network.Generation,
+		})
+	}
+
+	switch state {
+	case "":
+		return
+
+	case v1alpha1.StateInvalid, v1alpha1.StateRejected:
+		set(v1alpha1.ConditionReady, metav1.ConditionFalse, string(state), status.Message)
+		return
+
+	case v1alpha1.StateFailed:
+		// Degraded is only about the health of a running network, a failed flow is reported by the flow's condition
+		set(v1alpha1.ConditionReady, metav1.ConditionFalse, string(state), status.Message)
+		switch previous {
+		case v1alpha1.StateChannelFlowSubmitted, v1alpha1.StatePeerOrgFlowSubmitted:
+			set(v1alpha1.ConditionChannelsReady, metav1.ConditionFalse, string(state), status.Message)
+		case v1alpha1.StateChaincodeFlowSubmitted:
+			set(v1alpha1.ConditionChaincodesReady, metav1.ConditionFalse, string(state), status.Message)
+		}
+		return
+
+	case v1alpha1.StateDegraded:
+		set(v1alpha1.ConditionReady, metav1.ConditionFalse, string(state), status.Message)
+		set(v1alpha1.ConditionDegraded, metav1.ConditionTrue, string(state), status.Message)
+		set(v1alpha1.ConditionHelmReleaseReady, metav1.ConditionFalse, string(state), status.Message)
+		return
+
+	case v1alpha1.StateReady:
+		set(v1alpha1.ConditionReady, metav1.ConditionTrue, string(state), status.Message)
+		set(v1alpha1.ConditionCertificatesReady, metav1.ConditionTrue, string(state), "")
+		set(v1alpha1.ConditionHelmReleaseReady, metav1.ConditionTrue, string(state), "")
+		set(v1alpha1.ConditionChannelsReady, metav1.ConditionTrue, string(state), "")
+		set(v1alpha1.ConditionChaincodesReady, metav1.ConditionTrue, string(state), "")
+		set(v1alpha1.ConditionDegraded, metav1.ConditionFalse, string(state), "")
+		return
+	}
+
+	// all other states are in progress states
+	set(v1alpha1.ConditionReady, metav1.ConditionFalse, string(state), status.Message)
+
+	switch state {
+	case v1alpha1.StateNew:
+		set(v1alpha1.ConditionCertificatesReady, metav1.ConditionFalse, string(state), "Certificates will be created or downloaded")
+		set(v1alpha1.ConditionHelmReleaseReady, metav1.ConditionFalse, string(state), "Helm chart will be installed")
+		set(v1alpha1.ConditionChannelsReady, metav1.ConditionFalse, string(state), "")
+		set(v1alpha1.ConditionChaincodesReady, metav1.ConditionFalse, string(state), "")
+		set(v1alpha1.ConditionDegraded, metav1.ConditionFalse, string(state), "")
+
+	case v1alpha1.StateHelmChartInstalled, v1alpha1.StateHelmChartNeedsUpdate, v1alpha1.StateHelmChartNeedsDoubleUpdate:
+		// certificates are always prepared before Helm chart is installed or updated
+		set(v1alpha1.ConditionCertificatesReady, metav1.ConditionTrue, string(state), "")
+		set(v1alpha1.ConditionHelmReleaseReady, metav1.ConditionFalse, string(state), "Waiting for Helm release components to be ready")
+
+	case v1alpha1.StateHelmChartReady:
+		set(v1alpha1.ConditionHelmReleaseReady, metav1.ConditionTrue, string(state), "")
+
+	case v1alpha1.StateChannelFlowSubmitted:
+		set(v1alpha1.ConditionChannelsReady, metav1.ConditionFalse, string(state), "Waiting for channel-flow "+status.Workflow)
+	case v1alpha1.StateChannelFlowCompleted:
+		set(v1alpha1.ConditionChannelsReady, metav1.ConditionTrue, string(state), "")
+
+	case v1alpha1.StateChaincodeFlowSubmitted:
+		set(v1alpha1.ConditionChaincodesReady, metav1.ConditionFalse, string(state), "Waiting for chaincode-flow "+status.Workflow)
+	case v1alpha1.StateChaincodeFlowCompleted:
+		set(v1alpha1.ConditionChaincodesReady, metav1.ConditionTrue, string(state), "")
+
+	case v1alpha1.StatePeerOrgFlowSubmitted:
+		set(v1alpha1.ConditionChannelsReady, metav1.ConditionFalse, string(state), "Waiting for peer-org-flow "+status.Workflow)
+	}
+}
+
+// records the time FabricNetwork entered its current state
+func setPhaseTimestamp(network *v1alpha1.FabricNetwork) {
+	if network.Status.State == "" {
+		return
+	}
+	if network.Status.PhaseTimestamps == nil {
+		network.Status.PhaseTimestamps = make(map[string]metav1.Time)
+	}
+	network.Status.PhaseTimestamps[string(network.Status.State)] = metav1.Now()
+}
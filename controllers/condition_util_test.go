@@ -0,0 +1,184 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/raftAtGit/hl-fabric-operator/api/v1alpha1"
+)
+
+func TestSetConditions(t *testing.T) {
+	// conditions of a Ready FabricNetwork, flows are completed
+	ready := func() []metav1.Condition {
+		conditions := []metav1.Condition{}
+		for _, conditionType := range []string{v1alpha1.ConditionReady, v1alpha1.ConditionCertificatesReady, v1alpha1.ConditionHelmReleaseReady,
+			v1alpha1.ConditionChannelsReady, v1alpha1.ConditionChaincodesReady} {
+			meta.SetStatusCondition(&conditions, metav1.Condition{Type: conditionType, Status: metav1.ConditionTrue, Reason: "Ready"})
+		}
+		meta.SetStatusCondition(&conditions, metav1.Condition{Type: v1alpha1.ConditionDegraded, Status: metav1.ConditionFalse, Reason: "Ready"})
+		return conditions
+	}
+	degraded := func() []metav1.Condition {
+		conditions := ready()
+		meta.SetStatusCondition(&conditions, metav1.Condition{Type: v1alpha1.ConditionReady, Status: metav1.ConditionFalse, Reason: "Degraded"})
+		meta.SetStatusCondition(&conditions, metav1.Condition{Type: v1alpha1.ConditionHelmReleaseReady, Status: metav1.ConditionFalse, Reason: "Degraded"})
+		meta.SetStatusCondition(&conditions, metav1.Condition{Type: v1alpha1.ConditionDegraded, Status: metav1.ConditionTrue, Reason: "Degraded"})
+		return conditions
+	}
+
+	tests := []struct {
+		name       string
+		conditions []metav1.Condition
+		previous   v1alpha1.State
+		state      v1alpha1.State
+		// expected condition statuses, empty if the condition should not exist
+		expected map[string]metav1.ConditionStatus
+	}{
+		{
+			name:  "New",
+			state: v1alpha1.StateNew,
+			expected: map[string]metav1.ConditionStatus{
+				v1alpha1.ConditionReady:             metav1.ConditionFalse,
+				v1alpha1.ConditionCertificatesReady: metav1.ConditionFalse,
+				v1alpha1.ConditionHelmReleaseReady:  metav1.ConditionFalse,
+				v1alpha1.ConditionChannelsReady:     metav1.ConditionFalse,
+				v1alpha1.ConditionChaincodesReady:   metav1.ConditionFalse,
+				v1alpha1.ConditionDegraded:          metav1.ConditionFalse,
+			},
+		},
+		{
+			name:       "Failed from ChannelFlowSubmitted",
+			conditions: ready(),
+			previous:   v1alpha1.StateChannelFlowSubmitted,
+			state:      v1alpha1.StateFailed,
+			expected: map[string]metav1.ConditionStatus{
+				v1alpha1.ConditionReady:           metav1.ConditionFalse,
+				v1alpha1.ConditionChannelsReady:   metav1.ConditionFalse,
+				v1alpha1.ConditionChaincodesReady: metav1.ConditionTrue,
+				v1alpha1.ConditionDegraded:        metav1.ConditionFalse,
+			},
+		},
+		{
+			name:       "Failed from PeerOrgFlowSubmitted",
+			conditions: ready(),
+			previous:   v1alpha1.StatePeerOrgFlowSubmitted,
+			state:      v1alpha1.StateFailed,
+			expected: map[string]metav1.ConditionStatus{
+				v1alpha1.ConditionReady:           metav1.ConditionFalse,
+				v1alpha1.ConditionChannelsReady:   metav1.ConditionFalse,
+				v1alpha1.ConditionChaincodesReady: metav1.ConditionTrue,
+				v1alpha1.ConditionDegraded:        metav1.ConditionFalse,
+			},
+		},
+		{
+			name:       "Failed from ChaincodeFlowSubmitted",
+			conditions: ready(),
+			previous:   v1alpha1.StateChaincodeFlowSubmitted,
+			state:      v1alpha1.StateFailed,
+			expected: map[string]metav1.ConditionStatus{
+				v1alpha1.ConditionReady:           metav1.ConditionFalse,
+				v1alpha1.ConditionChannelsReady:   metav1.ConditionTrue,
+				v1alpha1.ConditionChaincodesReady: metav1.ConditionFalse,
+				v1alpha1.ConditionDegraded:        metav1.ConditionFalse,
+			},
+		},
+		{
+			name:     "Failed without conditions",
+			previous: v1alpha1.StateChannelFlowSubmitted,
+			state:    v1alpha1.StateFailed,
+			expected: map[string]metav1.ConditionStatus{
+				v1alpha1.ConditionReady:         metav1.ConditionFalse,
+				v1alpha1.ConditionChannelsReady: metav1.ConditionFalse,
+				v1alpha1.ConditionDegraded:      "",
+			},
+		},
+		{
+			name:       "Degraded",
+			conditions: ready(),
+			previous:   v1alpha1.StateReady,
+			state:      v1alpha1.StateDegraded,
+			expected: map[string]metav1.ConditionStatus{
+				v1alpha1.ConditionReady:            metav1.ConditionFalse,
+				v1alpha1.ConditionHelmReleaseReady: metav1.ConditionFalse,
+				v1alpha1.ConditionDegraded:         metav1.ConditionTrue,
+			},
+		},
+		{
+			name:       "Degraded to Ready",
+			conditions: degraded(),
+			previous:   v1alpha1.StateDegraded,
+			state:      v1alpha1.StateReady,
+			expected: map[string]metav1.ConditionStatus{
+				v1alpha1.ConditionReady:            metav1.ConditionTrue,
+				v1alpha1.ConditionHelmReleaseReady: metav1.ConditionTrue,
+				v1alpha1.ConditionDegraded:         metav1.ConditionFalse,
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			network := &v1alpha1.FabricNetwork{}
+			network.Generation = 3
+			network.Status.Conditions = test.conditions
+			network.Status.State = test.state
+			network.Status.Message = "message"
+
+			setConditions(network, test.previous)
+			for conditionType, expected := range test.expected {
+				condition := meta.FindStatusCondition(network.Status.Conditions, conditionType)
+				var status metav1.ConditionStatus
+				if condition != nil {
+					status = condition.Status
+				}
+				if status != expected {
+					t.Errorf("condition %v is %q, expected %q", conditionType, status, expected)
+				}
+			}
+			if condition := meta.FindStatusCondition(network.Status.Conditions, v1alpha1.ConditionReady); condition != nil && condition.ObservedGeneration != 3 {
+				t.Errorf("observedGeneration of Ready is %d, expected 3", condition.ObservedGeneration)
+			}
+		})
+	}
+}
+
+func TestSetPhaseTimestamp(t *testing.T) {
+	earlier := metav1.NewTime(time.Now().Add(-time.Hour))
+	tests := []struct {
+		name       string
+		state      v1alpha1.State
+		timestamps map[string]metav1.Time
+		expected   []string
+	}{
+		{"no state", "", nil, nil},
+		{"first state", v1alpha1.StateNew, nil, []string{"New"}},
+		{"other states are kept", v1alpha1.StateReady, map[string]metav1.Time{"New": earlier}, []string{"New", "Ready"}},
+		{"same state again", v1alpha1.StateNew, map[string]metav1.Time{"New": earlier}, []string{"New"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			network := &v1alpha1.FabricNetwork{}
+			network.Status.State = test.state
+			network.Status.PhaseTimestamps = test.timestamps
+
+			setPhaseTimestamp(network)
+			if len(network.Status.PhaseTimestamps) != len(test.expected) {
+				t.Fatalf("phase timestamps are %v, expected %v", network.Status.PhaseTimestamps, test.expected)
+			}
+			for _, state := range test.expected {
+				timestamp, ok := network.Status.PhaseTimestamps[state]
+				if !ok {
+					t.Fatalf("phase timestamp of %v is missing", state)
+				}
+				if state == string(test.state) && time.Since(timestamp.Time) > time.Minute {
+					t.Errorf("phase timestamp of %v is %v, expected now", state, timestamp)
+				}
+				if state != string(test.state) && !timestamp.Equal(&earlier) {
+					t.Errorf("phase timestamp of %v is changed to %v", state, timestamp)
+				}
+			}
+		})
+	}
+}
@@ -3,245 +3,226 @@ package controllers
 import (
 	"bytes"
 	"context"
-	"io/ioutil"
-	"os/exec"
+	"errors"
+	"fmt"
+	"os"
 
 	"github.com/raftAtGit/hl-fabric-operator/api/v1alpha1"
+	"github.com/raftAtGit/hl-fabric-operator/configtxgen"
+	"github.com/raftAtGit/hl-fabric-operator/cryptogen"
+	"github.com/raftAtGit/hl-fabric-operator/validation"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	ctrl "sigs.k8s.io/controller-runtime"
 )
 
-type cryptoConfig struct {
-	// Orderer organizations
-	OrdererOrgs []ordererOrg `json:"OrdererOrgs"`
-	// Peer organizations
-	PeerOrgs []peerOrg `json:"PeerOrgs"`
+// crypto material and genesis block of a FabricNetwork, passed to hlf-kube chart as chart files
+type networkArtifacts struct {
+	// gzipped tar of crypto-config folder, as stored in crypto-config Secret
+	cryptoConfig []byte
+	// genesis block, nil if genesis block is provided in a Secret
+	genesisBlock []byte
 }
 
-// Orderer organization
-type ordererOrg struct {
-	Name          string `json:"Name"`
-	Domain        string `json:"Domain"`
-	EnableNodeOUs bool   `json:"EnableNodeOUs"`
-
-	Specs []host `json:"Specs"`
-}
-
-type host struct {
-	Hostname string `json:"Hostname"`
-}
-
-// Peer organization
-type peerOrg struct {
-	Name          string `json:"Name"`
-	Domain        string `json:"Domain"`
-	EnableNodeOUs bool   `json:"EnableNodeOUs"`
-	Template      count  `json:"Template"`
-	Users         count  `json:"Users"`
-}
-
-type count struct {
-	Count int32 `json:"Count"`
-}
-
-const (
-	freshInstall = true
-	reconstruct  = false
-
-	genesisSecret      = "hlf-genesis.block"
-	cryptoConfigSecret = "hlf-crypto-config"
-)
-
-func (r *FabricNetworkReconciler) prepareChartDirForFabric(ctx context.Context, network *v1alpha1.FabricNetwork, isFreshInstall bool) error {
-
-	networkDir := getNetworkDir(network)
+// creates the crypto material and genesis block of a new FabricNetwork in a temporary directory,
+// and stores the crypto material in a Secret. genesis block is stored in a Secret by hlf-kube chart.
+// cryptogen and configtxgen of Fabric read and write MSP folders, so the temporary directory is needed until they work in memory
+func (r *FabricNetworkReconciler) prepareArtifacts(ctx context.Context, network *v1alpha1.FabricNetwork) (*networkArtifacts, error) {
+	workDir, err := os.MkdirTemp("", "fabric-operator-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(workDir)
 
-	if !isFreshInstall || network.Spec.CryptoConfig.Secret != "" {
-		if isFreshInstall {
-			r.Log.Info("CryptoConfig.Secret is provided. Downloading certificates from secret", "CryptoConfig.Secret", network.Spec.CryptoConfig.Secret)
-		} else {
-			r.Log.Info("This is not fresh installation but reconstruction. Downloading certificates from secret", "CryptoConfig.Secret", cryptoConfigSecret)
-		}
+	artifacts := &networkArtifacts{}
+	if network.Spec.CryptoConfig.Secret != "" {
+		r.Log.Info("CryptoConfig.Secret is provided. Downloading certificates from secret", "CryptoConfig.Secret", network.Spec.CryptoConfig.Secret)
 
-		secret := &corev1.Secret{}
-		err := r.Get(ctx, types.NamespacedName{Namespace: network.Namespace, Name: cryptoConfigSecret}, secret)
-		if err != nil {
-			return err
+		if artifacts.cryptoConfig, err = r.getCryptoConfig(ctx, network); err != nil {
+			return nil, err
 		}
-
-		folder := networkDir + "/crypto-config"
-		buf := bytes.NewBuffer(secret.Data["crypto-config"])
-		if err := uncompress(buf, folder); err != nil {
-			return err
+		// genesis block is created from the MSP folders of organizations
+		if err := uncompress(bytes.NewReader(artifacts.cryptoConfig), workDir+"/crypto-config"); err != nil {
+			return nil, err
 		}
-		r.Log.Info("Downloaded and uncompressed certificates from secret", "secret", cryptoConfigSecret, "folder", folder)
+		r.Log.Info("Downloaded and uncompressed certificates from secret", "secret", validation.CryptoConfigSecret(network))
 
 	} else {
 		r.Log.Info("Creating certificates", "network", network.Name)
-		// cryptogen generate --config ./crypto-config.yaml --output crypto-config
-		cmd := exec.CommandContext(ctx, "cryptogen", "generate", "--config", "./crypto-config.yaml", "--output", "crypto-config")
-		cmd.Dir = networkDir
-		output, err := cmd.CombinedOutput()
+		config := newCryptoConfig(network)
+		err := cryptogen.Generate(&config, workDir+"/crypto-config")
 
-		r.Log.Info("cryptogen completed", "err", err, "output", string(output))
+		r.Log.Info("Creating certificates completed", "err", err)
+		recordToolInvocation("cryptogen", err)
 		if err != nil {
-			return err
+			r.Recorder.Eventf(network, corev1.EventTypeWarning, "CryptogenFailed", "Creating certificates failed: %v", err)
+			return nil, err
 		}
+		r.Recorder.Event(network, corev1.EventTypeNormal, "CertificatesCreated", "Created certificates")
 
-		if err = r.storeCryptoConfig(ctx, network); err != nil {
-			return err
+		if artifacts.cryptoConfig, err = r.storeCryptoConfig(ctx, network, workDir+"/crypto-config"); err != nil {
+			return nil, err
 		}
 	}
 
 	if network.Spec.Genesis.Secret != "" {
 		r.Log.Info("Genesis.Secret is provided, skipping genesis block creation", "secret", network.Spec.Genesis.Secret)
-	} else if !isFreshInstall {
-		r.Log.Info("This is not fresh installation but reconstruction. Downloading genesis block from secret", "secret", genesisSecret)
+		return artifacts, nil
+	}
 
-		secret := &corev1.Secret{}
-		err := r.Get(ctx, types.NamespacedName{Namespace: network.Namespace, Name: genesisSecret}, secret)
-		if err != nil {
-			return err
-		}
+	configtx, err := r.getConfigtx(ctx, network)
+	if err != nil {
+		return nil, err
+	}
 
-		file := networkDir + "/channel-artifacts/genesis.block"
-		if err := ioutil.WriteFile(file, secret.Data["genesis.block"], 0644); err != nil {
-			return err
-		}
-		r.Log.Info("Downloaded genesis block and wrote to file", "secret", genesisSecret, "file", file)
+	r.Log.Info("Creating genesis block", "network", network.Name)
+	artifacts.genesisBlock, err = configtxgen.GenesisBlock(configtx, workDir, network.Spec.Network.GenesisProfile, network.Spec.Network.SystemChannelID)
 
-	} else {
-		r.Log.Info("Creating genesis block", "network", network.Name)
-		// configtxgen -profile $genesisProfile -channelID $systemChannelID -outputBlock ./channel-artifacts/genesis.block
-		cmd := exec.CommandContext(ctx, "configtxgen", "-profile", network.Spec.Network.GenesisProfile,
-			"-channelID", network.Spec.Network.SystemChannelID, "-outputBlock", "./channel-artifacts/genesis.block")
-		cmd.Dir = networkDir
-		output, err := cmd.CombinedOutput()
-
-		r.Log.Info("configtxgen completed", "err", err, "output", string(output))
-		if err != nil {
-			return err
+	r.Log.Info("Creating genesis block completed", "err", err)
+	recordToolInvocation("configtxgen", err)
+	if err != nil {
+		r.Recorder.Eventf(network, corev1.EventTypeWarning, "ConfigtxgenFailed", "Creating genesis block failed: %v", err)
+		r.saveConfigtxError(ctx, network, field.NewPath("spec", "network", "genesisProfile"), err)
+		return nil, err
+	}
+	r.Recorder.Eventf(network, corev1.EventTypeNormal, "GenesisBlockCreated", "Created genesis block using profile %v", network.Spec.Network.GenesisProfile)
+
+	// channel-flow creates the channels with the profiles named after them, fail early if they are broken
+	for i, channel := range network.Spec.Network.Channels {
+		if _, err := configtxgen.ChannelCreationTx(configtx, workDir, channel.Name, channel.Name); err != nil {
+			r.Recorder.Eventf(network, corev1.EventTypeWarning, "ConfigtxgenFailed", "Creating channel transaction of %v failed: %v", channel.Name, err)
+			r.saveConfigtxError(ctx, network, field.NewPath("spec", "network", "channels").Index(i).Child("name"), err)
+			return nil, err
 		}
 	}
-
-	return nil
+	return artifacts, nil
 }
 
-func (r *FabricNetworkReconciler) extendOrDownloadCertificates(ctx context.Context, network *v1alpha1.FabricNetwork) error {
-	networkDir := getNetworkDir(network)
+// keeps the FabricNetwork in New state with the configtx.yaml error pointing at the profile and organization.
+// creation is retried, since configtx Secret may be fixed without changing the FabricNetwork
+func (r *FabricNetworkReconciler) saveConfigtxError(ctx context.Context, network *v1alpha1.FabricNetwork, path *field.Path, err error) {
+	var configtxErr *configtxgen.Error
+	if !errors.As(err, &configtxErr) {
+		return
+	}
+	r.saveStatus(ctx, network, v1alpha1.FabricNetworkStatus{
+		State:   v1alpha1.StateNew,
+		Message: fmt.Sprintf("configtx.yaml is invalid for profile %v", configtxErr.Profile),
+		ValidationErrors: []v1alpha1.ValidationError{{
+			Field:   path.String(),
+			Message: configtxErr.Error(),
+		}},
+	})
+}
 
-	if network.Spec.CryptoConfig.Secret != "" {
-		r.Log.Info("CryptoConfig.Secret is provided. Downloading certificates from secret", "CryptoConfig.Secret", network.Spec.CryptoConfig.Secret)
+// loads the crypto material and genesis block of an installed FabricNetwork from Secrets
+func (r *FabricNetworkReconciler) loadArtifacts(ctx context.Context, network *v1alpha1.FabricNetwork) (*networkArtifacts, error) {
+	cryptoConfig, err := r.getCryptoConfig(ctx, network)
+	if err != nil {
+		return nil, err
+	}
+	artifacts := &networkArtifacts{cryptoConfig: cryptoConfig}
 
+	if network.Spec.Genesis.Secret == "" {
 		secret := &corev1.Secret{}
-		err := r.Get(ctx, types.NamespacedName{Namespace: network.Namespace, Name: cryptoConfigSecret}, secret)
-		if err != nil {
-			return err
-		}
-
-		folder := networkDir + "/crypto-config"
-		buf := bytes.NewBuffer(secret.Data["crypto-config"])
-		if err := uncompress(buf, folder); err != nil {
-			return err
-		}
-		r.Log.Info("Downloaded and uncompressed certificates from secret", "secret", cryptoConfigSecret, "folder", folder)
-
-	} else {
-		r.Log.Info("Extending certificates", "network", network.Name)
-		// cryptogen extend --config ./crypto-config.yaml --input crypto-config
-		cmd := exec.CommandContext(ctx, "cryptogen", "extend", "--config", "./crypto-config.yaml", "--input", "crypto-config")
-		cmd.Dir = networkDir
-		output, err := cmd.CombinedOutput()
-
-		r.Log.Info("cryptogen completed", "err", err, "output", string(output))
-		if err != nil {
-			return err
+		if err := r.Get(ctx, types.NamespacedName{Namespace: network.Namespace, Name: validation.GenesisSecret}, secret); err != nil {
+			r.Log.Error(err, "Couldnt get genesis secret", "secret", validation.GenesisSecret)
+			return nil, err
 		}
+		artifacts.genesisBlock = secret.Data["genesis.block"]
+	}
+	return artifacts, nil
+}
 
-		if err = r.storeCryptoConfig(ctx, network); err != nil {
-			return err
-		}
+// returns the gzipped crypto-config folder stored in crypto-config Secret
+func (r *FabricNetworkReconciler) getCryptoConfig(ctx context.Context, network *v1alpha1.FabricNetwork) ([]byte, error) {
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: network.Namespace, Name: validation.CryptoConfigSecret(network)}, secret); err != nil {
+		r.Log.Error(err, "Couldnt get crypto-config secret", "secret", validation.CryptoConfigSecret(network))
+		return nil, err
 	}
-	return nil
+	return secret.Data["crypto-config"], nil
 }
 
-func (r *FabricNetworkReconciler) createConfigtxFile(ctx context.Context, network *v1alpha1.FabricNetwork) error {
-	networkDir := getNetworkDir(network)
+func (r *FabricNetworkReconciler) extendOrDownloadCertificates(ctx context.Context, network *v1alpha1.FabricNetwork) error {
+	if network.Spec.CryptoConfig.Secret != "" {
+		// certificates are read from the user provided secret when Helm chart is updated
+		r.Log.Info("CryptoConfig.Secret is provided. Skipping extending certificates", "CryptoConfig.Secret", network.Spec.CryptoConfig.Secret)
+		return nil
+	}
 
-	secret := &corev1.Secret{}
-	if err := r.Get(ctx, types.NamespacedName{Name: network.Spec.Configtx.Secret, Namespace: network.Namespace}, secret); err != nil {
-		r.Log.Error(err, "Couldnt get configtx secret", "configtx", network.Spec.Configtx.Secret)
+	workDir, err := os.MkdirTemp("", "fabric-operator-")
+	if err != nil {
 		return err
 	}
+	defer os.RemoveAll(workDir)
 
-	configtxFile := networkDir + "/configtx.yaml"
-	if err := ioutil.WriteFile(configtxFile, secret.Data["configtx.yaml"], 0644); err != nil {
-		r.Log.Error(err, "Couldnt write configtx to file")
+	cryptoConfig, err := r.getCryptoConfig(ctx, network)
+	if err != nil {
+		return err
+	}
+	if err := uncompress(bytes.NewReader(cryptoConfig), workDir+"/crypto-config"); err != nil {
 		return err
 	}
-	r.Log.Info("Wrote configtx to file", "file", configtxFile)
-	return nil
-}
-
-func (r *FabricNetworkReconciler) createCryptoConfigFile(ctx context.Context, network *v1alpha1.FabricNetwork) error {
-	networkDir := getNetworkDir(network)
 
-	cryptoConfig := newCryptoConfig(network)
-	r.Log.Info("Created cryptoConfig", "cryptoConfig", cryptoConfig)
+	r.Log.Info("Extending certificates", "network", network.Name)
+	config := newCryptoConfig(network)
+	err = cryptogen.Extend(&config, workDir+"/crypto-config")
 
-	file := networkDir + "/crypto-config.yaml"
-	if err := writeYamlToFile(cryptoConfig, file); err != nil {
+	r.Log.Info("Extending certificates completed", "err", err)
+	recordToolInvocation("cryptogen", err)
+	if err != nil {
+		r.Recorder.Eventf(network, corev1.EventTypeWarning, "CryptogenFailed", "Extending certificates failed: %v", err)
 		return err
 	}
-	r.Log.Info("Wrote cryptoConfig to file", "file", file)
+	r.Recorder.Event(network, corev1.EventTypeNormal, "CertificatesExtended", "Extended certificates")
 
-	return nil
+	_, err = r.storeCryptoConfig(ctx, network, workDir+"/crypto-config")
+	return err
 }
 
-func newCryptoConfig(network *v1alpha1.FabricNetwork) cryptoConfig {
-	c := cryptoConfig{}
+func newCryptoConfig(network *v1alpha1.FabricNetwork) cryptogen.Config {
+	c := cryptogen.Config{}
 
-	c.OrdererOrgs = make([]ordererOrg, len(network.Spec.Topology.OrdererOrgs))
+	c.OrdererOrgs = make([]cryptogen.OrdererOrg, len(network.Spec.Topology.OrdererOrgs))
 	for i, o := range network.Spec.Topology.OrdererOrgs {
-		c.OrdererOrgs[i] = ordererOrg{
+		c.OrdererOrgs[i] = cryptogen.OrdererOrg{
 			Name:          o.Name,
 			Domain:        o.Domain,
 			EnableNodeOUs: true,
-			Specs:         make([]host, len(o.Hosts)),
+			Specs:         make([]cryptogen.Host, len(o.Hosts)),
 		}
 		for j, h := range o.Hosts {
-			c.OrdererOrgs[i].Specs[j] = host{Hostname: h}
+			c.OrdererOrgs[i].Specs[j] = cryptogen.Host{Hostname: h}
 		}
 	}
 
-	c.PeerOrgs = make([]peerOrg, len(network.Spec.Topology.PeerOrgs))
+	c.PeerOrgs = make([]cryptogen.PeerOrg, len(network.Spec.Topology.PeerOrgs))
 	for i, p := range network.Spec.Topology.PeerOrgs {
-		c.PeerOrgs[i] = peerOrg{
+		c.PeerOrgs[i] = cryptogen.PeerOrg{
 			Name:          p.Name,
 			Domain:        p.Domain,
 			EnableNodeOUs: true,
-			Template:      count{Count: p.PeerCount},
-			Users:         count{Count: 1},
+			Template:      cryptogen.Count{Count: p.PeerCount},
+			Users:         cryptogen.Count{Count: 1},
 		}
 	}
 
 	return c
 }
 
-func (r *FabricNetworkReconciler) storeCryptoConfig(ctx context.Context, network *v1alpha1.FabricNetwork) error {
-
-	networkDir := getNetworkDir(network)
-
+// compresses the crypto-config folder and stores it in crypto-config Secret, returns the compressed folder
+func (r *FabricNetworkReconciler) storeCryptoConfig(ctx context.Context, network *v1alpha1.FabricNetwork, folder string) ([]byte, error) {
 	var buffer bytes.Buffer
-	if err := compress(networkDir+"/crypto-config", "", &buffer); err != nil {
-		return err
+	if err := compress(folder, "", &buffer); err != nil {
+		return nil, err
 	}
 
 	secret := &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      "hlf-crypto-config",
+			Name:      validation.CryptoConfigSecret(network),
 			Namespace: network.Namespace,
 			Labels: map[string]string{
 				"raft.io/fabric-operator-created-for": network.Name,
@@ -256,20 +237,20 @@ func (r *FabricNetworkReconciler) storeCryptoConfig(ctx context.Context, network
 
 	exists, err := r.secretExists(ctx, secret.Namespace, secret.Name)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if exists {
 		if err := r.Update(ctx, secret); err != nil {
-			return err
+			return nil, err
 		}
 		r.Log.Info("Stored crypto-config in updated secret", "secret", secret.Name)
 	} else {
 		if err := r.Create(ctx, secret); err != nil {
-			return err
+			return nil, err
 		}
 		r.Log.Info("Stored crypto-config in new secret", "secret", secret.Name)
 	}
 
-	return nil
+	return buffer.Bytes(), nil
 }
@@ -2,23 +2,52 @@ package controllers
 
 import (
 	"context"
+	"fmt"
 	"reflect"
+	"strings"
 	"time"
 
 	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
 
 	"github.com/raftAtGit/hl-fabric-operator/api/v1alpha1"
+	"github.com/raftAtGit/hl-fabric-operator/validation"
 )
 
+// requeue interval while waiting for Helm release or workflows, in case a watch event is missed
+const pollInterval = time.Minute
+
+// finalizer to delete Helm release, workflows and optionally PersistentVolumeClaims of a deleted FabricNetwork
+const cleanupFinalizer = "raft.io/fabric-operator-cleanup"
+
 // FabricNetworkReconciler reconciles a FabricNetwork object
 type FabricNetworkReconciler struct {
 	client.Client
-	Log    logr.Logger
-	Scheme *runtime.Scheme
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	// Used to read pod logs of flows, which are not served by the cached client
+	Clientset kubernetes.Interface
+	// Reads the resources of Helm releases from the API server, the cached client would start an informer for each kind
+	APIReader client.Reader
+	// If set, Argo workflows are managed through Argo Server instead of the Kubernetes API
+	ArgoServer *ArgoServerClient
+
+	// Maximum number of FabricNetworks reconciled concurrently. Defaults to 1
+	MaxConcurrentReconciles int
 }
 
 // struct to keep trackof change in FabricNetwork
@@ -32,10 +61,11 @@ type change struct {
 	PeerCountIncrease bool
 	PeerCountDecrease bool
 	Version           bool
+	ChartVersion      bool
 }
 
 func (c change) areThereAnyChanges() bool {
-	return c.Topology || c.Channel || c.Chaincode
+	return c.Topology || c.Channel || c.Chaincode || c.ChartVersion
 }
 
 func (c change) needsCertificateUpdate() bool {
@@ -45,6 +75,7 @@ func (c change) needsCertificateUpdate() bool {
 // +kubebuilder:rbac:groups=hyperledger.org,resources=fabricnetworks,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=hyperledger.org,resources=fabricnetworks/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=hyperledger.org,resources=fabricnetworks/finalizers,verbs=update
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 // for Helm
 // +kubebuilder:rbac:groups="",resources=*,verbs=get;list;watch;create;update;patch;delete
@@ -54,13 +85,30 @@ func (c change) needsCertificateUpdate() bool {
 // for Argo
 // +kubebuilder:rbac:groups=argoproj.io,resources=workflows,verbs=get;list;watch;create;update;patch;delete
 
+// for Jobs flow engine and flow logs
+// +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=pods/log,verbs=get
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *FabricNetworkReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	r.Log.Info("SetupWithManager", "settings", settings)
 
-	return ctrl.NewControllerManagedBy(mgr).
+	b := ctrl.NewControllerManagedBy(mgr).
 		For(&v1alpha1.FabricNetwork{}).
-		Complete(r)
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles})
+	// Workflows can only be watched if Argo is installed, Jobs flow engine does not need it
+	_, err := mgr.GetRESTMapper().RESTMapping(wfv1.SchemeGroupVersion.WithKind("Workflow").GroupKind())
+	if err != nil {
+		r.Log.Info("Argo Workflow CRD not found, not watching workflows", "error", err.Error())
+	}
+	for _, w := range r.watches(err == nil) {
+		opts := []builder.WatchesOption{builder.WithPredicates(w.predicate)}
+		if w.metadataOnly {
+			opts = append(opts, builder.OnlyMetadata)
+		}
+		b = b.Watches(w.object, w.handler, opts...)
+	}
+	return b.Complete(r)
 }
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
@@ -79,14 +127,16 @@ func (r *FabricNetworkReconciler) Reconcile(ctx context.Context, request ctrl.Re
 	err := r.Get(ctx, request.NamespacedName, network)
 	if err != nil {
 		if errors.IsNotFound(err) {
+			// normally resources are deleted by the finalizer, this is for FabricNetworks deleted before the finalizer is added
 			r.Log.Info("FabricNetwork resource not found, deleting resources")
 
 			if err = r.maybeUninstallHelmChart(ctx, request.NamespacedName.Namespace, request.NamespacedName.Name); err != nil {
 				r.Log.Error(err, "Failed to uninstall Helm chart")
 			}
-			if err = r.deleteWorkflows(ctx, request.NamespacedName.Namespace, request.NamespacedName.Name); err != nil {
+			if err = r.deleteFlows(ctx, request.NamespacedName.Namespace, request.NamespacedName.Name); err != nil {
 				r.Log.Error(err, "Failed to delete workflows")
 			}
+			deleteNetworkMetrics(request.NamespacedName.Namespace, request.NamespacedName.Name)
 
 			return ctrl.Result{}, nil
 		}
@@ -95,12 +145,29 @@ func (r *FabricNetworkReconciler) Reconcile(ctx context.Context, request ctrl.Re
 		return ctrl.Result{}, err
 	}
 
+	if !network.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, r.finalize(ctx, network)
+	}
+	if !controllerutil.ContainsFinalizer(network, cleanupFinalizer) {
+		controllerutil.AddFinalizer(network, cleanupFinalizer)
+		if err := r.Update(ctx, network); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	recordStateMetric(network)
+
 	changes := getChanges(network)
 	r.Log.Info("Got the FabricNetwork", "network", network.Name, "state", network.Status.State, "changes", changes)
 
 	if network.Spec.ForceState != "" {
 		r.Log.Info("Setting the state to forced state", "ForceState", network.Spec.ForceState)
 
+		// the running flow would otherwise keep changing the network
+		if err := r.cancelFlow(ctx, network); err != nil {
+			r.Log.Error(err, "Failed to cancel flow")
+		}
+
 		if err := r.saveStatus(ctx, network, v1alpha1.FabricNetworkStatus{
 			State:   network.Spec.ForceState,
 			Message: "State is forced",
@@ -116,9 +183,29 @@ func (r *FabricNetworkReconciler) Reconcile(ctx context.Context, request ctrl.Re
 		return ctrl.Result{Requeue: true}, nil
 	}
 
-	if err := r.maybeReconstructHelmChart(ctx, network); err != nil {
-		r.Log.Error(err, "Reconstructing Helm chart failed")
-		return ctrl.Result{}, err
+	if _, ok := network.Annotations[v1alpha1.ResumeAnnotation]; ok {
+		if err := r.resume(ctx, network); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		delete(network.Annotations, v1alpha1.ResumeAnnotation)
+		if err := r.Update(ctx, network); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		return ctrl.Result{Requeue: true}, nil
+	}
+
+	// garbage collection of old flows should not block the network
+	if err := r.enforceRetention(ctx, network); err != nil {
+		r.Log.Error(err, "Enforcing flow retention failed")
+	}
+
+	if releaseExpected(network.Status.State) {
+		ok, result, err := r.checkHelmRelease(ctx, network)
+		if !ok {
+			return result, err
+		}
 	}
 
 	switch network.Status.State {
@@ -128,25 +215,35 @@ func (r *FabricNetworkReconciler) Reconcile(ctx context.Context, request ctrl.Re
 	case v1alpha1.StateFailed:
 		return ctrl.Result{Requeue: false}, err
 	case v1alpha1.StateInvalid:
-		if err := r.validate(ctx, network); err != nil {
+		valid, err := r.validate(ctx, network)
+		if err != nil {
 			r.Log.Error(err, "Validation failed")
-			return ctrl.Result{Requeue: false}, err
+			return ctrl.Result{}, err
+		}
+		if !valid {
+			// referenced Secrets and ConfigMaps may be created later, so check again
+			return ctrl.Result{RequeueAfter: time.Second * 30}, nil
 		}
 		r.saveStatus(ctx, network, v1alpha1.FabricNetworkStatus{State: ""})
 		return ctrl.Result{}, nil
 
 	case "":
-		if err := r.validate(ctx, network); err != nil {
+		valid, err := r.validate(ctx, network)
+		if err != nil {
 			r.Log.Error(err, "Validation failed")
-			return ctrl.Result{Requeue: false}, err
+			return ctrl.Result{}, err
 		}
-		rejected, err := r.checkOthersInNamespace(ctx, network)
+		if !valid {
+			return ctrl.Result{RequeueAfter: time.Second * 30}, nil
+		}
+		rejected, err := r.checkConflictsInNamespace(ctx, network)
 		if err != nil {
 			return ctrl.Result{}, err
 		}
 		if rejected {
 			return ctrl.Result{}, nil
 		}
+		network.Status.HelmRelease = validation.HelmRelease(network)
 		network.Status.Topology = network.Spec.Topology
 		network.Status.Channels = network.Spec.Network.Channels
 		network.Status.Chaincode = network.Spec.Chaincode
@@ -158,14 +255,15 @@ func (r *FabricNetworkReconciler) Reconcile(ctx context.Context, request ctrl.Re
 			r.Log.Error(err, "Failed to uninstall Helm chart")
 			return ctrl.Result{}, err
 		}
-		if err = r.deleteWorkflows(ctx, request.NamespacedName.Namespace, request.NamespacedName.Name); err != nil {
+		if err = r.deleteFlows(ctx, request.NamespacedName.Namespace, request.NamespacedName.Name); err != nil {
 			r.Log.Error(err, "Failed to delete workflows")
 		}
-		if err := r.prepareHelmChart(ctx, network); err != nil {
-			r.Log.Error(err, "Preparing Helm chart failed")
+		artifacts, err := r.prepareArtifacts(ctx, network)
+		if err != nil {
+			r.Log.Error(err, "Preparing Fabric artifacts failed")
 			return ctrl.Result{}, err
 		}
-		if err := r.installHelmChart(ctx, network); err != nil {
+		if err := r.installHelmChart(ctx, network, artifacts); err != nil {
 			r.Log.Error(err, "Installing Helm chart failed")
 			return ctrl.Result{}, err
 		}
@@ -176,6 +274,10 @@ func (r *FabricNetworkReconciler) Reconcile(ctx context.Context, request ctrl.Re
 		}
 
 	case v1alpha1.StateHelmChartNeedsUpdate:
+		if err := r.labelPVCs(ctx, network); err != nil {
+			r.Log.Error(err, "Labeling PersistentVolumeClaims failed")
+			return ctrl.Result{}, err
+		}
 		if err := r.updateHelmChart(ctx, network); err != nil {
 			r.Log.Error(err, "Updating Helm chart failed")
 			return ctrl.Result{}, err
@@ -183,6 +285,10 @@ func (r *FabricNetworkReconciler) Reconcile(ctx context.Context, request ctrl.Re
 		r.saveStatus(ctx, network, v1alpha1.FabricNetworkStatus{State: v1alpha1.StateHelmChartInstalled})
 
 	case v1alpha1.StateHelmChartNeedsDoubleUpdate:
+		if err := r.labelPVCs(ctx, network); err != nil {
+			r.Log.Error(err, "Labeling PersistentVolumeClaims failed")
+			return ctrl.Result{}, err
+		}
 		if err := r.updateHelmChart(ctx, network); err != nil {
 			r.Log.Error(err, "Updating Helm chart failed")
 			return ctrl.Result{}, err
@@ -196,17 +302,29 @@ func (r *FabricNetworkReconciler) Reconcile(ctx context.Context, request ctrl.Re
 		r.saveStatus(ctx, network, v1alpha1.FabricNetworkStatus{State: v1alpha1.StateHelmChartInstalled})
 
 	case v1alpha1.StateHelmChartInstalled:
-		ready, err := r.isHelmChartReady(ctx, network)
+		components, err := r.getHelmChartComponents(ctx, network)
 		if err != nil {
 			// TODO if error is not found, maybe re-install helm chart?
 			r.Log.Error(err, "Get Helm chart status failed")
 			return ctrl.Result{}, err
 		}
-		if ready {
+		changed := !equality.Semantic.DeepEqual(network.Status.Components, components)
+		network.Status.Components = components
+		if componentsReady(components) {
+			if err := r.syncPVCs(ctx, network); err != nil {
+				r.Log.Error(err, "Syncing PersistentVolumeClaims failed")
+				return ctrl.Result{}, err
+			}
 			r.saveStatus(ctx, network, v1alpha1.FabricNetworkStatus{State: v1alpha1.StateHelmChartReady})
 		} else {
-			// reconcile until ready
-			return ctrl.Result{RequeueAfter: time.Second * 10}, nil
+			if changed {
+				message := "Waiting for " + strings.Join(notReadyComponents(components), "; ")
+				if err := r.saveStatus(ctx, network, v1alpha1.FabricNetworkStatus{State: network.Status.State, Message: message}); err != nil {
+					return ctrl.Result{}, err
+				}
+			}
+			// StatefulSets and Deployments are watched, this is only a fallback
+			return ctrl.Result{RequeueAfter: pollInterval}, nil
 		}
 
 	case v1alpha1.StateHelmChartReady:
@@ -254,7 +372,7 @@ func (r *FabricNetworkReconciler) Reconcile(ctx context.Context, request ctrl.Re
 		}
 
 	case v1alpha1.StateChannelFlowSubmitted:
-		status, err := r.getWorkflowStatus(ctx, network, network.Status.Workflow)
+		status, wfMessage, err := r.getFlowStatus(ctx, network)
 		if err != nil {
 			r.Log.Error(err, "Failed to get workflow status")
 			return ctrl.Result{}, err
@@ -264,11 +382,10 @@ func (r *FabricNetworkReconciler) Reconcile(ctx context.Context, request ctrl.Re
 		case wfCompleted:
 			r.saveStatus(ctx, network, v1alpha1.FabricNetworkStatus{State: v1alpha1.StateChannelFlowCompleted})
 		case wfFailed:
-			r.saveStatus(ctx, network, v1alpha1.FabricNetworkStatus{State: v1alpha1.StateFailed, Message: "channel-flow failed"})
-			return ctrl.Result{Requeue: false}, nil
+			return r.handleFailedFlow(ctx, network, failureReason("channel-flow", network.Status.Workflow, wfMessage))
 		case wfSubmitted:
-			// reconcile until completed or failed
-			return ctrl.Result{RequeueAfter: time.Second * 10}, nil
+			// workflows are watched, this is only a fallback
+			return ctrl.Result{RequeueAfter: pollInterval}, nil
 		}
 
 	case v1alpha1.StateChannelFlowCompleted:
@@ -285,7 +402,7 @@ func (r *FabricNetworkReconciler) Reconcile(ctx context.Context, request ctrl.Re
 		})
 
 	case v1alpha1.StateChaincodeFlowSubmitted:
-		status, err := r.getWorkflowStatus(ctx, network, network.Status.Workflow)
+		status, wfMessage, err := r.getFlowStatus(ctx, network)
 		if err != nil {
 			r.Log.Error(err, "Failed to get workflow status")
 			return ctrl.Result{}, err
@@ -295,11 +412,10 @@ func (r *FabricNetworkReconciler) Reconcile(ctx context.Context, request ctrl.Re
 		case wfCompleted:
 			r.saveStatus(ctx, network, v1alpha1.FabricNetworkStatus{State: v1alpha1.StateChaincodeFlowCompleted})
 		case wfFailed:
-			r.saveStatus(ctx, network, v1alpha1.FabricNetworkStatus{State: v1alpha1.StateFailed, Message: "chaincode-flow failed"})
-			return ctrl.Result{Requeue: false}, nil
+			return r.handleFailedFlow(ctx, network, failureReason("chaincode-flow", network.Status.Workflow, wfMessage))
 		case wfSubmitted:
-			// reconcile until completed or failed
-			return ctrl.Result{RequeueAfter: time.Second * 10}, nil
+			// workflows are watched, this is only a fallback
+			return ctrl.Result{RequeueAfter: pollInterval}, nil
 		}
 
 	case v1alpha1.StateChaincodeFlowCompleted:
@@ -307,7 +423,7 @@ func (r *FabricNetworkReconciler) Reconcile(ctx context.Context, request ctrl.Re
 		return ctrl.Result{Requeue: false}, nil
 
 	case v1alpha1.StatePeerOrgFlowSubmitted:
-		status, err := r.getWorkflowStatus(ctx, network, network.Status.Workflow)
+		status, wfMessage, err := r.getFlowStatus(ctx, network)
 		if err != nil {
 			r.Log.Error(err, "Failed to get workflow status")
 			return ctrl.Result{}, err
@@ -317,11 +433,10 @@ func (r *FabricNetworkReconciler) Reconcile(ctx context.Context, request ctrl.Re
 		case wfCompleted:
 			r.saveStatus(ctx, network, v1alpha1.FabricNetworkStatus{State: v1alpha1.StatePeerOrgFlowCompleted})
 		case wfFailed:
-			r.saveStatus(ctx, network, v1alpha1.FabricNetworkStatus{State: v1alpha1.StateFailed, Message: "peer-org-flow failed"})
-			return ctrl.Result{Requeue: false}, nil
+			return r.handleFailedFlow(ctx, network, failureReason("peer-org-flow", network.Status.Workflow, wfMessage))
 		case wfSubmitted:
-			// reconcile until completed or failed
-			return ctrl.Result{RequeueAfter: time.Second * 10}, nil
+			// workflows are watched, this is only a fallback
+			return ctrl.Result{RequeueAfter: pollInterval}, nil
 		}
 
 	case v1alpha1.StatePeerOrgFlowCompleted:
@@ -337,17 +452,19 @@ func (r *FabricNetworkReconciler) Reconcile(ctx context.Context, request ctrl.Re
 			Workflow: wfName,
 		})
 
+	case v1alpha1.StateDegraded:
+		// spec changes are processed after FabricNetwork recovers
+		return r.monitorHealth(ctx, network)
+
 	case v1alpha1.StateReady:
-		if changes.areThereAnyChanges() {
-			r.Log.Info("There are changes in FabricNetwork, will recreate values files", "changes", changes)
-			if err := r.createValuesFiles(ctx, network); err != nil {
-				return ctrl.Result{}, err
-			}
-			network.Status.Topology = network.Spec.Topology
-			network.Status.Channels = network.Spec.Network.Channels
-			network.Status.Chaincode = network.Spec.Chaincode
-			network.Status.Chaincodes = network.Spec.Network.Chaincodes
+		if !changes.areThereAnyChanges() {
+			return r.monitorHealth(ctx, network)
 		}
+		r.Log.Info("There are changes in FabricNetwork", "changes", changes)
+		network.Status.Topology = network.Spec.Topology
+		network.Status.Channels = network.Spec.Network.Channels
+		network.Status.Chaincode = network.Spec.Chaincode
+		network.Status.Chaincodes = network.Spec.Network.Chaincodes
 		if changes.Topology {
 			if changes.needsCertificateUpdate() {
 				r.Log.Info("Will download or extend certificates")
@@ -395,9 +512,6 @@ func (r *FabricNetworkReconciler) Reconcile(ctx context.Context, request ctrl.Re
 		if changes.Channel {
 			r.Log.Info("Channels changed, will run channel-flow", "include", changes.Chaincodes)
 
-			if err := r.createNetworkValuesFile(ctx, network); err != nil {
-				return ctrl.Result{}, err
-			}
 			wfName, err := r.startChannelFlow(ctx, network)
 			if err != nil {
 				r.Log.Error(err, "Starting channel-flow failed")
@@ -415,9 +529,6 @@ func (r *FabricNetworkReconciler) Reconcile(ctx context.Context, request ctrl.Re
 		if changes.Chaincode {
 			r.Log.Info("Chaincodes changed, will run chaincode-flow", "include", changes.Chaincodes)
 
-			if err := r.createNetworkValuesFile(ctx, network); err != nil {
-				return ctrl.Result{}, err
-			}
 			wfName, err := r.startChaincodeFlow(ctx, network, changes.Chaincodes)
 			if err != nil {
 				r.Log.Error(err, "Starting chaincode-flow failed")
@@ -425,12 +536,23 @@ func (r *FabricNetworkReconciler) Reconcile(ctx context.Context, request ctrl.Re
 			}
 			r.Log.Info("Started chaincode-flow", "name", wfName)
 
+			network.Status.ChaincodeFlowIncludes = changes.Chaincodes
+
 			r.saveStatus(ctx, network, v1alpha1.FabricNetworkStatus{
 				State:    v1alpha1.StateChaincodeFlowSubmitted,
 				Workflow: wfName,
 			})
 			return ctrl.Result{}, nil
 		}
+
+		if changes.ChartVersion {
+			r.Log.Info("Chart version changed. Will update Helm chart. Setting NextFlow to None", "from", network.Status.ChartVersion, "to", network.Spec.Charts.Version)
+			network.Status.NextFlow = v1alpha1.NextFlowNone
+			if err := r.saveStatus(ctx, network, v1alpha1.FabricNetworkStatus{State: v1alpha1.StateHelmChartNeedsUpdate}); err != nil {
+				return ctrl.Result{}, err
+			}
+			return ctrl.Result{}, nil
+		}
 	default:
 		r.Log.Error(nil, "Unknown state", "state", network.Status.State)
 	}
@@ -438,7 +560,49 @@ func (r *FabricNetworkReconciler) Reconcile(ctx context.Context, request ctrl.Re
 	return ctrl.Result{Requeue: false}, nil
 }
 
-func (r *FabricNetworkReconciler) checkOthersInNamespace(ctx context.Context, network *v1alpha1.FabricNetwork) (bool, error) {
+// deletes the resources of the FabricNetwork and removes the finalizer
+func (r *FabricNetworkReconciler) finalize(ctx context.Context, network *v1alpha1.FabricNetwork) error {
+	if !controllerutil.ContainsFinalizer(network, cleanupFinalizer) {
+		return nil
+	}
+	r.Log.Info("FabricNetwork is being deleted, deleting resources", "deletionPolicy", network.Spec.DeletionPolicy)
+
+	if network.Spec.DeletionPolicy == v1alpha1.DeletionPolicyDelete {
+		// find PersistentVolumeClaims before StatefulSets are uninstalled.
+		// claims in use are removed by Kubernetes once their pods are gone
+		templates, err := r.getClaimTemplates(ctx, network)
+		if err != nil {
+			return err
+		}
+		pvcs, err := r.getNetworkPVCs(ctx, network, templates)
+		if err != nil {
+			return err
+		}
+		if err := r.deletePVCs(ctx, pvcs); err != nil {
+			return err
+		}
+	}
+	if err := r.maybeUninstallHelmChart(ctx, network.Namespace, network.Name); err != nil {
+		r.Log.Error(err, "Failed to uninstall Helm chart")
+		return err
+	}
+	if err := r.deleteFlows(ctx, network.Namespace, network.Name); err != nil {
+		r.Log.Error(err, "Failed to delete workflows")
+		return err
+	}
+	deleteNetworkMetrics(network.Namespace, network.Name)
+
+	controllerutil.RemoveFinalizer(network, cleanupFinalizer)
+	if err := r.Update(ctx, network); err != nil {
+		return err
+	}
+	r.Log.Info("Deleted resources and removed finalizer")
+	return nil
+}
+
+// rejects the FabricNetwork if it conflicts with other FabricNetworks in the namespace.
+// returns true if the FabricNetwork is rejected
+func (r *FabricNetworkReconciler) checkConflictsInNamespace(ctx context.Context, network *v1alpha1.FabricNetwork) (bool, error) {
 	networkList := &v1alpha1.FabricNetworkList{}
 	opts := []client.ListOption{
 		client.InNamespace(network.Namespace),
@@ -450,52 +614,131 @@ func (r *FabricNetworkReconciler) checkOthersInNamespace(ctx context.Context, ne
 	}
 	r.Log.Info("Got FabricNetworkList", "size", len(networkList.Items))
 
-	if len(networkList.Items) == 1 {
+	allErrs := validation.ValidateNoConflicts(network, networkList.Items)
+	if len(allErrs) == 0 {
 		return false, nil
 	}
 
-	allNew := true
-	for _, n := range networkList.Items {
-		if n.Status.State != "" {
-			allNew = false
-			break
-		}
+	r.Log.Info("Rejecting FabricNetwork since it conflicts with other FabricNetworks in the namespace", "errors", allErrs.ToAggregate().Error())
+	if err := r.saveStatus(ctx, network, v1alpha1.FabricNetworkStatus{
+		State:            v1alpha1.StateRejected,
+		Message:          "FabricNetwork conflicts with other FabricNetworks in the namespace",
+		ValidationErrors: toValidationErrors(allErrs),
+	}); err != nil {
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+// validates the FabricNetwork and sets the state to Invalid with the list of errors if it's not valid.
+// returns true if the FabricNetwork is valid
+func (r *FabricNetworkReconciler) validate(ctx context.Context, network *v1alpha1.FabricNetwork) (bool, error) {
+	allErrs := validation.ValidateSpec(network)
+	allErrs = append(allErrs, validation.ValidateNoLocalReferences(network)...)
+
+	refErrs, err := validation.ValidateReferences(ctx, r.Client, network.Namespace, network)
+	if err != nil {
+		return false, err
+	}
+	allErrs = append(allErrs, refErrs...)
+
+	if len(allErrs) == 0 {
+		return true, nil
 	}
-	if allNew {
-		r.Log.Info("All FabricNetworks are new, not rejecting this one")
+	r.Log.Info("FabricNetwork is invalid", "errors", allErrs.ToAggregate().Error())
+
+	validationErrors := toValidationErrors(allErrs)
+
+	if network.Status.State == v1alpha1.StateInvalid && reflect.DeepEqual(network.Status.ValidationErrors, validationErrors) {
+		// nothing changed, dont update status
 		return false, nil
 	}
 
-	r.Log.Info("Rejecting FabricNetwork since there is more than one in the namespace")
 	if err := r.saveStatus(ctx, network, v1alpha1.FabricNetworkStatus{
-		State:   v1alpha1.StateRejected,
-		Message: "More than one FabricNetwork per namespace is not allowed",
+		State:            v1alpha1.StateInvalid,
+		Message:          fmt.Sprintf("FabricNetwork is invalid, found %d error(s)", len(validationErrors)),
+		ValidationErrors: validationErrors,
 	}); err != nil {
-
 		return false, err
 	}
-
-	// TODO write to events
-	return true, nil
+	return false, nil
 }
 
-func (r *FabricNetworkReconciler) validate(ctx context.Context, network *v1alpha1.FabricNetwork) error {
-	// TODO
-	return nil
+func toValidationErrors(allErrs field.ErrorList) []v1alpha1.ValidationError {
+	validationErrors := make([]v1alpha1.ValidationError, len(allErrs))
+	for i, e := range allErrs {
+		validationErrors[i] = v1alpha1.ValidationError{
+			Field:   e.Field,
+			Message: e.ErrorBody(),
+		}
+	}
+	return validationErrors
 }
 
 func (r *FabricNetworkReconciler) saveStatus(ctx context.Context, network *v1alpha1.FabricNetwork, status v1alpha1.FabricNetworkStatus) error {
+	previous := network.Status.State
+	previousWorkflow := network.Status.Workflow
+
 	network.Status.State = status.State
 	network.Status.Message = status.Message
 	network.Status.Workflow = status.Workflow
+	if status.Workflow == "" {
+		network.Status.FlowEngine = ""
+	}
+	network.Status.ValidationErrors = status.ValidationErrors
+	network.Status.ObservedGeneration = network.Generation
+
+	resetFlowRetry(network)
+	setConditions(network, previous)
+	if status.State != previous {
+		setPhaseTimestamp(network)
+	}
 
 	if err := r.Status().Update(ctx, network); err != nil {
 		r.Log.Error(err, "Unable to update FabricNetwork status")
 		return err
 	}
+
+	if status.State != previous {
+		r.recordTransition(network, previous, previousWorkflow)
+		recordTransitionMetrics(network, previous)
+	}
 	return nil
 }
 
+// emits an event for the state transition of FabricNetwork
+func (r *FabricNetworkReconciler) recordTransition(network *v1alpha1.FabricNetwork, previous v1alpha1.State, previousWorkflow string) {
+	state := network.Status.State
+	if state == "" {
+		return
+	}
+	if previous == "" {
+		previous = "None"
+	}
+
+	message := fmt.Sprintf("State changed from %v to %v", previous, state)
+	if network.Status.Workflow != "" {
+		message += ", workflow: " + network.Status.Workflow
+	} else if previousWorkflow != "" {
+		message += ", workflow: " + previousWorkflow
+	}
+	if network.Status.Message != "" {
+		message += ". " + network.Status.Message
+	}
+	for _, e := range network.Status.ValidationErrors {
+		message += fmt.Sprintf("; %v: %v", e.Field, e.Message)
+	}
+
+	eventType := corev1.EventTypeNormal
+	switch state {
+	case v1alpha1.StateFailed, v1alpha1.StateRejected, v1alpha1.StateInvalid, v1alpha1.StateDegraded:
+		eventType = corev1.EventTypeWarning
+	}
+	r.Recorder.Event(network, eventType, string(state), message)
+}
+
 func getChanges(network *v1alpha1.FabricNetwork) change {
 
 	ccSpecChanged := !reflect.DeepEqual(network.Spec.Chaincode, network.Status.Chaincode)
@@ -504,7 +747,8 @@ func getChanges(network *v1alpha1.FabricNetwork) change {
 		Topology: !reflect.DeepEqual(network.Spec.Topology, network.Status.Topology),
 		Channel:  !reflect.DeepEqual(network.Spec.Network.Channels, network.Status.Channels),
 		// TODO we also need to check if any peer count is increased
-		Chaincode: ccSpecChanged || !reflect.DeepEqual(network.Spec.Network.Chaincodes, network.Status.Chaincodes),
+		Chaincode:    ccSpecChanged || !reflect.DeepEqual(network.Spec.Network.Chaincodes, network.Status.Chaincodes),
+		ChartVersion: network.Spec.Charts.Version != "" && network.Spec.Charts.Version != network.Status.ChartVersion,
 	}
 
 	// if global chaincode spec changed or number of chaincoded changed, we will run chaincode-flow for all of them
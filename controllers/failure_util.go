@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"github.com/raftAtGit/hl-fabric-operator/api/v1alpha1"
+)
+
+const (
+	// annotation of failed flow logs ConfigMap, name of the flow the logs belong to
+	failedFlowAnnotation = "raft.io/fabric-operator-failed-flow"
+	// number of log lines of the failed step kept in status
+	failedStepLogLines = 20
+	// maximum size of the log tail in status
+	maxLogTailBytes = 4 * 1024
+	// maximum size of the logs of a step in failed flow logs ConfigMap, older lines are dropped
+	maxStepLogBytes = 128 * 1024
+	// maximum size of all logs in failed flow logs ConfigMap, keeps it below the 1MiB limit.
+	// logs of the failed step are stored first, logs of other steps are stored while they fit
+	maxFlowLogsBytes = 768 * 1024
+	// number of log lines read from each pod. API server applies the tail before the byte limit,
+	// so the end of long logs is read
+	maxStepLogLines = 2000
+)
+
+// characters not allowed in ConfigMap keys
+var invalidConfigMapKeyChars = regexp.MustCompile(`[^-._a-zA-Z0-9]+`)
+
+// returns the name of the ConfigMap the logs of the last failed flow of the FabricNetwork are stored in
+func failedFlowLogsConfigMap(network *v1alpha1.FabricNetwork) string {
+	return network.Name + "-failed-flow-logs"
+}
+
+// returns the failed step of the flow in status with the tail of its logs, nil if the flow engine reports no failed step.
+// logs of the steps are stored in a ConfigMap, so they are kept after the flow is deleted.
+// failing to read or store the logs is not an error, the step is returned without them
+func (r *FabricNetworkReconciler) captureFailedStep(ctx context.Context, network *v1alpha1.FabricNetwork) (*v1alpha1.FailedStep, error) {
+	engine := r.flowEngine(network.Status.FlowEngine)
+	wfName := network.Status.Workflow
+
+	step, err := engine.FailedStep(ctx, network.Namespace, wfName)
+	if err != nil || step == nil {
+		return nil, err
+	}
+	logs, err := engine.Logs(ctx, network.Namespace, wfName)
+	if err != nil {
+		r.Log.Info("Failed to get logs of failed flow", "flow", wfName, "error", err.Error())
+		return step, nil
+	}
+	step.LogTail = logTail(logs[step.Name], failedStepLogLines, maxLogTailBytes)
+	if len(logs) == 0 {
+		return step, nil
+	}
+	if err := r.storeFlowLogs(ctx, network, wfName, flowLogsData(logs, step.Name)); err != nil {
+		r.Log.Error(err, "Failed to store logs of failed flow", "flow", wfName)
+		return step, nil
+	}
+	step.LogsConfigMap = failedFlowLogsConfigMap(network)
+	return step, nil
+}
+
+// returns the logs of the flow by ConfigMap key, at most maxStepLogBytes per step and maxFlowLogsBytes in total.
+// logs of the failed step are always kept, logs of other steps are added in name order while they fit
+func flowLogsData(logs map[string]string, failedStep string) map[string]string {
+	steps := make([]string, 0, len(logs))
+	for step := range logs {
+		if step != failedStep {
+			steps = append(steps, step)
+		}
+	}
+	sort.Strings(steps)
+	if _, ok := logs[failedStep]; ok {
+		steps = append([]string{failedStep}, steps...)
+	}
+
+	data := map[string]string{}
+	size := 0
+	for _, step := range steps {
+		key := strings.Trim(invalidConfigMapKeyChars.ReplaceAllString(step, "_"), "_")
+		log := logTail(logs[step], -1, maxStepLogBytes)
+		if step != failedStep && size+len(key)+len(log) > maxFlowLogsBytes {
+			continue
+		}
+		data[key] += log
+		size += len(key) + len(log)
+	}
+	return data
+}
+
+// stores the logs in failed flow logs ConfigMap, replacing the logs of the previous failed flow.
+// ConfigMap is read with APIReader, so no ConfigMap informer is started
+func (r *FabricNetworkReconciler) storeFlowLogs(ctx context.Context, network *v1alpha1.FabricNetwork, wfName string, data map[string]string) error {
+	configMap := &corev1.ConfigMap{}
+	err := r.APIReader.Get(ctx, types.NamespacedName{Namespace: network.Namespace, Name: failedFlowLogsConfigMap(network)}, configMap)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	exists := err == nil
+	configMap.Name = failedFlowLogsConfigMap(network)
+	configMap.Namespace = network.Namespace
+	configMap.Labels = map[string]string{"raft.io/fabric-operator-created-for": network.Name}
+	configMap.Annotations = map[string]string{failedFlowAnnotation: wfName}
+	configMap.Data = data
+	// set owner to FabricNetwork, so when network is deleted ConfigMap is also deleted
+	if err := ctrl.SetControllerReference(network, configMap, r.Scheme); err != nil {
+		return err
+	}
+	if exists {
+		err = r.Update(ctx, configMap)
+	} else {
+		err = r.Create(ctx, configMap)
+	}
+	if err != nil {
+		return err
+	}
+	r.Log.Info("Stored logs of failed flow", "flow", wfName, "configMap", configMap.Name, "steps", len(data))
+	return nil
+}
+
+// returns the last lines of the log, at most maxBytes long. negative lines means no line limit
+func logTail(log string, lines int, maxBytes int) string {
+	log = strings.TrimRight(log, "\n")
+	if lines >= 0 {
+		all := strings.Split(log, "\n")
+		if len(all) > lines {
+			log = strings.Join(all[len(all)-lines:], "\n")
+		}
+	}
+	if cut := len(log) - maxBytes; cut > 0 {
+		partial := log[cut-1] != '\n'
+		log = log[cut:]
+		if i := strings.Index(log, "\n"); partial && i >= 0 {
+			log = log[i+1:]
+		}
+	}
+	return log
+}
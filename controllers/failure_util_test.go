@@ -0,0 +1,186 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+
+	"github.com/raftAtGit/hl-fabric-operator/api/v1alpha1"
+)
+
+func TestLogTail(t *testing.T) {
+	tests := []struct {
+		log      string
+		lines    int
+		maxBytes int
+		tail     string
+	}{
+		{"a\nb\nc\n", 2, 100, "b\nc"},
+		{"a\nb\nc", 5, 100, "a\nb\nc"},
+		{"a\nb\nc", -1, 100, "a\nb\nc"},
+		// partial line is dropped
+		{"aaaa\nbb\ncc", -1, 6, "bb\ncc"},
+		{"aaaa\nbb\ncc", -1, 5, "bb\ncc"},
+		{"aaaa\nbb\ncc", -1, 4, "cc"},
+		{"", 3, 100, ""},
+	}
+	for _, test := range tests {
+		if tail := logTail(test.log, test.lines, test.maxBytes); tail != test.tail {
+			t.Errorf("tail of %q is %q, expected %q", test.log, tail, test.tail)
+		}
+	}
+}
+
+func TestFlowLogsData(t *testing.T) {
+	line := strings.Repeat("x", 1023) + "\n"
+	// 7 steps with maxStepLogBytes logs each do not fit into maxFlowLogsBytes
+	logs := map[string]string{}
+	for i := 0; i < 7; i++ {
+		logs[fmt.Sprintf("step-%d", i)] = strings.Repeat(line, 200)
+	}
+	logs["z-failed(0)"] = "error\n"
+
+	data := flowLogsData(logs, "z-failed(0)")
+	if data["z-failed_0"] != "error" {
+		t.Errorf("logs of failed step are %q", data["z-failed_0"])
+	}
+	size := 0
+	for key, log := range data {
+		if len(log) > maxStepLogBytes {
+			t.Errorf("logs of %v are %d bytes", key, len(log))
+		}
+		size += len(key) + len(log)
+	}
+	if size > maxFlowLogsBytes {
+		t.Errorf("logs are %d bytes, expected at most %d", size, maxFlowLogsBytes)
+	}
+	// steps are added in name order while they fit
+	if _, ok := data["step-0"]; !ok || len(data) != 6 {
+		t.Errorf("stored steps are %v", len(data))
+	}
+	if _, ok := data["step-6"]; ok {
+		t.Errorf("logs of step-6 do not fit")
+	}
+}
+
+func TestCaptureFailedStepWithJobs(t *testing.T) {
+	ctx := context.Background()
+	network := &v1alpha1.FabricNetwork{
+		ObjectMeta: metav1.ObjectMeta{Name: "simple", Namespace: "failure-test"},
+		Spec:       v1alpha1.FabricNetworkSpec{FlowEngine: v1alpha1.FlowEngineJobs},
+	}
+	r := testReconciler(t, network)
+
+	name, err := r.startFlow(ctx, network, "channel-flow", renderTestFlow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	network.Status.State = v1alpha1.StateChannelFlowSubmitted
+	network.Status.Workflow = name
+	finishStage(t, r, name, "0", batchv1.JobFailed)
+
+	jobList := &batchv1.JobList{}
+	if err := r.List(ctx, jobList, client.MatchingLabels{flowLabel: name}); err != nil || len(jobList.Items) != 1 {
+		t.Fatalf("expected a single Job, got %v %v", len(jobList.Items), err)
+	}
+	step := jobList.Items[0].Annotations[flowStepAnnotation]
+	// fake clientset returns "fake logs" for all pods
+	clientset := k8sfake.NewSimpleClientset(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:        jobList.Items[0].Name + "-x7k2p",
+		Namespace:   network.Namespace,
+		Labels:      map[string]string{flowLabel: name},
+		Annotations: map[string]string{flowStepAnnotation: step},
+	}})
+	r.Clientset = clientset
+
+	failedStep, err := r.captureFailedStep(ctx, network)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// only the end of logs is read
+	logReads := 0
+	for _, action := range clientset.Actions() {
+		if action.GetSubresource() != "log" {
+			continue
+		}
+		logReads++
+		options, ok := action.(k8stesting.GenericAction).GetValue().(*corev1.PodLogOptions)
+		if !ok || options.LimitBytes == nil || *options.LimitBytes != maxStepLogBytes || options.TailLines == nil || *options.TailLines != maxStepLogLines {
+			t.Errorf("unexpected pod log options %+v", options)
+		}
+	}
+	if logReads != 1 {
+		t.Errorf("logs are read %d times, expected once", logReads)
+	}
+	expected := v1alpha1.FailedStep{
+		Name:          step,
+		Template:      "create-channel",
+		Message:       "BackoffLimitExceeded",
+		LogTail:       "fake logs",
+		LogsConfigMap: "simple-failed-flow-logs",
+	}
+	if failedStep == nil || *failedStep != expected {
+		t.Fatalf("failed step is %+v, expected %+v", failedStep, expected)
+	}
+
+	configMap := &corev1.ConfigMap{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: network.Namespace, Name: failedStep.LogsConfigMap}, configMap); err != nil {
+		t.Fatal(err)
+	}
+	if len(configMap.Data) != 1 || configMap.Annotations[failedFlowAnnotation] != name {
+		t.Errorf("unexpected logs ConfigMap %v %v", configMap.Annotations, configMap.Data)
+	}
+	for key, log := range configMap.Data {
+		if strings.ContainsAny(key, "()[]") || log != "fake logs" {
+			t.Errorf("unexpected logs %q: %q", key, log)
+		}
+	}
+	// logs ConfigMap is not a flow
+	flows, err := r.flowEngine(v1alpha1.FlowEngineJobs).List(ctx, network.Namespace, map[string]string{"raft.io/fabric-operator-created-for": network.Name})
+	if err != nil || len(flows) != 1 {
+		t.Errorf("expected a single flow, got %v %v", flows, err)
+	}
+}
+
+func TestArgoFailedStep(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	workflow := &wfv1.Workflow{
+		ObjectMeta: metav1.ObjectMeta{Name: "hlf-channels-x7k2p", Namespace: "failure-test"},
+		Status: wfv1.WorkflowStatus{
+			Phase: wfv1.WorkflowFailed,
+			Nodes: wfv1.Nodes{
+				"retry": {Name: "hlf-channels-x7k2p[0].create-common", Type: wfv1.NodeTypeRetry, Phase: wfv1.NodeFailed,
+					TemplateName: "create-channel", FinishedAt: metav1.NewTime(now.Add(-time.Minute))},
+				"first": {Name: "hlf-channels-x7k2p[0].create-common(0)", Type: wfv1.NodeTypePod, Phase: wfv1.NodeFailed,
+					TemplateName: "create-channel", Message: "Error (exit code 1)", FinishedAt: metav1.NewTime(now.Add(-2 * time.Minute))},
+				"second": {Name: "hlf-channels-x7k2p[0].create-common(1)", Type: wfv1.NodeTypePod, Phase: wfv1.NodeError,
+					TemplateName: "create-channel", Message: "pod deleted", FinishedAt: metav1.NewTime(now.Add(-time.Minute))},
+				"succeeded": {Name: "hlf-channels-x7k2p[0].log", Type: wfv1.NodeTypePod, Phase: wfv1.NodeSucceeded,
+					TemplateName: "log", FinishedAt: metav1.NewTime(now.Add(-3 * time.Minute))},
+			},
+		},
+	}
+	r := testReconciler(t, workflow)
+
+	failedStep, err := r.flowEngine(v1alpha1.FlowEngineArgo).FailedStep(ctx, workflow.Namespace, workflow.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := v1alpha1.FailedStep{Name: "hlf-channels-x7k2p[0].create-common(0)", Template: "create-channel", Message: "Error (exit code 1)"}
+	if failedStep == nil || *failedStep != expected {
+		t.Errorf("failed step is %+v, expected %+v", failedStep, expected)
+	}
+}
@@ -0,0 +1,221 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/raftAtGit/hl-fabric-operator/api/v1alpha1"
+)
+
+const (
+	// label of flows, type of the flow, i.e. channel-flow
+	flowTypeLabel = "raft.io/fabric-operator-flow-type"
+	// label of flows, generation of the FabricNetwork the flow is submitted for
+	flowGenerationLabel = "raft.io/fabric-operator-generation"
+)
+
+type wfStatus string
+
+const (
+	wfSubmitted wfStatus = "Submitted"
+	wfCompleted wfStatus = "Completed"
+	wfFailed    wfStatus = "Failed"
+)
+
+// FlowEngine runs the rendered channel-flow, chaincode-flow and peer-org-flow Argo workflows
+type FlowEngine interface {
+	// submits the rendered workflow manifest with the labels and returns the name of the started flow
+	Submit(ctx context.Context, network *v1alpha1.FabricNetwork, wfManifest string, labels map[string]string) (string, error)
+	// returns the flows in namespace matching the labels
+	List(ctx context.Context, namespace string, labels map[string]string) ([]flowInfo, error)
+	// returns the status of the flow and the message of the flow, if any
+	Status(ctx context.Context, network *v1alpha1.FabricNetwork, name string) (wfStatus, string, error)
+	// stops the flow, it is reported as failed afterwards
+	Cancel(ctx context.Context, network *v1alpha1.FabricNetwork, name string) error
+	// deletes the flow
+	Delete(ctx context.Context, namespace string, name string) error
+	// deletes all flows created for the FabricNetwork
+	DeleteAll(ctx context.Context, namespace string, networkName string) error
+	// returns the logs of the steps of the flow, by step name
+	Logs(ctx context.Context, namespace string, name string) (map[string]string, error)
+	// returns the first failed step of the flow without logs, nil if no step failed
+	FailedStep(ctx context.Context, namespace string, name string) (*v1alpha1.FailedStep, error)
+}
+
+// a flow submitted for a FabricNetwork
+type flowInfo struct {
+	Name string
+	// i.e. channel-flow, empty for flows submitted before flows are labeled with their type
+	Type      string
+	Status    wfStatus
+	CreatedAt time.Time
+	// zero if the flow is not finished
+	FinishedAt time.Time
+}
+
+// all flow engines, FabricNetworks may switch between them
+var flowEngines = []v1alpha1.FlowEngine{v1alpha1.FlowEngineArgo, v1alpha1.FlowEngineJobs}
+
+// returns the flow engine of given type, empty type means Argo
+func (r *FabricNetworkReconciler) flowEngine(engine v1alpha1.FlowEngine) FlowEngine {
+	switch engine {
+	case v1alpha1.FlowEngineJobs:
+		return &jobsEngine{r}
+	default:
+		return &argoEngine{r}
+	}
+}
+
+func (r *FabricNetworkReconciler) startChannelFlow(ctx context.Context, network *v1alpha1.FabricNetwork) (string, error) {
+	return r.startFlow(ctx, network, "channel-flow", func() (string, error) {
+		return r.renderChannelFlow(ctx, network)
+	})
+}
+
+// empty array for includeChaincodes means, all chaincodes
+func (r *FabricNetworkReconciler) startChaincodeFlow(ctx context.Context, network *v1alpha1.FabricNetwork, includeChaincodes []string) (string, error) {
+	return r.startFlow(ctx, network, "chaincode-flow", func() (string, error) {
+		return r.renderChaincodeFlow(ctx, network, includeChaincodes)
+	})
+}
+
+func (r *FabricNetworkReconciler) startPeerOrgFlow(ctx context.Context, network *v1alpha1.FabricNetwork) (string, error) {
+	return r.startFlow(ctx, network, "peer-org-flow", func() (string, error) {
+		return r.renderPeerOrgFlow(ctx, network)
+	})
+}
+
+// submits the flow with the flow engine in spec and records the engine in status.
+// if a flow of the same type is already submitted for this generation of FabricNetwork and did not fail,
+// i.e. operator stopped before saving the status, that flow is adopted instead of submitting a duplicate
+func (r *FabricNetworkReconciler) startFlow(ctx context.Context, network *v1alpha1.FabricNetwork, flow string, render func() (string, error)) (string, error) {
+	engineType := network.Spec.FlowEngine
+	if engineType == "" {
+		engineType = v1alpha1.FlowEngineArgo
+	}
+	engine := r.flowEngine(engineType)
+	labels := map[string]string{
+		"raft.io/fabric-operator-created-for": network.Name,
+		flowTypeLabel:                         flow,
+		flowGenerationLabel:                   strconv.FormatInt(network.Generation, 10),
+	}
+
+	name, err := r.adoptFlow(ctx, network, engine, labels)
+	if err != nil {
+		return "", err
+	}
+	if name != "" {
+		r.Log.Info("Adopted already submitted flow", "flow", flow, "name", name)
+		r.Recorder.Eventf(network, corev1.EventTypeNormal, "FlowAdopted", "Adopted %v %v submitted before for generation %d", flow, name, network.Generation)
+		network.Status.FlowEngine = engineType
+		return name, nil
+	}
+
+	wfManifest, err := render()
+	if err != nil {
+		r.Log.Error(err, "Rendering "+flow+" failed")
+		return "", err
+	}
+	name, err = engine.Submit(ctx, network, wfManifest, labels)
+	if err != nil {
+		return "", err
+	}
+	network.Status.FlowEngine = engineType
+	return name, nil
+}
+
+// returns the name of the flow matching the labels which is running or completed, if any
+func (r *FabricNetworkReconciler) adoptFlow(ctx context.Context, network *v1alpha1.FabricNetwork, engine FlowEngine, labels map[string]string) (string, error) {
+	flows, err := engine.List(ctx, network.Namespace, labels)
+	if err != nil {
+		if meta.IsNoMatchError(err) {
+			return "", nil
+		}
+		r.Log.Error(err, "Failed to find submitted flows")
+		return "", err
+	}
+	sort.Slice(flows, func(i, j int) bool {
+		return flows[i].Name < flows[j].Name
+	})
+	for _, flow := range flows {
+		// failed ones are re-submitted by the retry policy or resume
+		if flow.Status != wfFailed {
+			return flow.Name, nil
+		}
+	}
+	return "", nil
+}
+
+// returns the status of the flow in status, with the flow engine it is submitted with
+func (r *FabricNetworkReconciler) getFlowStatus(ctx context.Context, network *v1alpha1.FabricNetwork) (wfStatus, string, error) {
+	return r.flowEngine(network.Status.FlowEngine).Status(ctx, network, network.Status.Workflow)
+}
+
+// cancels the flow in status, if any
+func (r *FabricNetworkReconciler) cancelFlow(ctx context.Context, network *v1alpha1.FabricNetwork) error {
+	if _, ok := flowsBySubmittedState[network.Status.State]; !ok || network.Status.Workflow == "" {
+		return nil
+	}
+	if err := r.flowEngine(network.Status.FlowEngine).Cancel(ctx, network, network.Status.Workflow); err != nil {
+		return fmt.Errorf("Cancelling flow %v failed: %w", network.Status.Workflow, err)
+	}
+	r.Log.Info("Cancelled flow", "name", network.Status.Workflow)
+	return nil
+}
+
+// deletes the flows of all flow engines created for the FabricNetwork
+func (r *FabricNetworkReconciler) deleteFlows(ctx context.Context, namespace string, name string) error {
+	for _, engine := range flowEngines {
+		if err := r.flowEngine(engine).DeleteAll(ctx, namespace, name); err != nil {
+			// Argo may not be installed if only Jobs are used
+			if meta.IsNoMatchError(err) {
+				continue
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// returns the logs of the container of the pods matching the label selector, by the step name of the pod.
+// logs of several pods of a step, i.e. retries, are concatenated in creation order.
+// at most the last maxStepLogLines lines and maxStepLogBytes bytes of each pod are read
+func (r *FabricNetworkReconciler) podLogs(ctx context.Context, namespace string, selector string, container string, stepName func(*corev1.Pod) string) (map[string]string, error) {
+	if r.Clientset == nil {
+		return nil, fmt.Errorf("No Kubernetes clientset to read pod logs")
+	}
+	pods, err := r.Clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		r.Log.Error(err, "Failed to get PodList")
+		return nil, err
+	}
+	sort.Slice(pods.Items, func(i, j int) bool {
+		return pods.Items[i].CreationTimestamp.Before(&pods.Items[j].CreationTimestamp)
+	})
+
+	tailLines, limitBytes := int64(maxStepLogLines), int64(maxStepLogBytes)
+	logs := map[string]string{}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		options := &corev1.PodLogOptions{Container: container, TailLines: &tailLines, LimitBytes: &limitBytes}
+		data, err := r.Clientset.CoreV1().Pods(namespace).GetLogs(pod.Name, options).DoRaw(ctx)
+		if err != nil {
+			// pod may not be started yet or already be deleted
+			r.Log.Info("Failed to get pod logs", "pod", pod.Name, "error", err.Error())
+			continue
+		}
+		step := stepName(pod)
+		if step == "" {
+			step = pod.Name
+		}
+		logs[step] += string(data)
+	}
+	return logs, nil
+}
@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/raftAtGit/hl-fabric-operator/api/v1alpha1"
+)
+
+func TestFlowAdoption(t *testing.T) {
+	for _, engine := range flowEngines {
+		t.Run(string(engine), func(t *testing.T) {
+			ctx := context.Background()
+			network := &v1alpha1.FabricNetwork{
+				ObjectMeta: metav1.ObjectMeta{Name: "simple", Namespace: "adoption-test", Generation: 3},
+				Spec:       v1alpha1.FabricNetworkSpec{FlowEngine: engine},
+			}
+			r := testReconciler(t, network)
+
+			first, err := r.startFlow(ctx, network, "channel-flow", renderTestFlow)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// operator stopped before saving the status, same flow is started again
+			rendered := false
+			second, err := r.startFlow(ctx, network, "channel-flow", func() (string, error) {
+				rendered = true
+				return testFlow, nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if second != first || rendered {
+				t.Errorf("flow %v is not adopted, submitted %v", first, second)
+			}
+
+			// other flow types and generations are not adopted
+			other, err := r.startFlow(ctx, network, "chaincode-flow", renderTestFlow)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if other == first {
+				t.Errorf("channel-flow %v is adopted as chaincode-flow", first)
+			}
+			network.Generation++
+			next, err := r.startFlow(ctx, network, "channel-flow", renderTestFlow)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if next == first {
+				t.Errorf("channel-flow %v of previous generation is adopted", first)
+			}
+
+			// failed flows are re-submitted
+			network.Status.State = v1alpha1.StateChannelFlowSubmitted
+			network.Status.Workflow = next
+			if err := r.cancelFlow(ctx, network); err != nil {
+				t.Fatal(err)
+			}
+			if engine == v1alpha1.FlowEngineArgo {
+				failTestWorkflow(t, r, network.Namespace, next)
+			}
+			retried, err := r.startFlow(ctx, network, "channel-flow", renderTestFlow)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if retried == next {
+				t.Errorf("failed flow %v is adopted", next)
+			}
+		})
+	}
+}
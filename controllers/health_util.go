@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/releaseutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	"github.com/raftAtGit/hl-fabric-operator/api/v1alpha1"
+	"github.com/raftAtGit/hl-fabric-operator/validation"
+)
+
+// interval of health checks of Ready and Degraded FabricNetworks
+const healthCheckInterval = time.Minute
+
+// checks the health of a Ready or Degraded FabricNetwork and moves it between these two states.
+// flows are not re-run when FabricNetwork recovers
+func (r *FabricNetworkReconciler) monitorHealth(ctx context.Context, network *v1alpha1.FabricNetwork) (ctrl.Result, error) {
+	driftChanged, err := r.checkHelmDrift(ctx, network)
+	if err != nil {
+		r.Log.Error(err, "Drift detection failed")
+		return ctrl.Result{}, err
+	}
+
+	problems, err := r.getHealthProblems(ctx, network)
+	if err != nil {
+		r.Log.Error(err, "Health check failed")
+		return ctrl.Result{}, err
+	}
+
+	if len(problems) == 0 {
+		if network.Status.State == v1alpha1.StateDegraded || driftChanged {
+			r.Log.Info("FabricNetwork is ready", "drift", network.Status.HelmDrift)
+			if err := r.saveStatus(ctx, network, v1alpha1.FabricNetworkStatus{State: v1alpha1.StateReady, Message: "HL Fabric Network is ready"}); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		return ctrl.Result{RequeueAfter: healthCheckInterval}, nil
+	}
+
+	message := "HL Fabric Network is degraded: " + strings.Join(problems, "; ")
+	if network.Status.State != v1alpha1.StateDegraded || network.Status.Message != message || driftChanged {
+		r.Log.Info("FabricNetwork is degraded", "problems", problems)
+		if err := r.saveStatus(ctx, network, v1alpha1.FabricNetworkStatus{State: v1alpha1.StateDegraded, Message: message}); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	return ctrl.Result{RequeueAfter: healthCheckInterval}, nil
+}
+
+// returns the problems of the running FabricNetwork: not ready StatefulSets and Deployments,
+// including crash looping containers, and missing Services of the hlf-kube release
+func (r *FabricNetworkReconciler) getHealthProblems(ctx context.Context, network *v1alpha1.FabricNetwork) ([]string, error) {
+	components, err := r.getHelmChartComponents(ctx, network)
+	if err != nil {
+		return nil, err
+	}
+	network.Status.Components = components
+	problems := notReadyComponents(components)
+
+	serviceProblems, err := r.getServiceProblems(ctx, network)
+	if err != nil {
+		return nil, err
+	}
+	problems = append(problems, serviceProblems...)
+
+	return problems, nil
+}
+
+// returns the Services of the hlf-kube release which are missing
+func (r *FabricNetworkReconciler) getServiceProblems(ctx context.Context, network *v1alpha1.FabricNetwork) ([]string, error) {
+	_, actionConfig, err := r.initHelmClient(network.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	release, err := action.NewGet(actionConfig).Run(validation.HelmRelease(network))
+	if err != nil {
+		r.Log.Error(err, "Failed to get Helm release")
+		return nil, err
+	}
+
+	problems := []string{}
+	for _, manifest := range releaseutil.SplitManifests(release.Manifest) {
+		var object metav1.PartialObjectMetadata
+		if err := yaml.Unmarshal([]byte(manifest), &object); err != nil {
+			return nil, err
+		}
+		if object.Kind != "Service" {
+			continue
+		}
+		service := &corev1.Service{}
+		// read uncached, a cached read would start an informer for Services in all namespaces
+		err := r.APIReader.Get(ctx, types.NamespacedName{Namespace: network.Namespace, Name: object.Name}, service)
+		if client.IgnoreNotFound(err) != nil {
+			return nil, err
+		}
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("Service %v is missing", object.Name))
+		}
+	}
+	return problems, nil
+}
@@ -3,120 +3,41 @@ package controllers
 import (
 	"context"
 	"fmt"
-	"io/ioutil"
-	"os"
-	"strconv"
 	"strings"
+	"sync"
 
 	"helm.sh/helm/v3/pkg/action"
-	hchart "helm.sh/helm/v3/pkg/chart"
-	"helm.sh/helm/v3/pkg/chart/loader"
 	"helm.sh/helm/v3/pkg/cli"
-	"helm.sh/helm/v3/pkg/cli/values"
-	"helm.sh/helm/v3/pkg/getter"
 
-	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
-	"sigs.k8s.io/yaml"
 
 	"github.com/raftAtGit/hl-fabric-operator/api/v1alpha1"
+	"github.com/raftAtGit/hl-fabric-operator/validation"
 )
 
-// Struct to write the values passed to Helm chart to a file
+// values passed to Helm charts by the operator
 type helmValues struct {
 	HostAliases []corev1.HostAlias `json:"hostAliases,omitempty"`
 }
 
-// Struct to write the Network to a file
+// Network values passed to Helm charts
 type networkContainer struct {
 	Network v1alpha1.Network `json:"network,omitempty"`
 }
 
-// Struct to write the Argo to a file
+// Argo values passed to workflow charts
 type argoContainer struct {
 	Argo v1alpha1.Argo `json:"argo,omitempty"`
 }
 
-func (r *FabricNetworkReconciler) prepareHelmChart(ctx context.Context, network *v1alpha1.FabricNetwork) error {
-	networkDir := getNetworkDir(network)
-
-	if err := os.RemoveAll(networkDir); err != nil {
-		r.Log.Error(err, "Network dir alredy exists and couldnt delete", "networkDir", networkDir)
-		return err
-	}
-
-	if err := r.createHelmChartDir(ctx, network); err != nil {
-		r.Log.Error(err, "Create chart dir failed")
-		return err
-	}
-
-	if err := r.prepareChartDirForFabric(ctx, network, freshInstall); err != nil {
-		r.Log.Error(err, "Prepare chart dir failed")
-		return err
-	}
-
-	return nil
-}
-
-func (r *FabricNetworkReconciler) maybeReconstructHelmChart(ctx context.Context, network *v1alpha1.FabricNetwork) error {
-	networkDir := getNetworkDir(network)
-	if _, err := os.Stat(networkDir); !os.IsNotExist(err) {
-		// networkDir exists
-		return nil
-	}
-
-	switch network.Status.State {
-	case "":
-	case v1alpha1.StateNew:
-	case v1alpha1.StateRejected:
-	case v1alpha1.StateInvalid:
-	case v1alpha1.StateFailed:
-		return nil
-	}
-
-	r.Log.Info("networkDir does not exist, will reconstruct", "networkDir", networkDir, "state", network.Status.State)
-
-	if err := r.createHelmChartDir(ctx, network); err != nil {
-		r.Log.Error(err, "Create chart dir failed")
-		return err
-	}
-
-	if err := r.prepareChartDirForFabric(ctx, network, reconstruct); err != nil {
-		r.Log.Error(err, "Prepare chart dir failed")
-		return err
-	}
-
-	return nil
-}
-
-func (r *FabricNetworkReconciler) createHelmChartDir(ctx context.Context, network *v1alpha1.FabricNetwork) error {
-	networkDir := getNetworkDir(network)
-
-	if err := copyDir(settings.PivtDir+"/fabric-kube/hlf-kube", networkDir); err != nil {
-		r.Log.Error(err, "Couldnt copy hlf-kube folder to network dir", "networkDir", networkDir)
-		return err
-	}
-
-	if err := r.createValuesFiles(ctx, network); err != nil {
-		r.Log.Error(err, "Couldnt create values files")
-		return err
-	}
-
-	if err := os.MkdirAll(networkDir+"/channel-artifacts", 0755); err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func (r *FabricNetworkReconciler) installHelmChart(ctx context.Context, network *v1alpha1.FabricNetwork) error {
-	settings, actionConfig, err := r.initHelmClient(network.Namespace)
+func (r *FabricNetworkReconciler) installHelmChart(ctx context.Context, network *v1alpha1.FabricNetwork, artifacts *networkArtifacts) error {
+	_, actionConfig, err := r.initHelmClient(network.Namespace)
 	if err != nil {
 		return err
 	}
 
-	chart, err := loadHelmChart(network)
+	chart, err := hlfKubeChart(network, artifacts)
 	if err != nil {
 		return err
 	}
@@ -128,38 +49,53 @@ func (r *FabricNetworkReconciler) installHelmChart(ctx context.Context, network
 			"orderer.launchPods=false",
 		}
 	}
-	values, err := r.getChartValues(ctx, network, settings, []string{"hlf-kube-values.yaml"}, extraValues)
+	values, err := r.getHlfKubeValues(ctx, network, extraValues)
 	if err != nil {
 		return err
 	}
 
 	client := action.NewInstall(actionConfig)
-	client.ReleaseName = "hlf-kube"
+	client.ReleaseName = validation.HelmRelease(network)
 	client.Namespace = network.Namespace
+	client.Atomic = network.Spec.Helm.Atomic
+	client.Wait = network.Spec.Helm.Atomic
+	client.Timeout = helmTimeout(network)
 
-	r.Log.Info("Creating release", "namespace", network.Namespace)
-	// TODO for Kafka orderer, wait is not reliable. how to handle this?
+	r.Log.Info("Creating release", "name", client.ReleaseName, "namespace", network.Namespace)
+	// readiness of components including Kafka and ZooKeeper is checked in HelmChartInstalled state, even if Helm waits
 	release, err := client.Run(chart, values)
 	if err != nil {
+		helmFailuresCounter.WithLabelValues("install").Inc()
+		if client.Atomic {
+			r.Recorder.Eventf(network, corev1.EventTypeWarning, "HelmInstallFailed", "Installing Helm release %v failed and it's uninstalled: %v", client.ReleaseName, err)
+		} else {
+			r.Recorder.Eventf(network, corev1.EventTypeWarning, "HelmInstallFailed", "Installing Helm release %v failed: %v", client.ReleaseName, err)
+		}
 		return err
 	}
-	r.Log.Info("created release", "name", release.Name, "version", release.Version, "namespace", network.Namespace)
+	network.Status.ChartVersion = chart.Metadata.Version
+	r.Log.Info("created release", "name", release.Name, "version", release.Version, "chartVersion", chart.Metadata.Version, "namespace", network.Namespace)
+	r.Recorder.Eventf(network, corev1.EventTypeNormal, "HelmInstalled", "Installed Helm release %v, version %v", release.Name, release.Version)
 
 	return nil
 }
 
 func (r *FabricNetworkReconciler) updateHelmChart(ctx context.Context, network *v1alpha1.FabricNetwork) error {
-	settings, actionConfig, err := r.initHelmClient(network.Namespace)
+	_, actionConfig, err := r.initHelmClient(network.Namespace)
 	if err != nil {
 		return err
 	}
 
-	chart, err := loadHelmChart(network)
+	artifacts, err := r.loadArtifacts(ctx, network)
+	if err != nil {
+		return err
+	}
+	chart, err := hlfKubeChart(network, artifacts)
 	if err != nil {
 		return err
 	}
 
-	values, err := r.getChartValues(ctx, network, settings, []string{"hlf-kube-values.yaml"}, nil)
+	values, err := r.getHlfKubeValues(ctx, network, nil)
 	if err != nil {
 		r.Log.Error(err, "Couldnt get chart values")
 		return err
@@ -167,27 +103,49 @@ func (r *FabricNetworkReconciler) updateHelmChart(ctx context.Context, network *
 
 	client := action.NewUpgrade(actionConfig)
 	client.Namespace = network.Namespace
+	client.Atomic = network.Spec.Helm.Atomic
+	client.Wait = network.Spec.Helm.Atomic
+	client.Timeout = helmTimeout(network)
 
-	r.Log.Info("updating release")
-	release, err := client.Run("hlf-kube", chart, values)
+	releaseName := validation.HelmRelease(network)
+	r.Log.Info("updating release", "name", releaseName)
+	release, err := client.Run(releaseName, chart, values)
 	if err != nil {
+		helmFailuresCounter.WithLabelValues("upgrade").Inc()
+		if client.Atomic {
+			r.Recorder.Eventf(network, corev1.EventTypeWarning, "HelmUpgradeFailed", "Upgrading Helm release %v failed and it's rolled back: %v", releaseName, err)
+		} else {
+			r.Recorder.Eventf(network, corev1.EventTypeWarning, "HelmUpgradeFailed", "Upgrading Helm release %v failed: %v", releaseName, err)
+		}
 		return err
 	}
-	r.Log.Info("updated release", "name", release.Name, "version", release.Version, "namespace", network.Namespace)
+	network.Status.ChartVersion = chart.Metadata.Version
+	r.Log.Info("updated release", "name", release.Name, "version", release.Version, "chartVersion", chart.Metadata.Version, "namespace", network.Namespace)
+	r.Recorder.Eventf(network, corev1.EventTypeNormal, "HelmUpgraded", "Upgraded Helm release %v to version %v", release.Name, release.Version)
 
 	return nil
 }
 
-// uninstalls the hlf-kube Helm chart if its found and Chart.Metadata.Name is hlf-kube and annotated for specified FabricNetwork
+// uninstalls the hlf-kube Helm chart of specified FabricNetwork, either with derived or legacy release name
 func (r *FabricNetworkReconciler) maybeUninstallHelmChart(ctx context.Context, namespace string, name string) error {
 	_, actionConfig, err := r.initHelmClient(namespace)
 	if err != nil {
 		return err
 	}
 
+	for _, releaseName := range []string{validation.HelmReleaseName(name), validation.LegacyHelmRelease} {
+		if err := r.maybeUninstallHelmRelease(actionConfig, releaseName, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// uninstalls the Helm release if its found and Chart.Metadata.Name is hlf-kube and annotated for specified FabricNetwork
+func (r *FabricNetworkReconciler) maybeUninstallHelmRelease(actionConfig *action.Configuration, releaseName string, name string) error {
 	getClient := action.NewGet(actionConfig)
 
-	release, err := getClient.Run("hlf-kube")
+	release, err := getClient.Run(releaseName)
 	if err != nil {
 		if strings.Contains(err.Error(), "release: not found") {
 			r.Log.Info("Helm release is not found, skipping uninstall")
@@ -211,36 +169,38 @@ func (r *FabricNetworkReconciler) maybeUninstallHelmChart(ctx context.Context, n
 	client := action.NewUninstall(actionConfig)
 	client.KeepHistory = false
 
-	r.Log.Info("uninstalling release")
-	_, err = client.Run("hlf-kube")
+	r.Log.Info("uninstalling release", "name", releaseName)
+	_, err = client.Run(releaseName)
 	if err != nil {
 		return err
 	}
-	r.Log.Info("uninstalled release hlf-kube")
+	r.Log.Info("uninstalled release", "name", releaseName)
 
 	return nil
 }
 
-func loadHelmChart(network *v1alpha1.FabricNetwork) (*hchart.Chart, error) {
-	chart, err := loader.Load(getNetworkDir(network))
+// returns the values of hlf-kube chart
+func (r *FabricNetworkReconciler) getHlfKubeValues(ctx context.Context, network *v1alpha1.FabricNetwork, extraValues []string) (map[string]interface{}, error) {
+	hlfKubeValues, err := rawValues(network.Spec.HlfKube.Raw)
 	if err != nil {
 		return nil, err
 	}
-	if chart.Metadata.Annotations == nil {
-		chart.Metadata.Annotations = make(map[string]string)
-	}
-	chart.Metadata.Annotations["raft.io/fabric-operator-created-for"] = network.Name
-
-	return chart, nil
+	return r.getChartValues(ctx, network, []map[string]interface{}{hlfKubeValues}, extraValues)
 }
 
 func (r *FabricNetworkReconciler) renderChannelFlow(ctx context.Context, network *v1alpha1.FabricNetwork) (string, error) {
-	chartDir := settings.PivtDir + "/fabric-kube/channel-flow/"
-	return r.renderHelmChart(ctx, network, chartDir, []string{"shared-workflow-values.yaml", "channel-flow-values.yaml"}, nil)
+	channelFlowValues, err := rawValues(network.Spec.ChannelFlow.Raw)
+	if err != nil {
+		return "", err
+	}
+	return r.renderWorkflowChart(ctx, network, "channel-flow", []map[string]interface{}{channelFlowValues}, nil)
 }
 
 func (r *FabricNetworkReconciler) renderChaincodeFlow(ctx context.Context, network *v1alpha1.FabricNetwork, includeChaincodes []string) (string, error) {
-	chartDir := settings.PivtDir + "/fabric-kube/chaincode-flow/"
+	chaincodeFlowValues, err := rawValues(network.Spec.ChaincodeFlow.Raw)
+	if err != nil {
+		return "", err
+	}
 
 	extraValues := []string{
 		"chaincode.version=" + network.Spec.Chaincode.Version,
@@ -250,26 +210,43 @@ func (r *FabricNetworkReconciler) renderChaincodeFlow(ctx context.Context, netwo
 		extraValues = append(extraValues, "flow.chaincode.include={"+strings.Join(includeChaincodes, ",")+"}")
 	}
 
-	return r.renderHelmChart(ctx, network, chartDir, []string{"shared-workflow-values.yaml", "chaincode-flow-values.yaml"}, extraValues)
+	return r.renderWorkflowChart(ctx, network, "chaincode-flow", []map[string]interface{}{chaincodeFlowValues}, extraValues)
 }
 
 func (r *FabricNetworkReconciler) renderPeerOrgFlow(ctx context.Context, network *v1alpha1.FabricNetwork) (string, error) {
-	chartDir := settings.PivtDir + "/fabric-kube/peer-org-flow/"
-	return r.renderHelmChart(ctx, network, chartDir, []string{"shared-workflow-values.yaml", "peer-org-flow-values.yaml", "configtx.yaml"}, nil)
+	peerOrgFlowValues, err := rawValues(network.Spec.PeerOrgFlow.Raw)
+	if err != nil {
+		return "", err
+	}
+	configtxValues, err := r.configtxValues(ctx, network)
+	if err != nil {
+		return "", err
+	}
+	return r.renderWorkflowChart(ctx, network, "peer-org-flow", []map[string]interface{}{peerOrgFlowValues, configtxValues}, nil)
+}
+
+// renders the workflow chart with the values shared by all workflows and the given chart values
+func (r *FabricNetworkReconciler) renderWorkflowChart(ctx context.Context, network *v1alpha1.FabricNetwork,
+	chartName string, chartValues []map[string]interface{}, extraValues []string) (string, error) {
+
+	sharedValues, err := sharedWorkflowValues(network)
+	if err != nil {
+		return "", err
+	}
+	return r.renderHelmChart(ctx, network, chartName, append([]map[string]interface{}{sharedValues}, chartValues...), extraValues)
 }
 
 func (r *FabricNetworkReconciler) renderHelmChart(ctx context.Context, network *v1alpha1.FabricNetwork,
-	chartDir string, valuesFiles []string, extraValues []string) (string, error) {
+	chartName string, chartValues []map[string]interface{}, extraValues []string) (string, error) {
 
-	settings := cli.New()
 	actionConfig := new(action.Configuration)
 
-	chart, err := loader.Load(chartDir)
+	chart, err := loadChart(network, chartName)
 	if err != nil {
 		return "", err
 	}
 
-	values, err := r.getChartValues(ctx, network, settings, valuesFiles, extraValues)
+	values, err := r.getChartValues(ctx, network, chartValues, extraValues)
 	if err != nil {
 		return "", err
 	}
@@ -283,200 +260,26 @@ func (r *FabricNetworkReconciler) renderHelmChart(ctx context.Context, network *
 	// client.APIVersions = chartutil.VersionSet(extraAPIs)
 	client.IncludeCRDs = false
 
-	r.Log.Info("Rendering Helm chart", "path", chartDir, "extraValues", extraValues, "values", values)
+	// values are not logged, user provided values may contain credentials
+	r.Log.Info("Rendering Helm chart", "chart", chartName)
 	release, err := client.Run(chart, values)
 	if err != nil {
 		return "", err
 	}
-	r.Log.Info("Rendered Helm chart", "path", chartDir)
+	r.Log.Info("Rendered Helm chart", "chart", chartName)
 
 	return release.Manifest, nil
 }
 
-func (r *FabricNetworkReconciler) isHelmChartReady(ctx context.Context, network *v1alpha1.FabricNetwork) (bool, error) {
-	stsList := &appsv1.StatefulSetList{}
-	listOpts := []client.ListOption{
-		client.InNamespace(network.Namespace),
-		client.MatchingLabels(map[string]string{"app.kubernetes.io/managed-by": "Helm"}),
-	}
-
-	if err := r.List(ctx, stsList, listOpts...); err != nil {
-		r.Log.Error(err, "Failed to get StatefulSetList")
-		return false, err
-	}
-	r.Log.Info("got StatefulSetList", "size", len(stsList.Items))
-
-	for _, sts := range stsList.Items {
-		if sts.Annotations["meta.helm.sh/release-name"] != "hlf-kube" {
-			continue
-		}
-		// TODO when pods are restarting, this check is not sufficient.
-		// readyReplicas field is not updated immediately
-		if *sts.Spec.Replicas != sts.Status.ReadyReplicas {
-			r.Log.Info("StatefulSet is not ready", "name", sts.Name, "replicas", *sts.Spec.Replicas, "readyReplicas", sts.Status.ReadyReplicas)
-			return false, nil
-		}
-	}
-	r.Log.Info("All StatefulSets are ready", "count", len(stsList.Items))
-
-	deployList := &appsv1.DeploymentList{}
-
-	if err := r.List(ctx, deployList, listOpts...); err != nil {
-		r.Log.Error(err, "Failed to get DeploymentList")
-		return false, err
-	}
-	r.Log.Info("got DeploymentList", "size", len(deployList.Items))
-
-	for _, deploy := range deployList.Items {
-		if deploy.Annotations["meta.helm.sh/release-name"] != "hlf-kube" {
-			continue
-		}
-		if *deploy.Spec.Replicas != deploy.Status.ReadyReplicas {
-			r.Log.Info("Deployment is not ready", "name", deploy.Name, "replicas", *deploy.Spec.Replicas, "readyReplicas", deploy.Status.ReadyReplicas)
-			return false, nil
-		}
-	}
-	r.Log.Info("All Deployments are ready", "count", len(stsList.Items))
-
-	return true, nil
-}
-
-func getNetworkDir(network *v1alpha1.FabricNetwork) string {
-	return settings.NetworkDir + "/" + network.Namespace + "/" + network.Name
-}
-
-func (r *FabricNetworkReconciler) getChartValues(ctx context.Context, network *v1alpha1.FabricNetwork, settings *cli.EnvSettings, valuesFiles []string, extraValues []string) (map[string]interface{}, error) {
-	if err := r.createOperatorValuesFile(ctx, network); err != nil {
-		r.Log.Error(err, "Couldnt create operator values")
-		return nil, err
-	}
-
-	valueOpts := &values.Options{}
-	valueOpts.ValueFiles = []string{
-		getNetworkDir(network) + "/network.yaml",
-		getNetworkDir(network) + "/crypto-config.yaml",
-		getNetworkDir(network) + "/operator-values.yaml",
-	}
-	for _, vf := range valuesFiles {
-		valueOpts.ValueFiles = append(valueOpts.ValueFiles, getNetworkDir(network)+"/"+vf)
-	}
-	genesisProvided := false
-	if network.Spec.Genesis.Secret != "" {
-		genesisProvided = true
-	}
-	valueOpts.Values = append([]string{
-		// TODO
-		"hyperledgerVersion=" + network.Spec.Topology.Version,
-		"tlsEnabled=" + strconv.FormatBool(network.Spec.Topology.TLSEnabled),
-		"useActualDomains=" + strconv.FormatBool(network.Spec.Topology.UseActualDomains),
-		"configMap.chaincode=false",
-		"secret.configtx=false",
-		"secret.genesis=" + strconv.FormatBool(!genesisProvided),
-	}, extraValues...)
-	// if extraValues != nil {
-	// 	valueOpts.Values = append(valueOpts.Values, extraValues...)
-	// }
-	r.Log.Info("Values", "valueOpts", valueOpts)
-
-	providers := getter.All(settings)
-	values, err := valueOpts.MergeValues(providers)
-	r.Log.Info("Final values", "values", values)
-
-	return values, err
-}
-
-func (r *FabricNetworkReconciler) createValuesFiles(ctx context.Context, network *v1alpha1.FabricNetwork) error {
-	networkDir := getNetworkDir(network)
-
-	if err := r.createConfigtxFile(ctx, network); err != nil {
-		return err
-	}
-	if err := r.createCryptoConfigFile(ctx, network); err != nil {
-		return err
-	}
-	if err := r.createNetworkValuesFile(ctx, network); err != nil {
-		return err
-	}
-	if err := r.createValuesFile(network.Spec.HlfKube.Raw, networkDir+"/hlf-kube-values.yaml"); err != nil {
-		return err
-	}
-	if err := r.createValuesFile(network.Spec.ChannelFlow.Raw, networkDir+"/channel-flow-values.yaml"); err != nil {
-		return err
-	}
-	if err := r.createValuesFile(network.Spec.ChaincodeFlow.Raw, networkDir+"/chaincode-flow-values.yaml"); err != nil {
-		return err
-	}
-	if err := r.createValuesFile(network.Spec.PeerOrgFlow.Raw, networkDir+"/peer-org-flow-values.yaml"); err != nil {
-		return err
-	}
-	if err := r.createOperatorValuesFile(ctx, network); err != nil {
-		return err
-	}
-	if err := r.createSharedWorkflowValuesFile(ctx, network); err != nil {
-		return err
-	}
-	return nil
-}
-
-func (r *FabricNetworkReconciler) createNetworkValuesFile(ctx context.Context, network *v1alpha1.FabricNetwork) error {
-	networkDir := getNetworkDir(network)
-
-	netContainer := networkContainer{Network: network.Spec.Network}
-	file := networkDir + "/network.yaml"
-	if err := writeYamlToFile(netContainer, file); err != nil {
-		return err
-	}
-	r.Log.Info("Wrote network to file", "file", file, "network", netContainer)
-
-	return nil
-}
-
-func (r *FabricNetworkReconciler) createOperatorValuesFile(ctx context.Context, network *v1alpha1.FabricNetwork) error {
-	networkDir := getNetworkDir(network)
-
-	hostAliases, err := r.getHostAliases(ctx, network)
+// returns the readiness of StatefulSets and Deployments of the hlf-kube Helm release
+func (r *FabricNetworkReconciler) getHelmChartComponents(ctx context.Context, network *v1alpha1.FabricNetwork) ([]v1alpha1.ComponentStatus, error) {
+	components, err := getComponentStatuses(ctx, r.Client, r.APIReader, network.Namespace, validation.HelmRelease(network))
 	if err != nil {
-		return err
-	}
-
-	values := helmValues{
-		HostAliases: hostAliases,
-	}
-
-	file := networkDir + "/operator-values.yaml"
-	if err := writeYamlToFile(values, file); err != nil {
-		return err
-	}
-	r.Log.Info("Wrote values to file", "values", values, "file", file)
-
-	return nil
-}
-
-func (r *FabricNetworkReconciler) createValuesFile(contents []byte, file string) error {
-	yml, err := yaml.JSONToYAML(contents)
-	if err != nil {
-		return err
-	}
-
-	if err := ioutil.WriteFile(file, yml, 0644); err != nil {
-		return err
-	}
-	r.Log.Info("Wrote values to file", "values", string(contents), "file", file)
-
-	return nil
-}
-
-func (r *FabricNetworkReconciler) createSharedWorkflowValuesFile(ctx context.Context, network *v1alpha1.FabricNetwork) error {
-	networkDir := getNetworkDir(network)
-
-	argoContainer := argoContainer{Argo: network.Spec.Argo}
-	file := networkDir + "/shared-workflow-values.yaml"
-	if err := writeYamlToFile(argoContainer, file); err != nil {
-		return err
+		r.Log.Error(err, "Failed to get Helm release components")
+		return nil, err
 	}
-	r.Log.Info("Wrote shared workflow values to file", "file", file, "argo", argoContainer)
-
-	return nil
+	r.Log.Info("got Helm release components", "count", len(components), "notReady", notReadyComponents(components))
+	return components, nil
 }
 
 func (r *FabricNetworkReconciler) getHostAliases(ctx context.Context, network *v1alpha1.FabricNetwork) ([]corev1.HostAlias, error) {
@@ -497,12 +300,17 @@ func (r *FabricNetworkReconciler) getHostAliases(ctx context.Context, network *v
 		}
 		r.Log.Info("Got ServiceList", "size", len(svcList.Items))
 
-		hostAliases := make([]corev1.HostAlias, len(svcList.Items))
-		for i, svc := range svcList.Items {
-			hostAliases[i] = corev1.HostAlias{
+		releaseName := validation.HelmRelease(network)
+		hostAliases := []corev1.HostAlias{}
+		for _, svc := range svcList.Items {
+			// skip the services of other FabricNetworks in the namespace
+			if svc.Annotations["meta.helm.sh/release-name"] != releaseName {
+				continue
+			}
+			hostAliases = append(hostAliases, corev1.HostAlias{
 				IP:        svc.Spec.ClusterIP,
 				Hostnames: []string{svc.Labels["fqdn"]},
-			}
+			})
 		}
 		r.Log.Info("Created hostAliases", "items", hostAliases)
 
@@ -515,10 +323,32 @@ func (r *FabricNetworkReconciler) helmLog(format string, v ...interface{}) {
 	r.Log.Info("Helm log", "message", fmt.Sprintf(format, v...))
 }
 
+// Helm settings keyed by namespace. Helm reads the namespace from the RESTClientGetter of settings,
+// so each namespace gets its own settings instead of changing HELM_NAMESPACE of the process.
+// RESTClientGetters are safe for concurrent use and cache the discovery information, so they are reused
+type helmSettingsCache struct {
+	mu       sync.Mutex
+	settings map[string]*cli.EnvSettings
+}
+
+var helmSettings = &helmSettingsCache{settings: make(map[string]*cli.EnvSettings)}
+
+// returns the Helm settings of the namespace, creates them if not created before
+func (c *helmSettingsCache) get(namespace string) *cli.EnvSettings {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	settings, ok := c.settings[namespace]
+	if !ok {
+		settings = cli.New()
+		settings.SetNamespace(namespace)
+		c.settings[namespace] = settings
+	}
+	return settings
+}
+
 func (r *FabricNetworkReconciler) initHelmClient(namespace string) (*cli.EnvSettings, *action.Configuration, error) {
-	// TODO mutex this.
-	os.Setenv("HELM_NAMESPACE", namespace)
-	settings := cli.New()
+	settings := helmSettings.get(namespace)
 	actionConfig := new(action.Configuration)
 
 	if err := actionConfig.Init(settings.RESTClientGetter(), namespace, "secret", r.helmLog); err != nil {
@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/raftAtGit/hl-fabric-operator/api/v1alpha1"
+)
+
+func TestConcurrentReconcilesInSeveralNamespaces(t *testing.T) {
+	// no cluster is reachable, Helm actions fail and are only logged
+	t.Setenv("KUBECONFIG", "")
+	helmNamespace, helmNamespaceSet := os.LookupEnv("HELM_NAMESPACE")
+
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := wfv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	const namespaces = 8
+	objects := []client.Object{}
+	for i := 0; i < namespaces; i++ {
+		objects = append(objects, &wfv1.Workflow{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "channel-flow",
+				Namespace: fmt.Sprintf("concurrency-test-%d", i),
+				Labels:    map[string]string{"raft.io/fabric-operator-created-for": "simple"},
+			},
+		})
+	}
+
+	r := &FabricNetworkReconciler{
+		Client:   fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build(),
+		Log:      ctrl.Log.WithName("test"),
+		Scheme:   scheme,
+		Recorder: record.NewFakeRecorder(100),
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, namespaces*10)
+	for i := 0; i < namespaces; i++ {
+		namespace := fmt.Sprintf("concurrency-test-%d", i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				// FabricNetwork does not exist, so Reconcile uninstalls the Helm release and deletes the workflows
+				if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: namespace, Name: "simple"}}); err != nil {
+					errs <- err
+					return
+				}
+
+				settings, actionConfig, err := r.initHelmClient(namespace)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if settings.Namespace() != namespace {
+					errs <- fmt.Errorf("Helm settings of %v has namespace %v", namespace, settings.Namespace())
+				}
+				// Helm actions read the namespace from the RESTClientGetter
+				loaderNamespace, _, err := actionConfig.RESTClientGetter.(genericclioptions.RESTClientGetter).ToRawKubeConfigLoader().Namespace()
+				if err != nil {
+					errs <- err
+				} else if loaderNamespace != namespace {
+					errs <- fmt.Errorf("RESTClientGetter of %v has namespace %v", namespace, loaderNamespace)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	for i := 0; i < namespaces; i++ {
+		namespace := fmt.Sprintf("concurrency-test-%d", i)
+		wfList := &wfv1.WorkflowList{}
+		if err := r.List(context.Background(), wfList, client.InNamespace(namespace)); err != nil {
+			t.Fatal(err)
+		}
+		if len(wfList.Items) != 0 {
+			t.Errorf("workflows of %v are not deleted", namespace)
+		}
+		if helmSettings.get(namespace) != helmSettings.get(namespace) {
+			t.Errorf("Helm settings of %v are not reused", namespace)
+		}
+	}
+
+	if namespace, ok := os.LookupEnv("HELM_NAMESPACE"); ok != helmNamespaceSet || namespace != helmNamespace {
+		t.Errorf("HELM_NAMESPACE is changed to %v", namespace)
+	}
+}
@@ -0,0 +1,922 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+
+	"github.com/raftAtGit/hl-fabric-operator/api/v1alpha1"
+)
+
+const (
+	// label of the ConfigMap, Jobs and pods of a flow run by Jobs flow engine, value is the flow name
+	flowLabel = "raft.io/fabric-operator-flow"
+	// label of flow Jobs, index of the stage the Job belongs to
+	flowStageLabel = "raft.io/fabric-operator-flow-stage"
+	// annotation of flow Jobs and pods, name of the workflow step the Job runs
+	flowStepAnnotation = "raft.io/fabric-operator-flow-step"
+	// annotation of flow ConfigMap, time the flow is cancelled at
+	flowCancelledAnnotation = "raft.io/fabric-operator-flow-cancelled"
+	// key of the flow plan in flow ConfigMap
+	flowPlanKey = "plan.json"
+	// folder script sources are mounted to, same as Argo
+	flowScriptDir = "/argo/staging"
+	// maximum depth of nested templates, guards against recursive templates
+	maxTemplateDepth = 20
+)
+
+// runs flows as ordered Kubernetes Jobs. the rendered Argo workflow is translated to stages of Jobs,
+// stages run one after another and Jobs of a stage run in parallel.
+// the plan is kept in a ConfigMap named after the flow, which owns the Jobs
+type jobsEngine struct {
+	r *FabricNetworkReconciler
+}
+
+// a step of the flow, run as a Job
+type flowStep struct {
+	// name of the step in the workflow, i.e. create-channels.create-channel(0)
+	Name string `json:"name"`
+	// name of the workflow template the step runs
+	Template string          `json:"template,omitempty"`
+	Job      batchv1.JobSpec `json:"job"`
+}
+
+// steps of a flow. stages run one after another, steps of a stage run in parallel
+type flowPlan struct {
+	Stages [][]flowStep `json:"stages"`
+}
+
+func (e *jobsEngine) Submit(ctx context.Context, network *v1alpha1.FabricNetwork, wfManifest string, labels map[string]string) (string, error) {
+	r := e.r
+
+	wfs, err := r.unmarshalWorkflows([]byte(wfManifest), true)
+	if err != nil {
+		r.Log.Error(err, "Unmarshaling workflow failed")
+		return "", err
+	}
+	if len(wfs) != 1 {
+		return "", fmt.Errorf("Rendered template has %d workflows, expected exactly one", len(wfs))
+	}
+
+	name := wfs[0].Name
+	if name == "" {
+		name = wfs[0].GenerateName + utilrand.String(5)
+	}
+	plan, scripts, err := translateWorkflow(&wfs[0], name, network.Namespace)
+	if err != nil {
+		r.Log.Error(err, "Translating workflow to Jobs failed")
+		r.Recorder.Eventf(network, corev1.EventTypeWarning, "WorkflowSubmitFailed", "Translating workflow %v to Jobs failed: %v", name, err)
+		return "", err
+	}
+	planJson, err := json.Marshal(plan)
+	if err != nil {
+		return "", err
+	}
+	scripts[flowPlanKey] = string(planJson)
+
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: network.Namespace,
+			Labels:    map[string]string{flowLabel: name},
+		},
+		Data: scripts,
+	}
+	for key, value := range labels {
+		configMap.Labels[key] = value
+	}
+	if err := r.Create(ctx, configMap); err != nil {
+		r.Log.Error(err, "Failed to submit flow")
+		r.Recorder.Eventf(network, corev1.EventTypeWarning, "WorkflowSubmitFailed", "Submitting flow %v failed: %v", name, err)
+		return "", err
+	}
+	if _, _, err := e.advance(ctx, network.Name, configMap); err != nil {
+		return "", err
+	}
+	r.Log.Info("Submitted flow as Jobs", "name", name, "stages", len(plan.Stages))
+	return name, nil
+}
+
+func (e *jobsEngine) List(ctx context.Context, namespace string, labels map[string]string) ([]flowInfo, error) {
+	configMapList := &corev1.ConfigMapList{}
+	if err := e.r.List(ctx, configMapList, client.InNamespace(namespace), client.MatchingLabels(labels), client.HasLabels{flowLabel}); err != nil {
+		return nil, err
+	}
+	jobList := &batchv1.JobList{}
+	if err := e.r.List(ctx, jobList, client.InNamespace(namespace), client.HasLabels{flowLabel}); err != nil {
+		return nil, err
+	}
+	jobsByName := map[string]*batchv1.Job{}
+	for i := range jobList.Items {
+		jobsByName[jobList.Items[i].Name] = &jobList.Items[i]
+	}
+
+	flows := []flowInfo{}
+	for i := range configMapList.Items {
+		configMap := &configMapList.Items[i]
+		state, err := evaluateFlow(configMap, jobsByName)
+		if err != nil {
+			return nil, err
+		}
+		flows = append(flows, flowInfo{
+			Name:       configMap.Name,
+			Type:       configMap.Labels[flowTypeLabel],
+			Status:     state.status,
+			CreatedAt:  configMap.CreationTimestamp.Time,
+			FinishedAt: state.finishedAt,
+		})
+	}
+	return flows, nil
+}
+
+// returns the status of the flow and starts the Jobs of the next stage if the current one is completed
+func (e *jobsEngine) Status(ctx context.Context, network *v1alpha1.FabricNetwork, name string) (wfStatus, string, error) {
+	configMap := &corev1.ConfigMap{}
+	if err := e.r.Get(ctx, types.NamespacedName{Namespace: network.Namespace, Name: name}, configMap); err != nil {
+		e.r.Log.Error(err, "Failed to get flow ConfigMap")
+		return "", "", err
+	}
+	status, message, err := e.advance(ctx, network.Name, configMap)
+	if err != nil {
+		return "", "", err
+	}
+	e.r.Log.Info("Got flow", "name", name, "status", status)
+	return status, message, nil
+}
+
+// state of a flow, derived from its ConfigMap and Jobs
+type flowState struct {
+	status     wfStatus
+	message    string
+	finishedAt time.Time
+	// plan and index of the stage to create the missing Jobs of, -1 if there is none
+	plan  *flowPlan
+	stage int
+	// the failed step and its Job, if any
+	failedStep *flowStep
+	failedJob  *batchv1.Job
+}
+
+// creates the Jobs of the first stage which is not completed yet
+func (e *jobsEngine) advance(ctx context.Context, networkName string, configMap *corev1.ConfigMap) (wfStatus, string, error) {
+	jobsByName, err := e.flowJobs(ctx, configMap.Namespace, configMap.Name)
+	if err != nil {
+		return "", "", err
+	}
+
+	state, err := evaluateFlow(configMap, jobsByName)
+	if err != nil {
+		return "", "", err
+	}
+	if state.stage >= 0 {
+		for index, step := range state.plan.Stages[state.stage] {
+			if _, ok := jobsByName[flowJobName(configMap.Name, state.stage, index)]; ok {
+				continue
+			}
+			if err := e.createJob(ctx, networkName, configMap, state.stage, index, step); err != nil {
+				return "", "", err
+			}
+		}
+	}
+	return state.status, state.message, nil
+}
+
+// evaluates the state of the flow from the existing Jobs without changing anything.
+// jobsByName may contain Jobs of other flows
+func evaluateFlow(configMap *corev1.ConfigMap, jobsByName map[string]*batchv1.Job) (*flowState, error) {
+	name := configMap.Name
+
+	if cancelledAt, ok := configMap.Annotations[flowCancelledAnnotation]; ok {
+		finishedAt, _ := time.Parse(time.RFC3339, cancelledAt)
+		return &flowState{status: wfFailed, message: "Flow is cancelled", finishedAt: finishedAt, stage: -1}, nil
+	}
+	plan := &flowPlan{}
+	if err := json.Unmarshal([]byte(configMap.Data[flowPlanKey]), plan); err != nil {
+		return nil, fmt.Errorf("Invalid plan in flow ConfigMap %v: %w", name, err)
+	}
+
+	state := &flowState{plan: plan, stage: -1}
+	for stage, steps := range plan.Stages {
+		completed := true
+		missing := false
+		for index, step := range steps {
+			job, ok := jobsByName[flowJobName(name, stage, index)]
+			if !ok {
+				completed = false
+				missing = true
+				continue
+			}
+			if finishedAt := jobFinishedAt(job); finishedAt.After(state.finishedAt) {
+				state.finishedAt = finishedAt
+			}
+			if failed, message := jobCondition(job, batchv1.JobFailed); failed {
+				state.status = wfFailed
+				state.message = fmt.Sprintf("step %v failed: %v", step.Name, message)
+				state.failedStep = &plan.Stages[stage][index]
+				state.failedJob = job
+				return state, nil
+			}
+			if complete, _ := jobCondition(job, batchv1.JobComplete); !complete {
+				completed = false
+			}
+		}
+		if !completed {
+			state.status = wfSubmitted
+			state.message = fmt.Sprintf("Running stage %d of %d", stage+1, len(plan.Stages))
+			state.finishedAt = time.Time{}
+			if missing {
+				state.stage = stage
+			}
+			return state, nil
+		}
+	}
+	state.status = wfCompleted
+	return state, nil
+}
+
+func (e *jobsEngine) createJob(ctx context.Context, networkName string, configMap *corev1.ConfigMap, stage int, index int, step flowStep) error {
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      flowJobName(configMap.Name, stage, index),
+			Namespace: configMap.Namespace,
+			Labels: map[string]string{
+				"raft.io/fabric-operator-created-for": networkName,
+				flowLabel:                             configMap.Name,
+				flowStageLabel:                        strconv.Itoa(stage),
+			},
+			Annotations: map[string]string{flowStepAnnotation: step.Name},
+		},
+		Spec: step.Job,
+	}
+	if err := controllerutil.SetOwnerReference(configMap, job, e.r.Scheme); err != nil {
+		return err
+	}
+	if err := e.r.Create(ctx, job); err != nil {
+		// cache may not have the Job created in a previous reconcile yet
+		if errors.IsAlreadyExists(err) {
+			return nil
+		}
+		e.r.Log.Error(err, "Failed to create Job", "job", job.Name)
+		return err
+	}
+	e.r.Log.Info("Created Job", "job", job.Name, "step", step.Name)
+	return nil
+}
+
+// marks the flow as cancelled and deletes the Jobs which are not finished yet
+func (e *jobsEngine) Cancel(ctx context.Context, network *v1alpha1.FabricNetwork, name string) error {
+	configMap := &corev1.ConfigMap{}
+	if err := e.r.Get(ctx, types.NamespacedName{Namespace: network.Namespace, Name: name}, configMap); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if configMap.Annotations == nil {
+		configMap.Annotations = map[string]string{}
+	}
+	configMap.Annotations[flowCancelledAnnotation] = time.Now().UTC().Format(time.RFC3339)
+	if err := e.r.Update(ctx, configMap); err != nil {
+		return err
+	}
+
+	jobs, err := e.listJobs(ctx, network.Namespace, client.MatchingLabels{flowLabel: name})
+	if err != nil {
+		return err
+	}
+	for i := range jobs {
+		complete, _ := jobCondition(&jobs[i], batchv1.JobComplete)
+		failed, _ := jobCondition(&jobs[i], batchv1.JobFailed)
+		if complete || failed {
+			continue
+		}
+		if err := e.r.Delete(ctx, &jobs[i], client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// returns the step of the failed Job of the flow
+func (e *jobsEngine) FailedStep(ctx context.Context, namespace string, name string) (*v1alpha1.FailedStep, error) {
+	configMap := &corev1.ConfigMap{}
+	if err := e.r.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, configMap); err != nil {
+		return nil, err
+	}
+	jobsByName, err := e.flowJobs(ctx, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	state, err := evaluateFlow(configMap, jobsByName)
+	if err != nil || state.failedStep == nil {
+		return nil, err
+	}
+	_, message := jobCondition(state.failedJob, batchv1.JobFailed)
+	return &v1alpha1.FailedStep{Name: state.failedStep.Name, Template: state.failedStep.Template, Message: message}, nil
+}
+
+// deletes the Jobs and the ConfigMap of the flow
+func (e *jobsEngine) Delete(ctx context.Context, namespace string, name string) error {
+	jobs, err := e.listJobs(ctx, namespace, client.MatchingLabels{flowLabel: name})
+	if err != nil {
+		return err
+	}
+	for i := range jobs {
+		if err := e.r.Delete(ctx, &jobs[i], client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+	return client.IgnoreNotFound(e.r.Delete(ctx, configMap))
+}
+
+func (e *jobsEngine) DeleteAll(ctx context.Context, namespace string, networkName string) error {
+	r := e.r
+	createdFor := client.MatchingLabels{"raft.io/fabric-operator-created-for": networkName}
+
+	jobs, err := e.listJobs(ctx, namespace, createdFor)
+	if err != nil {
+		return err
+	}
+	for i := range jobs {
+		if err := r.Delete(ctx, &jobs[i], client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+		r.Log.Info("deleted Job", "job", jobs[i].Name)
+	}
+
+	configMapList := &corev1.ConfigMapList{}
+	if err := r.List(ctx, configMapList, client.InNamespace(namespace), createdFor, client.HasLabels{flowLabel}); err != nil {
+		r.Log.Error(err, "Failed to get ConfigMapList")
+		return err
+	}
+	for i := range configMapList.Items {
+		if err := r.Delete(ctx, &configMapList.Items[i]); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+		r.Log.Info("deleted flow ConfigMap", "configMap", configMapList.Items[i].Name)
+	}
+	return nil
+}
+
+// returns the logs of the main containers of the flow Jobs, by step name
+func (e *jobsEngine) Logs(ctx context.Context, namespace string, name string) (map[string]string, error) {
+	return e.r.podLogs(ctx, namespace, flowLabel+"="+name, "main", func(pod *corev1.Pod) string {
+		return pod.Annotations[flowStepAnnotation]
+	})
+}
+
+func (e *jobsEngine) listJobs(ctx context.Context, namespace string, labels client.MatchingLabels) ([]batchv1.Job, error) {
+	jobList := &batchv1.JobList{}
+	if err := e.r.List(ctx, jobList, client.InNamespace(namespace), labels); err != nil {
+		e.r.Log.Error(err, "Failed to get JobList")
+		return nil, err
+	}
+	return jobList.Items, nil
+}
+
+// returns the Jobs of the flow by name
+func (e *jobsEngine) flowJobs(ctx context.Context, namespace string, name string) (map[string]*batchv1.Job, error) {
+	jobs, err := e.listJobs(ctx, namespace, client.MatchingLabels{flowLabel: name})
+	if err != nil {
+		return nil, err
+	}
+	jobsByName := map[string]*batchv1.Job{}
+	for i := range jobs {
+		jobsByName[jobs[i].Name] = &jobs[i]
+	}
+	return jobsByName, nil
+}
+
+func flowJobName(flow string, stage int, index int) string {
+	return fmt.Sprintf("%v-%d-%d", flow, stage, index)
+}
+
+// returns the time the Job is completed or failed at, zero if it is not finished
+func jobFinishedAt(job *batchv1.Job) time.Time {
+	finishedAt := time.Time{}
+	for _, condition := range job.Status.Conditions {
+		if (condition.Type == batchv1.JobComplete || condition.Type == batchv1.JobFailed) &&
+			condition.Status == corev1.ConditionTrue && condition.LastTransitionTime.After(finishedAt) {
+			finishedAt = condition.LastTransitionTime.Time
+		}
+	}
+	return finishedAt
+}
+
+// returns true and the message of the condition if the Job has the condition
+func jobCondition(job *batchv1.Job, conditionType batchv1.JobConditionType) (bool, string) {
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == conditionType && condition.Status == corev1.ConditionTrue {
+			return true, condition.Message
+		}
+	}
+	return false, ""
+}
+
+// Argo template tags, i.e. {{inputs.parameters.channel}}
+var templateTag = regexp.MustCompile(`{{\s*([^{}]*?)\s*}}`)
+
+// replaces the template tags in s with the values in scope. escape is applied to the values
+func substitute(s string, scope map[string]string, escape func(string) string) (string, error) {
+	var missing []string
+	result := templateTag.ReplaceAllStringFunc(s, func(tag string) string {
+		key := templateTag.FindStringSubmatch(tag)[1]
+		value, ok := scope[key]
+		if !ok {
+			missing = append(missing, key)
+			return tag
+		}
+		return escape(value)
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("Unsupported or unresolved variables: %v", strings.Join(missing, ", "))
+	}
+	return result, nil
+}
+
+func noEscape(s string) string {
+	return s
+}
+
+// escapes the value to be placed in a JSON string
+func jsonEscape(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data[1 : len(data)-1])
+}
+
+// translates Argo workflows to stages of Jobs
+type flowTranslator struct {
+	wf        *wfv1.Workflow
+	name      string
+	templates map[string]*wfv1.Template
+	// workflow variables, i.e. workflow.name
+	globals map[string]string
+	// script sources by ConfigMap key
+	scripts map[string]string
+}
+
+// translates the workflow to the plan of the flow with given name. returns the plan and the script sources of
+// the steps by ConfigMap key. only the Argo features used by the flows are supported, other ones are rejected
+func translateWorkflow(wf *wfv1.Workflow, name string, namespace string) (*flowPlan, map[string]string, error) {
+	spec := &wf.Spec
+	switch {
+	case spec.OnExit != "":
+		return nil, nil, fmt.Errorf("Workflow onExit is not supported by Jobs flow engine")
+	case len(spec.VolumeClaimTemplates) > 0:
+		return nil, nil, fmt.Errorf("Workflow volumeClaimTemplates are not supported by Jobs flow engine")
+	case spec.WorkflowTemplateRef != nil:
+		return nil, nil, fmt.Errorf("Workflow workflowTemplateRef is not supported by Jobs flow engine")
+	}
+
+	t := &flowTranslator{
+		wf:        wf,
+		name:      name,
+		templates: map[string]*wfv1.Template{},
+		globals: map[string]string{
+			"workflow.name":      name,
+			"workflow.namespace": namespace,
+		},
+		scripts: map[string]string{},
+	}
+	for i := range spec.Templates {
+		t.templates[spec.Templates[i].Name] = &spec.Templates[i]
+	}
+	args := map[string]string{}
+	for _, param := range spec.Arguments.Parameters {
+		if param.Value == nil {
+			return nil, nil, fmt.Errorf("Workflow parameter %v has no value", param.Name)
+		}
+		t.globals["workflow.parameters."+param.Name] = param.Value.String()
+		args[param.Name] = param.Value.String()
+	}
+
+	entrypoint, ok := t.templates[spec.Entrypoint]
+	if !ok {
+		return nil, nil, fmt.Errorf("Entrypoint template %v not found", spec.Entrypoint)
+	}
+	stages, err := t.expand(entrypoint, spec.Entrypoint, args, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &flowPlan{Stages: stages}, t.scripts, nil
+}
+
+// expands the template invoked with given arguments to stages of steps
+func (t *flowTranslator) expand(tmpl *wfv1.Template, stepName string, args map[string]string, depth int) ([][]flowStep, error) {
+	if depth > maxTemplateDepth {
+		return nil, fmt.Errorf("Templates are nested deeper than %d at %v", maxTemplateDepth, stepName)
+	}
+	if err := checkTemplate(tmpl); err != nil {
+		return nil, fmt.Errorf("Template %v: %w", tmpl.Name, err)
+	}
+
+	scope := map[string]string{}
+	for key, value := range t.globals {
+		scope[key] = value
+	}
+	for _, param := range tmpl.Inputs.Parameters {
+		value, ok := args[param.Name]
+		if !ok && param.Value != nil {
+			value, ok = param.Value.String(), true
+		}
+		if !ok && param.Default != nil {
+			value, ok = param.Default.String(), true
+		}
+		if !ok {
+			return nil, fmt.Errorf("Template %v: input parameter %v is not provided", tmpl.Name, param.Name)
+		}
+		scope["inputs.parameters."+param.Name] = value
+	}
+
+	switch {
+	case tmpl.Container != nil || tmpl.Script != nil:
+		step, err := t.leafStep(tmpl, stepName, scope)
+		if err != nil {
+			return nil, fmt.Errorf("Template %v: %w", tmpl.Name, err)
+		}
+		return [][]flowStep{{step}}, nil
+
+	case tmpl.Steps != nil:
+		stages := [][]flowStep{}
+		for _, group := range tmpl.Steps {
+			groupStages := [][]flowStep{}
+			for i := range group.Steps {
+				step := &group.Steps[i]
+				expanded, err := t.expandInvocation(invocation{
+					name:        step.Name,
+					template:    step.Template,
+					inline:      step.Inline,
+					arguments:   step.Arguments,
+					withItems:   step.WithItems,
+					unsupported: unsupportedStepFields(step.TemplateRef, step.WithParam, step.WithSequence, step.When, step.ContinueOn, step.OnExit, step.Hooks),
+				}, stepName, scope, depth)
+				if err != nil {
+					return nil, err
+				}
+				groupStages = mergeStages(groupStages, expanded)
+			}
+			stages = append(stages, groupStages...)
+		}
+		return stages, nil
+
+	case tmpl.DAG != nil:
+		if tmpl.DAG.Target != "" {
+			return nil, fmt.Errorf("Template %v: DAG target is not supported by Jobs flow engine", tmpl.Name)
+		}
+		levels, err := dagLevels(tmpl.DAG.Tasks)
+		if err != nil {
+			return nil, fmt.Errorf("Template %v: %w", tmpl.Name, err)
+		}
+		stages := [][]flowStep{}
+		for _, level := range levels {
+			levelStages := [][]flowStep{}
+			for _, task := range level {
+				if task.Depends != "" {
+					return nil, fmt.Errorf("Template %v: task %v: depends is not supported by Jobs flow engine, use dependencies", tmpl.Name, task.Name)
+				}
+				expanded, err := t.expandInvocation(invocation{
+					name:        task.Name,
+					template:    task.Template,
+					inline:      task.Inline,
+					arguments:   task.Arguments,
+					withItems:   task.WithItems,
+					unsupported: unsupportedStepFields(task.TemplateRef, task.WithParam, task.WithSequence, task.When, task.ContinueOn, task.OnExit, task.Hooks),
+				}, stepName, scope, depth)
+				if err != nil {
+					return nil, err
+				}
+				levelStages = mergeStages(levelStages, expanded)
+			}
+			stages = append(stages, levelStages...)
+		}
+		return stages, nil
+
+	default:
+		return nil, fmt.Errorf("Template %v: only container, script, steps and dag templates are supported by Jobs flow engine", tmpl.Name)
+	}
+}
+
+// invocation of a template by a step or a DAG task
+type invocation struct {
+	name        string
+	template    string
+	inline      *wfv1.Template
+	arguments   wfv1.Arguments
+	withItems   []wfv1.Item
+	unsupported string
+}
+
+// expands the invocation of a template, once for each item if withItems is set.
+// expanded items run in parallel
+func (t *flowTranslator) expandInvocation(inv invocation, parentName string, scope map[string]string, depth int) ([][]flowStep, error) {
+	stepName := parentName + "." + inv.name
+	if inv.unsupported != "" {
+		return nil, fmt.Errorf("Step %v: %v is not supported by Jobs flow engine", stepName, inv.unsupported)
+	}
+	if len(inv.arguments.Artifacts) > 0 {
+		return nil, fmt.Errorf("Step %v: artifacts are not supported by Jobs flow engine", stepName)
+	}
+	tmpl := inv.inline
+	if tmpl == nil {
+		var ok bool
+		if tmpl, ok = t.templates[inv.template]; !ok {
+			return nil, fmt.Errorf("Step %v: template %v not found", stepName, inv.template)
+		}
+	}
+
+	if inv.withItems == nil {
+		args, err := resolveArguments(inv.arguments, scope)
+		if err != nil {
+			return nil, fmt.Errorf("Step %v: %w", stepName, err)
+		}
+		return t.expand(tmpl, stepName, args, depth+1)
+	}
+
+	stages := [][]flowStep{}
+	for i := range inv.withItems {
+		itemScope := map[string]string{}
+		for key, value := range scope {
+			itemScope[key] = value
+		}
+		addItem(itemScope, &inv.withItems[i])
+
+		itemName := fmt.Sprintf("%v(%d)", stepName, i)
+		args, err := resolveArguments(inv.arguments, itemScope)
+		if err != nil {
+			return nil, fmt.Errorf("Step %v: %w", itemName, err)
+		}
+		expanded, err := t.expand(tmpl, itemName, args, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		stages = mergeStages(stages, expanded)
+	}
+	return stages, nil
+}
+
+// creates the step running the container or script template
+func (t *flowTranslator) leafStep(tmpl *wfv1.Template, stepName string, scope map[string]string) (flowStep, error) {
+	// substitute the variables in whole template, as they may be used anywhere
+	tmplJson, err := json.Marshal(tmpl)
+	if err != nil {
+		return flowStep{}, err
+	}
+	substituted, err := substitute(string(tmplJson), scope, jsonEscape)
+	if err != nil {
+		return flowStep{}, err
+	}
+	tmpl = &wfv1.Template{}
+	if err := json.Unmarshal([]byte(substituted), tmpl); err != nil {
+		return flowStep{}, err
+	}
+
+	spec := &t.wf.Spec
+	podSpec := corev1.PodSpec{
+		RestartPolicy:      corev1.RestartPolicyNever,
+		Volumes:            append(append([]corev1.Volume{}, spec.Volumes...), tmpl.Volumes...),
+		ServiceAccountName: firstNonEmpty(tmpl.ServiceAccountName, spec.ServiceAccountName),
+		NodeSelector:       tmpl.NodeSelector,
+		Tolerations:        tmpl.Tolerations,
+		Affinity:           tmpl.Affinity,
+		HostAliases:        append(append([]corev1.HostAlias{}, spec.HostAliases...), tmpl.HostAliases...),
+		ImagePullSecrets:   spec.ImagePullSecrets,
+		SecurityContext:    tmpl.SecurityContext,
+		SchedulerName:      firstNonEmpty(tmpl.SchedulerName, spec.SchedulerName),
+		PriorityClassName:  firstNonEmpty(tmpl.PriorityClassName, spec.PodPriorityClassName),
+	}
+	if podSpec.NodeSelector == nil {
+		podSpec.NodeSelector = spec.NodeSelector
+	}
+	if podSpec.Tolerations == nil {
+		podSpec.Tolerations = spec.Tolerations
+	}
+	if podSpec.Affinity == nil {
+		podSpec.Affinity = spec.Affinity
+	}
+	if podSpec.SecurityContext == nil {
+		podSpec.SecurityContext = spec.SecurityContext
+	}
+	if tmpl.AutomountServiceAccountToken != nil {
+		podSpec.AutomountServiceAccountToken = tmpl.AutomountServiceAccountToken
+	} else {
+		podSpec.AutomountServiceAccountToken = spec.AutomountServiceAccountToken
+	}
+
+	var container corev1.Container
+	if tmpl.Container != nil {
+		container = *tmpl.Container
+	} else {
+		// script source is mounted from flow ConfigMap and appended to the args, same as Argo
+		key := fmt.Sprintf("script-%d", len(t.scripts))
+		t.scripts[key] = tmpl.Script.Source
+		container = tmpl.Script.Container
+		container.Args = append(append([]string{}, container.Args...), flowScriptDir+"/script")
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{Name: "flow-script", MountPath: flowScriptDir, ReadOnly: true})
+		podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+			Name: "flow-script",
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: t.name},
+					Items:                []corev1.KeyToPath{{Key: key, Path: "script"}},
+				},
+			},
+		})
+	}
+	container.Name = "main"
+	podSpec.Containers = []corev1.Container{container}
+
+	labels := map[string]string{flowLabel: t.name}
+	annotations := map[string]string{flowStepAnnotation: stepName}
+	for _, metadata := range []*wfv1.Metadata{spec.PodMetadata, &tmpl.Metadata} {
+		if metadata == nil {
+			continue
+		}
+		for key, value := range metadata.Labels {
+			labels[key] = value
+		}
+		for key, value := range metadata.Annotations {
+			annotations[key] = value
+		}
+	}
+
+	// Argo does not retry failed steps by default
+	backoffLimit := int32(0)
+	if tmpl.RetryStrategy != nil && tmpl.RetryStrategy.Limit != nil {
+		backoffLimit = int32(tmpl.RetryStrategy.Limit.IntValue())
+	}
+	jobSpec := batchv1.JobSpec{
+		BackoffLimit: &backoffLimit,
+		Template: corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{Labels: labels, Annotations: annotations},
+			Spec:       podSpec,
+		},
+	}
+	if tmpl.ActiveDeadlineSeconds != nil {
+		deadline := int64(tmpl.ActiveDeadlineSeconds.IntValue())
+		jobSpec.ActiveDeadlineSeconds = &deadline
+	}
+	return flowStep{Name: stepName, Template: tmpl.Name, Job: jobSpec}, nil
+}
+
+// returns an error message if the template uses a feature not supported by Jobs flow engine
+func checkTemplate(tmpl *wfv1.Template) error {
+	unsupported := ""
+	switch {
+	case tmpl.Resource != nil:
+		unsupported = "resource template"
+	case tmpl.Suspend != nil:
+		unsupported = "suspend template"
+	case tmpl.ContainerSet != nil:
+		unsupported = "containerSet template"
+	case tmpl.Data != nil || tmpl.HTTP != nil || tmpl.Plugin != nil:
+		unsupported = "data, http and plugin templates"
+	case len(tmpl.Sidecars) > 0 || len(tmpl.InitContainers) > 0:
+		unsupported = "sidecars and initContainers"
+	case len(tmpl.Inputs.Artifacts) > 0 || len(tmpl.Outputs.Artifacts) > 0:
+		unsupported = "artifacts"
+	case tmpl.Daemon != nil && *tmpl.Daemon:
+		unsupported = "daemon"
+	case tmpl.PodSpecPatch != "":
+		unsupported = "podSpecPatch"
+	default:
+		return nil
+	}
+	return fmt.Errorf("%v not supported by Jobs flow engine", unsupported)
+}
+
+// returns the name of the first unsupported field of a step or DAG task which is set
+func unsupportedStepFields(templateRef *wfv1.TemplateRef, withParam string, withSequence *wfv1.Sequence, when string,
+	continueOn *wfv1.ContinueOn, onExit string, hooks wfv1.LifecycleHooks) string {
+
+	switch {
+	case templateRef != nil:
+		return "templateRef"
+	case withParam != "":
+		return "withParam"
+	case withSequence != nil:
+		return "withSequence"
+	case when != "":
+		return "when"
+	case continueOn != nil:
+		return "continueOn"
+	case onExit != "":
+		return "onExit"
+	case len(hooks) > 0:
+		return "hooks"
+	}
+	return ""
+}
+
+// resolves the values of argument parameters of a step
+func resolveArguments(arguments wfv1.Arguments, scope map[string]string) (map[string]string, error) {
+	args := map[string]string{}
+	for _, param := range arguments.Parameters {
+		if param.Value == nil {
+			return nil, fmt.Errorf("argument %v has no value", param.Name)
+		}
+		value, err := substitute(param.Value.String(), scope, noEscape)
+		if err != nil {
+			return nil, fmt.Errorf("argument %v: %w", param.Name, err)
+		}
+		args[param.Name] = value
+	}
+	return args, nil
+}
+
+// adds {{item}} and for map items {{item.<key>}} variables to scope
+func addItem(scope map[string]string, item *wfv1.Item) {
+	scope["item"] = item.String()
+	if item.GetType() != wfv1.Map {
+		return
+	}
+	for key, value := range item.GetMapVal() {
+		scope["item."+key] = value.String()
+	}
+}
+
+// orders DAG tasks in levels, each task is in the level after its last dependency
+func dagLevels(tasks []wfv1.DAGTask) ([][]wfv1.DAGTask, error) {
+	byName := map[string]*wfv1.DAGTask{}
+	for i := range tasks {
+		byName[tasks[i].Name] = &tasks[i]
+	}
+
+	levelOf := map[string]int{}
+	var visit func(name string, path []string) (int, error)
+	visit = func(name string, path []string) (int, error) {
+		if level, ok := levelOf[name]; ok {
+			return level, nil
+		}
+		task, ok := byName[name]
+		if !ok {
+			return 0, fmt.Errorf("dependency %v not found", name)
+		}
+		for _, p := range path {
+			if p == name {
+				return 0, fmt.Errorf("dependency cycle %v", strings.Join(append(path, name), " -> "))
+			}
+		}
+		level := 0
+		for _, dependency := range task.Dependencies {
+			dependencyLevel, err := visit(dependency, append(path, name))
+			if err != nil {
+				return 0, err
+			}
+			if dependencyLevel+1 > level {
+				level = dependencyLevel + 1
+			}
+		}
+		levelOf[name] = level
+		return level, nil
+	}
+
+	levels := [][]wfv1.DAGTask{}
+	for _, task := range tasks {
+		level, err := visit(task.Name, nil)
+		if err != nil {
+			return nil, err
+		}
+		for len(levels) <= level {
+			levels = append(levels, []wfv1.DAGTask{})
+		}
+	}
+	// keep the order of tasks within a level
+	for _, task := range tasks {
+		levels[levelOf[task.Name]] = append(levels[levelOf[task.Name]], task)
+	}
+	return levels, nil
+}
+
+// merges stages of parallel branches, i-th stages of the branches run together
+func mergeStages(stages [][]flowStep, branch [][]flowStep) [][]flowStep {
+	for i, stage := range branch {
+		if i < len(stages) {
+			stages[i] = append(stages[i], stage...)
+		} else {
+			stages = append(stages, stage)
+		}
+	}
+	return stages
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
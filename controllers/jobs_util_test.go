@@ -0,0 +1,467 @@
+package controllers
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/yaml"
+
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+
+	"github.com/raftAtGit/hl-fabric-operator/api/v1alpha1"
+	"github.com/raftAtGit/hl-fabric-operator/validation"
+)
+
+// a workflow similar to the rendered channel-flow
+const testFlow = `
+apiVersion: argoproj.io/v1alpha1
+kind: Workflow
+metadata:
+  generateName: hlf-channels-
+spec:
+  entrypoint: channels
+  serviceAccountName: fabric
+  arguments:
+    parameters:
+    - name: tlsEnabled
+      value: "true"
+  volumes:
+  - name: hlf-scripts
+    configMap:
+      name: hlf-scripts
+  templates:
+  - name: channels
+    steps:
+    - - name: create-channels
+        template: create-channels
+    - - name: join-channels
+        template: join-channel
+        arguments:
+          parameters:
+          - name: channel
+            value: "{{item.channel}}"
+          - name: peer
+            value: "{{item.peer}}"
+        withItems:
+        - {channel: common, peer: peer0.atlantis.com}
+        - {channel: common, peer: peer0.aptalkarga.tr}
+      - name: log
+        template: log
+  - name: create-channels
+    dag:
+      tasks:
+      - name: update-anchor-peers
+        template: create-channel
+        dependencies: [create-common]
+        arguments:
+          parameters:
+          - name: channel
+            value: common-anchors
+      - name: create-common
+        template: create-channel
+        arguments:
+          parameters:
+          - name: channel
+            value: common
+  - name: create-channel
+    inputs:
+      parameters:
+      - name: channel
+    retryStrategy:
+      limit: 2
+    script:
+      image: hyperledger/fabric-tools:1.4.9
+      command: [bash]
+      args: [-e]
+      source: |
+        peer channel create -c {{inputs.parameters.channel}} --tls {{workflow.parameters.tlsEnabled}}
+  - name: join-channel
+    inputs:
+      parameters:
+      - name: channel
+      - name: peer
+      - name: org
+        default: Atlantis
+    container:
+      image: hyperledger/fabric-tools:1.4.9
+      command: [sh, -c]
+      args: ["peer channel join -c {{inputs.parameters.channel}} --peer \"{{inputs.parameters.peer}}\" # {{inputs.parameters.org}}"]
+  - name: log
+    container:
+      image: alpine
+      command: [echo, "{{workflow.name}} in {{workflow.namespace}}"]
+`
+
+func renderTestFlow() (string, error) {
+	return testFlow, nil
+}
+
+func testStepNames(stages [][]flowStep) [][]string {
+	names := [][]string{}
+	for _, stage := range stages {
+		stageNames := []string{}
+		for _, step := range stage {
+			stageNames = append(stageNames, step.Name)
+		}
+		names = append(names, stageNames)
+	}
+	return names
+}
+
+func testReconciler(t *testing.T, objects ...client.Object) *FabricNetworkReconciler {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := wfv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).WithStatusSubresource(&v1alpha1.FabricNetwork{}).Build()
+	return &FabricNetworkReconciler{
+		Client:    cl,
+		Log:       ctrl.Log.WithName("test"),
+		Scheme:    scheme,
+		Recorder:  record.NewFakeRecorder(100),
+		APIReader: cl,
+	}
+}
+
+func TestTranslateWorkflow(t *testing.T) {
+	r := testReconciler(t)
+	wfs, err := r.unmarshalWorkflows([]byte(testFlow), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plan, scripts, err := translateWorkflow(&wfs[0], "hlf-channels-abcde", "simple")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := [][]string{
+		{"channels.create-channels.create-common"},
+		{"channels.create-channels.update-anchor-peers"},
+		{"channels.join-channels(0)", "channels.join-channels(1)", "channels.log"},
+	}
+	if got := testStepNames(plan.Stages); !equalStages(got, expected) {
+		t.Fatalf("stages are %v, expected %v", got, expected)
+	}
+
+	// script source is mounted from the flow ConfigMap
+	createCommon := plan.Stages[0][0].Job
+	if len(scripts) != 2 {
+		t.Fatalf("%d scripts, expected 2", len(scripts))
+	}
+	if scripts["script-0"] != "peer channel create -c common --tls true\n" {
+		t.Errorf("unexpected script %q", scripts["script-0"])
+	}
+	container := createCommon.Template.Spec.Containers[0]
+	if container.Name != "main" || strings.Join(container.Command, " ") != "bash" || strings.Join(container.Args, " ") != "-e /argo/staging/script" {
+		t.Errorf("unexpected script container %v %v %v", container.Name, container.Command, container.Args)
+	}
+	volumes := createCommon.Template.Spec.Volumes
+	if len(volumes) != 2 || volumes[0].Name != "hlf-scripts" || volumes[1].ConfigMap == nil || volumes[1].ConfigMap.Name != "hlf-channels-abcde" {
+		t.Errorf("unexpected volumes %v", volumes)
+	}
+	if *createCommon.BackoffLimit != 2 {
+		t.Errorf("backoff limit is %v, expected 2 from retryStrategy", *createCommon.BackoffLimit)
+	}
+	if createCommon.Template.Spec.ServiceAccountName != "fabric" || createCommon.Template.Spec.RestartPolicy != corev1.RestartPolicyNever {
+		t.Errorf("unexpected pod spec %v", createCommon.Template.Spec)
+	}
+
+	// parameters of items and defaults are substituted, quotes are kept
+	join := plan.Stages[2][1].Job.Template.Spec.Containers[0]
+	if args := join.Args[0]; args != `peer channel join -c common --peer "peer0.aptalkarga.tr" # Atlantis` {
+		t.Errorf("unexpected args %q", args)
+	}
+	if *plan.Stages[2][1].Job.BackoffLimit != 0 {
+		t.Errorf("backoff limit is %v, expected 0", *plan.Stages[2][1].Job.BackoffLimit)
+	}
+	log := plan.Stages[2][2].Job.Template.Spec.Containers[0]
+	if log.Command[1] != "hlf-channels-abcde in simple" {
+		t.Errorf("unexpected command %v", log.Command)
+	}
+	if step := plan.Stages[2][0].Job.Template.Annotations[flowStepAnnotation]; step != "channels.join-channels(0)" {
+		t.Errorf("step annotation of pod is %q", step)
+	}
+}
+
+// translates the workflows rendered from PIVT charts for the simple sample. PIVT charts are not in this repository,
+// they are copied in by the Dockerfile, so the test is skipped unless they are embedded or FBOP_PIVT_DIR points to PIVT
+func TestTranslatePIVTFlows(t *testing.T) {
+	if _, err := fs.Stat(localCharts(), "channel-flow/Chart.yaml"); err != nil {
+		t.Skipf("PIVT charts are not available: %v", err)
+	}
+	ctx := context.Background()
+
+	networkYaml, err := os.ReadFile("../samples/simple/fabric-network.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	network := &v1alpha1.FabricNetwork{}
+	if err := yaml.Unmarshal(networkYaml, network); err != nil {
+		t.Fatal(err)
+	}
+	network.Namespace = "pivt-test"
+	network.Spec.Configtx.Secret = validation.ConfigtxSecretName(network.Name)
+	configtx, err := os.ReadFile("../samples/simple/configtx.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: network.Namespace, Name: network.Spec.Configtx.Secret},
+		Data:       map[string][]byte{"configtx.yaml": configtx},
+	}
+	r := testReconciler(t, secret)
+
+	flows := map[string]func() (string, error){
+		"channel-flow":   func() (string, error) { return r.renderChannelFlow(ctx, network) },
+		"chaincode-flow": func() (string, error) { return r.renderChaincodeFlow(ctx, network, nil) },
+		"peer-org-flow":  func() (string, error) { return r.renderPeerOrgFlow(ctx, network) },
+	}
+	for flow, render := range flows {
+		t.Run(flow, func(t *testing.T) {
+			manifest, err := render()
+			if err != nil {
+				t.Fatal(err)
+			}
+			wfs, err := r.unmarshalWorkflows([]byte(manifest), true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			plan, scripts, err := translateWorkflow(&wfs[0], "hlf-flow-abcde", network.Namespace)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(plan.Stages) == 0 {
+				t.Fatal("plan has no stages")
+			}
+			scriptSteps := 0
+			for _, stage := range plan.Stages {
+				for _, step := range stage {
+					args := step.Job.Template.Spec.Containers[0].Args
+					for _, volume := range step.Job.Template.Spec.Volumes {
+						if volume.Name != "flow-script" {
+							continue
+						}
+						scriptSteps++
+						if len(args) == 0 || args[len(args)-1] != flowScriptDir+"/script" {
+							t.Errorf("script of step %v is not the last arg: %v", step.Name, args)
+						}
+					}
+				}
+			}
+			if scriptSteps == 0 || len(scripts) == 0 {
+				t.Errorf("%d script steps and %d scripts, expected some", scriptSteps, len(scripts))
+			}
+		})
+	}
+}
+
+func equalStages(a [][]string, b [][]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if strings.Join(a[i], ",") != strings.Join(b[i], ",") {
+			return false
+		}
+	}
+	return true
+}
+
+func TestTranslateWorkflowUnsupported(t *testing.T) {
+	tests := []struct {
+		name     string
+		old      string
+		new      string
+		contains string
+	}{
+		{
+			name:     "when",
+			old:      "      - name: log\n",
+			new:      "      - name: log\n        when: \"{{workflow.parameters.tlsEnabled}} == true\"\n",
+			contains: "when is not supported",
+		},
+		{
+			name:     "step outputs",
+			old:      "value: common-anchors",
+			new:      "value: \"{{tasks.create-common.outputs.result}}\"",
+			contains: "tasks.create-common.outputs.result",
+		},
+		{
+			name:     "unknown variable",
+			old:      "{{workflow.name}}",
+			new:      "{{workflow.uid}}",
+			contains: "workflow.uid",
+		},
+		{
+			name:     "missing input",
+			old:      "          - name: peer\n            value: \"{{item.peer}}\"\n",
+			new:      "",
+			contains: "input parameter peer is not provided",
+		},
+		{
+			name:     "dependency cycle",
+			old:      "      - name: create-common\n        template: create-channel\n",
+			new:      "      - name: create-common\n        template: create-channel\n        dependencies: [update-anchor-peers]\n",
+			contains: "dependency cycle",
+		},
+	}
+
+	r := testReconciler(t)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			manifest := strings.Replace(testFlow, test.old, test.new, 1)
+			if manifest == testFlow {
+				t.Fatal("test did not change the workflow")
+			}
+			wfs, err := r.unmarshalWorkflows([]byte(manifest), true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, _, err = translateWorkflow(&wfs[0], "hlf-channels-abcde", "simple")
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if !strings.Contains(err.Error(), test.contains) {
+				t.Errorf("error %q does not contain %q", err, test.contains)
+			}
+		})
+	}
+}
+
+// sets the condition of the Jobs of the stage
+func finishStage(t *testing.T, r *FabricNetworkReconciler, flow string, stage string, conditionType batchv1.JobConditionType) {
+	jobList := &batchv1.JobList{}
+	if err := r.List(context.Background(), jobList, client.MatchingLabels{flowLabel: flow, flowStageLabel: stage}); err != nil {
+		t.Fatal(err)
+	}
+	for i := range jobList.Items {
+		job := &jobList.Items[i]
+		job.Status.Conditions = append(job.Status.Conditions, batchv1.JobCondition{Type: conditionType, Status: corev1.ConditionTrue, Message: "BackoffLimitExceeded"})
+		if err := r.Status().Update(context.Background(), job); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func countJobs(t *testing.T, r *FabricNetworkReconciler, flow string) int {
+	jobList := &batchv1.JobList{}
+	if err := r.List(context.Background(), jobList, client.MatchingLabels{flowLabel: flow}); err != nil {
+		t.Fatal(err)
+	}
+	return len(jobList.Items)
+}
+
+func TestJobsEngine(t *testing.T) {
+	ctx := context.Background()
+	network := &v1alpha1.FabricNetwork{
+		ObjectMeta: metav1.ObjectMeta{Name: "simple", Namespace: "jobs-test"},
+		Spec:       v1alpha1.FabricNetworkSpec{FlowEngine: v1alpha1.FlowEngineJobs},
+	}
+	r := testReconciler(t, network)
+
+	name, err := r.startFlow(ctx, network, "channel-flow", renderTestFlow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(name, "hlf-channels-") {
+		t.Errorf("flow name is %v, expected generated from hlf-channels-", name)
+	}
+	if network.Status.FlowEngine != v1alpha1.FlowEngineJobs {
+		t.Errorf("flow engine in status is %v, expected Jobs", network.Status.FlowEngine)
+	}
+	network.Status.Workflow = name
+
+	// only the first stage is started
+	if count := countJobs(t, r, name); count != 1 {
+		t.Fatalf("%d Jobs, expected 1", count)
+	}
+	if status, _, err := r.getFlowStatus(ctx, network); err != nil || status != wfSubmitted {
+		t.Fatalf("status is %v %v, expected Submitted", status, err)
+	}
+
+	finishStage(t, r, name, "0", batchv1.JobComplete)
+	if status, _, err := r.getFlowStatus(ctx, network); err != nil || status != wfSubmitted {
+		t.Fatalf("status is %v %v, expected Submitted", status, err)
+	}
+	if count := countJobs(t, r, name); count != 2 {
+		t.Fatalf("%d Jobs, expected 2", count)
+	}
+
+	finishStage(t, r, name, "1", batchv1.JobComplete)
+	r.getFlowStatus(ctx, network)
+	if count := countJobs(t, r, name); count != 5 {
+		t.Fatalf("%d Jobs, expected 5", count)
+	}
+
+	finishStage(t, r, name, "2", batchv1.JobFailed)
+	status, message, err := r.getFlowStatus(ctx, network)
+	if err != nil || status != wfFailed {
+		t.Fatalf("status is %v %v, expected Failed", status, err)
+	}
+	if !strings.Contains(message, "channels.join-channels(0)") || !strings.Contains(message, "BackoffLimitExceeded") {
+		t.Errorf("message %q does not contain the failed step and reason", message)
+	}
+
+	if err := r.deleteFlows(ctx, network.Namespace, network.Name); err != nil {
+		t.Fatal(err)
+	}
+	if count := countJobs(t, r, name); count != 0 {
+		t.Errorf("%d Jobs after delete, expected 0", count)
+	}
+	configMapList := &corev1.ConfigMapList{}
+	if err := r.List(ctx, configMapList, client.InNamespace(network.Namespace)); err != nil {
+		t.Fatal(err)
+	}
+	if len(configMapList.Items) != 0 {
+		t.Errorf("%d ConfigMaps after delete, expected 0", len(configMapList.Items))
+	}
+}
+
+func TestJobsEngineCancel(t *testing.T) {
+	ctx := context.Background()
+	network := &v1alpha1.FabricNetwork{
+		ObjectMeta: metav1.ObjectMeta{Name: "simple", Namespace: "jobs-test"},
+		Spec:       v1alpha1.FabricNetworkSpec{FlowEngine: v1alpha1.FlowEngineJobs},
+	}
+	r := testReconciler(t, network)
+
+	name, err := r.startFlow(ctx, network, "channel-flow", renderTestFlow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	network.Status.State = v1alpha1.StateChannelFlowSubmitted
+	network.Status.Workflow = name
+
+	if err := r.cancelFlow(ctx, network); err != nil {
+		t.Fatal(err)
+	}
+	if count := countJobs(t, r, name); count != 0 {
+		t.Errorf("%d Jobs after cancel, expected 0", count)
+	}
+	status, message, err := r.getFlowStatus(ctx, network)
+	if err != nil || status != wfFailed {
+		t.Fatalf("status is %v %v, expected Failed", status, err)
+	}
+	if message != "Flow is cancelled" {
+		t.Errorf("unexpected message %q", message)
+	}
+}
@@ -0,0 +1,105 @@
+package controllers
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/raftAtGit/hl-fabric-operator/api/v1alpha1"
+)
+
+var (
+	networkStateGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fabric_operator_network_state",
+			Help: "Current state of FabricNetworks. Value is 1 for the current state of each FabricNetwork",
+		},
+		[]string{"namespace", "name", "state"},
+	)
+
+	flowDurationHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "fabric_operator_flow_duration_seconds",
+			Help:    "Duration of each flow attempt from submission to completion or failure, retried attempts included",
+			Buckets: []float64{30, 60, 120, 300, 600, 900, 1200, 1800, 3600},
+		},
+		[]string{"flow", "result"},
+	)
+
+	helmFailuresCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "fabric_operator_helm_failures_total",
+			Help: "Number of failed Helm actions",
+		},
+		[]string{"action"},
+	)
+
+	toolInvocationsCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "fabric_operator_tool_invocations_total",
+			Help: "Number of crypto material and genesis block generations",
+		},
+		[]string{"tool", "result"},
+	)
+)
+
+// flows keyed by the state FabricNetwork is in while the flow is running
+var flowsBySubmittedState = map[v1alpha1.State]string{
+	v1alpha1.StateChannelFlowSubmitted:   "channel-flow",
+	v1alpha1.StateChaincodeFlowSubmitted: "chaincode-flow",
+	v1alpha1.StatePeerOrgFlowSubmitted:   "peer-org-flow",
+}
+
+func init() {
+	metrics.Registry.MustRegister(networkStateGauge, flowDurationHistogram, helmFailuresCounter, toolInvocationsCounter)
+}
+
+// sets the state gauge from the current status of FabricNetwork.
+// called on every reconcile, so the gauge is also populated for FabricNetworks whose state did not change since the operator started
+func recordStateMetric(network *v1alpha1.FabricNetwork) {
+	networkStateGauge.DeletePartialMatch(prometheus.Labels{"namespace": network.Namespace, "name": network.Name})
+	networkStateGauge.WithLabelValues(network.Namespace, network.Name, string(network.Status.State)).Set(1)
+}
+
+// updates the metrics for the state transition of FabricNetwork
+func recordTransitionMetrics(network *v1alpha1.FabricNetwork, previous v1alpha1.State) {
+	recordStateMetric(network)
+
+	switch network.Status.State {
+	case v1alpha1.StateChannelFlowCompleted, v1alpha1.StateChaincodeFlowCompleted, v1alpha1.StatePeerOrgFlowCompleted:
+		observeFlowAttempt(network, previous, "completed")
+	case v1alpha1.StateFailed:
+		// failed attempts which are retried are observed by handleFailedFlow
+		observeFlowAttempt(network, previous, "failed")
+	default:
+		// state is forced, flow result is unknown
+	}
+}
+
+// observes the duration of the last attempt of the flow submitted in the state, from its submission to its completion or failure.
+// re-submitted flows reset the submission time of the state
+func observeFlowAttempt(network *v1alpha1.FabricNetwork, submittedState v1alpha1.State, result string) {
+	flow, ok := flowsBySubmittedState[submittedState]
+	if !ok {
+		return
+	}
+	submitted, ok := network.Status.PhaseTimestamps[string(submittedState)]
+	if !ok {
+		return
+	}
+	flowDurationHistogram.WithLabelValues(flow, result).Observe(time.Since(submitted.Time).Seconds())
+}
+
+// removes the metrics of a deleted FabricNetwork
+func deleteNetworkMetrics(namespace string, name string) {
+	networkStateGauge.DeletePartialMatch(prometheus.Labels{"namespace": namespace, "name": name})
+}
+
+func recordToolInvocation(tool string, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	toolInvocationsCounter.WithLabelValues(tool, result).Inc()
+}
@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/raftAtGit/hl-fabric-operator/api/v1alpha1"
+)
+
+func TestNetworkStateMetric(t *testing.T) {
+	network := &v1alpha1.FabricNetwork{ObjectMeta: metav1.ObjectMeta{Namespace: "metrics", Name: "simple"}}
+	stateValue := func(state v1alpha1.State) float64 {
+		return testutil.ToFloat64(networkStateGauge.WithLabelValues(network.Namespace, network.Name, string(state)))
+	}
+	// number of series of this FabricNetwork, WithLabelValues above creates series so counted before it
+	seriesCount := func() int {
+		return networkStateGauge.DeletePartialMatch(map[string]string{"namespace": network.Namespace, "name": network.Name})
+	}
+
+	// reconcile without a transition, i.e. after operator restart
+	network.Status.State = v1alpha1.StateReady
+	recordStateMetric(network)
+	if value := stateValue(v1alpha1.StateReady); value != 1 {
+		t.Errorf("Ready state value is %v, expected 1", value)
+	}
+
+	network.Status.State = v1alpha1.StateFailed
+	recordTransitionMetrics(network, v1alpha1.StateReady)
+	recordStateMetric(network)
+	if count := seriesCount(); count != 1 {
+		t.Errorf("FabricNetwork has %v state series, expected 1", count)
+	}
+
+	recordStateMetric(network)
+	deleteNetworkMetrics(network.Namespace, network.Name)
+	if count := seriesCount(); count != 0 {
+		t.Errorf("FabricNetwork has %v state series after delete, expected 0", count)
+	}
+}
+
+func TestRetriedFlowAttemptMetric(t *testing.T) {
+	sampleCount := func(result string) uint64 {
+		m := &dto.Metric{}
+		if err := flowDurationHistogram.WithLabelValues("channel-flow", result).(prometheus.Histogram).Write(m); err != nil {
+			t.Fatal(err)
+		}
+		return m.GetHistogram().GetSampleCount()
+	}
+	submitted := metav1.NewTime(time.Now().Add(-time.Hour))
+	network := &v1alpha1.FabricNetwork{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "metrics", Name: "retried"},
+		Spec: v1alpha1.FabricNetworkSpec{
+			FlowEngine:  v1alpha1.FlowEngineJobs,
+			RetryPolicy: &v1alpha1.RetryPolicy{MaxRetries: 2},
+		},
+		Status: v1alpha1.FabricNetworkStatus{
+			State:           v1alpha1.StateChannelFlowSubmitted,
+			Workflow:        "channel-flow-1",
+			FlowEngine:      v1alpha1.FlowEngineJobs,
+			PhaseTimestamps: map[string]metav1.Time{string(v1alpha1.StateChannelFlowSubmitted): submitted},
+		},
+	}
+	r := testReconciler(t, network)
+	failed := sampleCount("failed")
+
+	// failed attempt is retried, state does not change
+	if _, err := r.handleFailedFlow(context.Background(), network, "channel-flow channel-flow-1 failed"); err != nil {
+		t.Fatal(err)
+	}
+	if network.Status.State != v1alpha1.StateChannelFlowSubmitted || network.Status.NextRetryTime == nil {
+		t.Fatalf("flow is not retried, status is %+v", network.Status)
+	}
+	if count := sampleCount("failed"); count != failed+1 {
+		t.Errorf("failed attempts are %d, expected %d", count, failed+1)
+	}
+
+	// waiting for retry does not observe the attempt again
+	if _, err := r.handleFailedFlow(context.Background(), network, "channel-flow channel-flow-1 failed"); err != nil {
+		t.Fatal(err)
+	}
+	if count := sampleCount("failed"); count != failed+1 {
+		t.Errorf("failed attempts are %d after waiting, expected %d", count, failed+1)
+	}
+}
@@ -0,0 +1,169 @@
+package controllers
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/raftAtGit/hl-fabric-operator/api/v1alpha1"
+	"github.com/raftAtGit/hl-fabric-operator/validation"
+)
+
+// volumeClaimTemplate of a StatefulSet. StatefulSets name the claims as <volumeClaimTemplate>-<StatefulSet>-<ordinal>
+type claimTemplate struct {
+	prefix   string
+	replicas int
+}
+
+// returns the volumeClaimTemplates of the StatefulSets of the hlf-kube release of FabricNetwork
+func (r *FabricNetworkReconciler) getClaimTemplates(ctx context.Context, network *v1alpha1.FabricNetwork) ([]claimTemplate, error) {
+	releaseName := validation.HelmRelease(network)
+
+	stsList := &appsv1.StatefulSetList{}
+	if err := r.List(ctx, stsList, client.InNamespace(network.Namespace)); err != nil {
+		r.Log.Error(err, "Failed to get StatefulSetList")
+		return nil, err
+	}
+
+	templates := []claimTemplate{}
+	for _, sts := range stsList.Items {
+		if sts.Annotations["meta.helm.sh/release-name"] != releaseName {
+			continue
+		}
+		replicas := 1
+		if sts.Spec.Replicas != nil {
+			replicas = int(*sts.Spec.Replicas)
+		}
+		for _, template := range sts.Spec.VolumeClaimTemplates {
+			templates = append(templates, claimTemplate{
+				prefix:   template.Name + "-" + sts.Name + "-",
+				replicas: replicas,
+			})
+		}
+	}
+	return templates, nil
+}
+
+// returns the PersistentVolumeClaims of FabricNetwork. Claims of current StatefulSets are labeled first,
+// so they can still be found after their StatefulSets are removed
+func (r *FabricNetworkReconciler) getNetworkPVCs(ctx context.Context, network *v1alpha1.FabricNetwork, templates []claimTemplate) ([]corev1.PersistentVolumeClaim, error) {
+	pvcList := &corev1.PersistentVolumeClaimList{}
+	if err := r.List(ctx, pvcList, client.InNamespace(network.Namespace)); err != nil {
+		r.Log.Error(err, "Failed to get PersistentVolumeClaimList")
+		return nil, err
+	}
+
+	pvcs := []corev1.PersistentVolumeClaim{}
+	for _, pvc := range pvcList.Items {
+		if pvc.Labels["raft.io/fabric-operator-created-for"] != network.Name {
+			if _, ok := matchClaimTemplate(pvc.Name, templates); !ok {
+				continue
+			}
+			if pvc.Labels == nil {
+				pvc.Labels = make(map[string]string)
+			}
+			pvc.Labels["raft.io/fabric-operator-created-for"] = network.Name
+			if err := r.Update(ctx, &pvc); err != nil {
+				r.Log.Error(err, "Failed to label PersistentVolumeClaim", "name", pvc.Name)
+				return nil, err
+			}
+		}
+		pvcs = append(pvcs, pvc)
+	}
+	r.Log.Info("Got PersistentVolumeClaims of FabricNetwork", "count", len(pvcs))
+
+	return pvcs, nil
+}
+
+// labels the PersistentVolumeClaims of the current StatefulSets of FabricNetwork. called before upgrading the Helm release,
+// which may remove StatefulSets of removed peers and organizations, so their claims can still be found by syncPVCs
+func (r *FabricNetworkReconciler) labelPVCs(ctx context.Context, network *v1alpha1.FabricNetwork) error {
+	templates, err := r.getClaimTemplates(ctx, network)
+	if err != nil {
+		return err
+	}
+	_, err = r.getNetworkPVCs(ctx, network, templates)
+	return err
+}
+
+// finds the PersistentVolumeClaims of removed peers and organizations.
+// deletes them or reports them in status according to scaleDownPolicy
+func (r *FabricNetworkReconciler) syncPVCs(ctx context.Context, network *v1alpha1.FabricNetwork) error {
+	templates, err := r.getClaimTemplates(ctx, network)
+	if err != nil {
+		return err
+	}
+	pvcs, err := r.getNetworkPVCs(ctx, network, templates)
+	if err != nil {
+		return err
+	}
+
+	orphaned := []corev1.PersistentVolumeClaim{}
+	for _, pvc := range pvcs {
+		if template, ok := matchClaimTemplate(pvc.Name, templates); ok {
+			if ordinal, _ := pvcOrdinal(pvc.Name, template.prefix); ordinal < template.replicas {
+				continue
+			}
+		}
+		orphaned = append(orphaned, pvc)
+	}
+
+	if network.Spec.ScaleDownPolicy == v1alpha1.DeletionPolicyDelete {
+		if err := r.deletePVCs(ctx, orphaned); err != nil {
+			return err
+		}
+		if len(orphaned) != 0 {
+			r.Recorder.Eventf(network, corev1.EventTypeNormal, "PVCsDeleted", "Deleted %d PersistentVolumeClaim(s) of removed peers and organizations", len(orphaned))
+		}
+		network.Status.OrphanedPVCs = nil
+		return nil
+	}
+
+	names := []string{}
+	for _, pvc := range orphaned {
+		names = append(names, pvc.Name)
+	}
+	if len(names) != 0 {
+		r.Log.Info("Found orphaned PersistentVolumeClaims, retaining them", "names", names)
+		network.Status.OrphanedPVCs = names
+	} else {
+		network.Status.OrphanedPVCs = nil
+	}
+	return nil
+}
+
+func (r *FabricNetworkReconciler) deletePVCs(ctx context.Context, pvcs []corev1.PersistentVolumeClaim) error {
+	for i := range pvcs {
+		if err := r.Delete(ctx, &pvcs[i]); client.IgnoreNotFound(err) != nil {
+			r.Log.Error(err, "Failed to delete PersistentVolumeClaim", "name", pvcs[i].Name)
+			return err
+		}
+		r.Log.Info("deleted PersistentVolumeClaim", "name", pvcs[i].Name)
+	}
+	return nil
+}
+
+func matchClaimTemplate(name string, templates []claimTemplate) (claimTemplate, bool) {
+	for _, template := range templates {
+		if _, ok := pvcOrdinal(name, template.prefix); ok {
+			return template, true
+		}
+	}
+	return claimTemplate{}, false
+}
+
+// returns the ordinal of the claim if its name is the prefix followed by a number
+func pvcOrdinal(name string, prefix string) (int, bool) {
+	if !strings.HasPrefix(name, prefix) {
+		return 0, false
+	}
+	ordinal, err := strconv.Atoi(strings.TrimPrefix(name, prefix))
+	if err != nil {
+		return 0, false
+	}
+	return ordinal, true
+}
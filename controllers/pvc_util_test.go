@@ -0,0 +1,58 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/raftAtGit/hl-fabric-operator/api/v1alpha1"
+	"github.com/raftAtGit/hl-fabric-operator/validation"
+)
+
+func TestLabelPVCsBeforeUpgrade(t *testing.T) {
+	ctx := context.Background()
+	network := &v1alpha1.FabricNetwork{ObjectMeta: metav1.ObjectMeta{Name: "simple", Namespace: "pvc-test"}}
+	replicas := int32(1)
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "hlf-peer--karga--peer1",
+			Namespace:   network.Namespace,
+			Annotations: map[string]string{"meta.helm.sh/release-name": validation.HelmRelease(network)},
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas:             &replicas,
+			VolumeClaimTemplates: []corev1.PersistentVolumeClaim{{ObjectMeta: metav1.ObjectMeta{Name: "peer-disk"}}},
+		},
+	}
+	pvc := func(name string) *corev1.PersistentVolumeClaim {
+		return &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: network.Namespace}}
+	}
+	r := testReconciler(t, network, sts, pvc("peer-disk-hlf-peer--karga--peer1-0"), pvc("data-other-0"))
+
+	if err := r.labelPVCs(ctx, network); err != nil {
+		t.Fatal(err)
+	}
+	labeled := &corev1.PersistentVolumeClaim{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: network.Namespace, Name: "peer-disk-hlf-peer--karga--peer1-0"}, labeled); err != nil {
+		t.Fatal(err)
+	}
+	if labeled.Labels["raft.io/fabric-operator-created-for"] != network.Name {
+		t.Errorf("claim of StatefulSet is not labeled: %v", labeled.Labels)
+	}
+
+	// upgrade removes the StatefulSet of the removed peer, its claim is still found
+	if err := r.Delete(ctx, sts); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.syncPVCs(ctx, network); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"peer-disk-hlf-peer--karga--peer1-0"}; !reflect.DeepEqual(network.Status.OrphanedPVCs, expected) {
+		t.Errorf("orphaned claims are %v, expected %v", network.Status.OrphanedPVCs, expected)
+	}
+}
@@ -0,0 +1,275 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/raftAtGit/hl-fabric-operator/api/v1alpha1"
+)
+
+// Fabric component types, keyed by the name prefix PIVT charts use
+var componentTypesByPrefix = []struct {
+	prefix        string
+	componentType string
+}{
+	{"hlf-orderer--", "orderer"},
+	{"hlf-peer--", "peer"},
+	{"hlf-couchdb--", "couchdb"},
+	{"hlf-ca--", "ca"},
+}
+
+// returns the readiness of StatefulSets and Deployments of the Helm release, including Kafka and ZooKeeper of Kafka orderers.
+// readiness is rollout aware, a component is ready only when its controller observed the latest generation,
+// all replicas are updated and the pods of the latest revision are actually ready. Pods are not watched, so they are
+// listed with podReader which should be uncached, a cached one would start an informer for Pods in all namespaces
+func getComponentStatuses(ctx context.Context, c client.Reader, podReader client.Reader, namespace string, releaseName string) ([]v1alpha1.ComponentStatus, error) {
+	components := []v1alpha1.ComponentStatus{}
+
+	stsList := &appsv1.StatefulSetList{}
+	if err := c.List(ctx, stsList, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+	for i := range stsList.Items {
+		sts := &stsList.Items[i]
+		if sts.Annotations["meta.helm.sh/release-name"] != releaseName {
+			continue
+		}
+		pods, err := listPods(ctx, podReader, namespace, sts.Spec.Selector)
+		if err != nil {
+			return nil, err
+		}
+		components = append(components, statefulSetStatus(sts, pods))
+	}
+
+	deployList := &appsv1.DeploymentList{}
+	if err := c.List(ctx, deployList, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+	for i := range deployList.Items {
+		deploy := &deployList.Items[i]
+		if deploy.Annotations["meta.helm.sh/release-name"] != releaseName {
+			continue
+		}
+		pods, err := listPods(ctx, podReader, namespace, deploy.Spec.Selector)
+		if err != nil {
+			return nil, err
+		}
+		components = append(components, deploymentStatus(deploy, pods))
+	}
+
+	return components, nil
+}
+
+func listPods(ctx context.Context, c client.Reader, namespace string, labelSelector *metav1.LabelSelector) ([]corev1.Pod, error) {
+	selector, err := metav1.LabelSelectorAsSelector(labelSelector)
+	if err != nil {
+		return nil, err
+	}
+	podList := &corev1.PodList{}
+	if err := c.List(ctx, podList, client.InNamespace(namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, err
+	}
+	return podList.Items, nil
+}
+
+// rollout aware readiness of a StatefulSet, similar to kubectl rollout status
+func statefulSetStatus(sts *appsv1.StatefulSet, pods []corev1.Pod) v1alpha1.ComponentStatus {
+	replicas := replicasOf(sts.Spec.Replicas)
+	status := v1alpha1.ComponentStatus{
+		Kind:          "StatefulSet",
+		Name:          sts.Name,
+		Type:          componentType(sts.Name, sts.Labels),
+		Replicas:      replicas,
+		ReadyReplicas: sts.Status.ReadyReplicas,
+	}
+
+	rollingUpdate := sts.Spec.UpdateStrategy.Type == "" || sts.Spec.UpdateStrategy.Type == appsv1.RollingUpdateStatefulSetStrategyType
+	partition := int32(0)
+	if rollingUpdate && sts.Spec.UpdateStrategy.RollingUpdate != nil && sts.Spec.UpdateStrategy.RollingUpdate.Partition != nil {
+		partition = *sts.Spec.UpdateStrategy.RollingUpdate.Partition
+	}
+
+	switch {
+	case sts.Status.ObservedGeneration < sts.Generation:
+		status.Message = fmt.Sprintf("waiting for generation %d to be observed", sts.Generation)
+		return status
+	case rollingUpdate && sts.Status.UpdatedReplicas < replicas-partition:
+		status.Message = fmt.Sprintf("%d of %d replicas updated", sts.Status.UpdatedReplicas, replicas-partition)
+		return status
+	case sts.Status.ReadyReplicas < replicas:
+		status.Message = fmt.Sprintf("%d of %d replicas ready", sts.Status.ReadyReplicas, replicas)
+		return status
+	case sts.Status.Replicas > replicas:
+		status.Message = fmt.Sprintf("%d extra replicas are terminating", sts.Status.Replicas-replicas)
+		return status
+	}
+
+	// status of StatefulSet lags behind the pods, for example when a container is restarting
+	revision := ""
+	if rollingUpdate && partition == 0 {
+		revision = sts.Status.UpdateRevision
+	}
+	readyPods, reason := readyPodCount(pods, appsv1.StatefulSetRevisionLabel, revision)
+	if readyPods < replicas {
+		status.ReadyReplicas = readyPods
+		status.Message = fmt.Sprintf("%d of %d pods ready", readyPods, replicas)
+		if reason != "" {
+			status.Message += ", " + reason
+		}
+		return status
+	}
+
+	status.Ready = true
+	return status
+}
+
+// rollout aware readiness of a Deployment, similar to kubectl rollout status
+func deploymentStatus(deploy *appsv1.Deployment, pods []corev1.Pod) v1alpha1.ComponentStatus {
+	replicas := replicasOf(deploy.Spec.Replicas)
+	status := v1alpha1.ComponentStatus{
+		Kind:          "Deployment",
+		Name:          deploy.Name,
+		Type:          componentType(deploy.Name, deploy.Labels),
+		Replicas:      replicas,
+		ReadyReplicas: deploy.Status.ReadyReplicas,
+	}
+
+	for _, c := range deploy.Status.Conditions {
+		if c.Type == appsv1.DeploymentProgressing && c.Reason == "ProgressDeadlineExceeded" {
+			status.Message = "rollout exceeded its progress deadline"
+			return status
+		}
+	}
+
+	switch {
+	case deploy.Status.ObservedGeneration < deploy.Generation:
+		status.Message = fmt.Sprintf("waiting for generation %d to be observed", deploy.Generation)
+		return status
+	case deploy.Status.UpdatedReplicas < replicas:
+		status.Message = fmt.Sprintf("%d of %d replicas updated", deploy.Status.UpdatedReplicas, replicas)
+		return status
+	case deploy.Status.Replicas > deploy.Status.UpdatedReplicas:
+		status.Message = fmt.Sprintf("%d old replicas are terminating", deploy.Status.Replicas-deploy.Status.UpdatedReplicas)
+		return status
+	case deploy.Status.AvailableReplicas < deploy.Status.UpdatedReplicas:
+		status.Message = fmt.Sprintf("%d of %d updated replicas available", deploy.Status.AvailableReplicas, deploy.Status.UpdatedReplicas)
+		return status
+	}
+
+	readyPods, reason := readyPodCount(pods, "", "")
+	if readyPods < replicas {
+		status.ReadyReplicas = readyPods
+		status.Message = fmt.Sprintf("%d of %d pods ready", readyPods, replicas)
+		if reason != "" {
+			status.Message += ", " + reason
+		}
+		return status
+	}
+
+	status.Ready = true
+	return status
+}
+
+// returns the number of ready pods which are not terminating and are of the given revision if any,
+// and the reason of the first not ready pod
+func readyPodCount(pods []corev1.Pod, revisionLabel string, revision string) (int32, string) {
+	ready := int32(0)
+	reason := ""
+	for i := range pods {
+		pod := &pods[i]
+		podReason := ""
+		switch {
+		case pod.DeletionTimestamp != nil:
+			podReason = fmt.Sprintf("Pod %v is terminating", pod.Name)
+		case revision != "" && pod.Labels[revisionLabel] != revision:
+			podReason = fmt.Sprintf("Pod %v is not updated", pod.Name)
+		case !isPodReady(pod):
+			podReason = fmt.Sprintf("Pod %v is not ready", pod.Name)
+			if waiting := waitingReason(pod); waiting != "" {
+				podReason += ": " + waiting
+			}
+		default:
+			ready++
+		}
+		if reason == "" {
+			reason = podReason
+		}
+	}
+	return ready, reason
+}
+
+func isPodReady(pod *corev1.Pod) bool {
+	if pod.Status.Phase != corev1.PodRunning {
+		return false
+	}
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// returns why a container of the pod is waiting, like CrashLoopBackOff
+func waitingReason(pod *corev1.Pod) string {
+	for _, c := range pod.Status.ContainerStatuses {
+		if c.State.Waiting != nil && c.State.Waiting.Reason != "" {
+			return fmt.Sprintf("container %v is in %v", c.Name, c.State.Waiting.Reason)
+		}
+	}
+	return ""
+}
+
+// returns the Fabric component type of the StatefulSet or Deployment.
+// Kafka and ZooKeeper come from their own sub-charts, so they are detected by the app label
+func componentType(name string, labels map[string]string) string {
+	switch app := labels["app"]; app {
+	case "kafka", "zookeeper":
+		return app
+	}
+	for _, t := range componentTypesByPrefix {
+		if strings.HasPrefix(name, t.prefix) {
+			return t.componentType
+		}
+	}
+	switch {
+	case strings.Contains(name, "kafka"):
+		return "kafka"
+	case strings.Contains(name, "zookeeper"):
+		return "zookeeper"
+	}
+	return ""
+}
+
+func componentsReady(components []v1alpha1.ComponentStatus) bool {
+	for _, c := range components {
+		if !c.Ready {
+			return false
+		}
+	}
+	return true
+}
+
+// returns a summary of components which are not ready
+func notReadyComponents(components []v1alpha1.ComponentStatus) []string {
+	notReady := []string{}
+	for _, c := range components {
+		if !c.Ready {
+			notReady = append(notReady, fmt.Sprintf("%v %v: %v", c.Kind, c.Name, c.Message))
+		}
+	}
+	return notReady
+}
+
+func replicasOf(replicas *int32) int32 {
+	if replicas == nil {
+		return 1
+	}
+	return *replicas
+}
@@ -0,0 +1,318 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+const (
+	testNamespace = "default"
+	testRelease   = "hlf-kube--simple"
+	testRevision  = "rev-2"
+)
+
+func int32Ptr(i int32) *int32 {
+	return &i
+}
+
+func newStatefulSet(name string, labels map[string]string, replicas int32, mutate func(*appsv1.StatefulSet)) *appsv1.StatefulSet {
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   testNamespace,
+			Generation:  2,
+			Labels:      labels,
+			Annotations: map[string]string{"meta.helm.sh/release-name": testRelease},
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas: int32Ptr(replicas),
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"name": name}},
+		},
+		Status: appsv1.StatefulSetStatus{
+			ObservedGeneration: 2,
+			Replicas:           replicas,
+			ReadyReplicas:      replicas,
+			UpdatedReplicas:    replicas,
+			CurrentRevision:    testRevision,
+			UpdateRevision:     testRevision,
+		},
+	}
+	if mutate != nil {
+		mutate(sts)
+	}
+	return sts
+}
+
+func newDeployment(name string, replicas int32, mutate func(*appsv1.Deployment)) *appsv1.Deployment {
+	deploy := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   testNamespace,
+			Generation:  3,
+			Annotations: map[string]string{"meta.helm.sh/release-name": testRelease},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: int32Ptr(replicas),
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"name": name}},
+		},
+		Status: appsv1.DeploymentStatus{
+			ObservedGeneration: 3,
+			Replicas:           replicas,
+			ReadyReplicas:      replicas,
+			UpdatedReplicas:    replicas,
+			AvailableReplicas:  replicas,
+		},
+	}
+	if mutate != nil {
+		mutate(deploy)
+	}
+	return deploy
+}
+
+func newPod(name string, owner string, ready bool, mutate func(*corev1.Pod)) *corev1.Pod {
+	readyStatus := corev1.ConditionFalse
+	if ready {
+		readyStatus = corev1.ConditionTrue
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: testNamespace,
+			Labels: map[string]string{
+				"name":                          owner,
+				appsv1.StatefulSetRevisionLabel: testRevision,
+			},
+		},
+		Status: corev1.PodStatus{
+			Phase:      corev1.PodRunning,
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: readyStatus}},
+		},
+	}
+	if mutate != nil {
+		mutate(pod)
+	}
+	return pod
+}
+
+func getTestComponentStatuses(t *testing.T, objects ...client.Object) map[string]string {
+	t.Helper()
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(objects...).Build()
+	components, err := getComponentStatuses(context.Background(), c, c, testNamespace, testRelease)
+	if err != nil {
+		t.Fatalf("getComponentStatuses failed: %v", err)
+	}
+	// component name to message, empty message means ready
+	result := map[string]string{}
+	for _, component := range components {
+		if component.Ready != (component.Message == "") {
+			t.Errorf("%v: ready is %v but message is %q", component.Name, component.Ready, component.Message)
+		}
+		result[component.Name] = component.Message
+	}
+	return result
+}
+
+func TestComponentStatusesAllReady(t *testing.T) {
+	statuses := getTestComponentStatuses(t,
+		newStatefulSet("hlf-peer--atlantis--peer0", nil, 1, nil),
+		newPod("hlf-peer--atlantis--peer0-0", "hlf-peer--atlantis--peer0", true, nil),
+		newDeployment("hlf-ca--atlantis", 1, nil),
+		newPod("hlf-ca--atlantis-abc", "hlf-ca--atlantis", true, nil),
+	)
+	if len(statuses) != 2 {
+		t.Fatalf("expected 2 components, got %v", statuses)
+	}
+	for name, message := range statuses {
+		if message != "" {
+			t.Errorf("%v should be ready, got %q", name, message)
+		}
+	}
+}
+
+func TestComponentStatusesIgnoresOtherReleases(t *testing.T) {
+	other := newStatefulSet("hlf-peer--other--peer0", nil, 1, func(sts *appsv1.StatefulSet) {
+		sts.Annotations["meta.helm.sh/release-name"] = "hlf-kube--other"
+		sts.Status.ReadyReplicas = 0
+	})
+	statuses := getTestComponentStatuses(t, other)
+	if len(statuses) != 0 {
+		t.Errorf("expected no components, got %v", statuses)
+	}
+}
+
+func TestStatefulSetReadiness(t *testing.T) {
+	const name = "hlf-orderer--groeifabriek--orderer0"
+	tests := []struct {
+		description string
+		mutate      func(*appsv1.StatefulSet)
+		pods        []client.Object
+		expected    string
+	}{
+		{
+			description: "generation not observed yet",
+			mutate:      func(sts *appsv1.StatefulSet) { sts.Status.ObservedGeneration = 1 },
+			pods:        []client.Object{newPod(name+"-0", name, true, nil)},
+			expected:    "waiting for generation 2 to be observed",
+		},
+		{
+			description: "rollout not started",
+			mutate:      func(sts *appsv1.StatefulSet) { sts.Status.UpdatedReplicas = 0 },
+			pods:        []client.Object{newPod(name+"-0", name, true, nil)},
+			expected:    "0 of 1 replicas updated",
+		},
+		{
+			description: "ready replicas missing",
+			mutate:      func(sts *appsv1.StatefulSet) { sts.Status.ReadyReplicas = 0 },
+			pods:        []client.Object{newPod(name+"-0", name, true, nil)},
+			expected:    "0 of 1 replicas ready",
+		},
+		{
+			description: "pod restarting while status still reports ready",
+			pods: []client.Object{newPod(name+"-0", name, false, func(pod *corev1.Pod) {
+				pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+					Name:  "orderer",
+					State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+				}}
+			})},
+			expected: "0 of 1 pods ready, Pod " + name + "-0 is not ready: container orderer is in CrashLoopBackOff",
+		},
+		{
+			description: "pod of old revision",
+			pods: []client.Object{newPod(name+"-0", name, true, func(pod *corev1.Pod) {
+				pod.Labels[appsv1.StatefulSetRevisionLabel] = "rev-1"
+			})},
+			expected: "0 of 1 pods ready, Pod " + name + "-0 is not updated",
+		},
+		{
+			description: "pod terminating",
+			pods: []client.Object{newPod(name+"-0", name, true, func(pod *corev1.Pod) {
+				now := metav1.Now()
+				pod.DeletionTimestamp = &now
+				pod.Finalizers = []string{"test"}
+			})},
+			expected: "0 of 1 pods ready, Pod " + name + "-0 is terminating",
+		},
+		{
+			description: "partitioned rollout does not require latest revision",
+			mutate: func(sts *appsv1.StatefulSet) {
+				sts.Spec.UpdateStrategy.RollingUpdate = &appsv1.RollingUpdateStatefulSetStrategy{Partition: int32Ptr(1)}
+				sts.Status.UpdatedReplicas = 0
+			},
+			pods: []client.Object{newPod(name+"-0", name, true, func(pod *corev1.Pod) {
+				pod.Labels[appsv1.StatefulSetRevisionLabel] = "rev-1"
+			})},
+			expected: "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			objects := append([]client.Object{newStatefulSet(name, nil, 1, test.mutate)}, test.pods...)
+			statuses := getTestComponentStatuses(t, objects...)
+			if statuses[name] != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, statuses[name])
+			}
+		})
+	}
+}
+
+func TestDeploymentReadiness(t *testing.T) {
+	const name = "hlf-ca--atlantis"
+	tests := []struct {
+		description string
+		mutate      func(*appsv1.Deployment)
+		ready       bool
+		expected    string
+	}{
+		{
+			description: "generation not observed yet",
+			mutate:      func(deploy *appsv1.Deployment) { deploy.Status.ObservedGeneration = 2 },
+			ready:       true,
+			expected:    "waiting for generation 3 to be observed",
+		},
+		{
+			description: "old replicas not terminated",
+			mutate:      func(deploy *appsv1.Deployment) { deploy.Status.Replicas = 2 },
+			ready:       true,
+			expected:    "1 old replicas are terminating",
+		},
+		{
+			description: "updated replicas not available",
+			mutate:      func(deploy *appsv1.Deployment) { deploy.Status.AvailableReplicas = 0 },
+			ready:       true,
+			expected:    "0 of 1 updated replicas available",
+		},
+		{
+			description: "progress deadline exceeded",
+			mutate: func(deploy *appsv1.Deployment) {
+				deploy.Status.Conditions = []appsv1.DeploymentCondition{{
+					Type:   appsv1.DeploymentProgressing,
+					Status: corev1.ConditionFalse,
+					Reason: "ProgressDeadlineExceeded",
+				}}
+			},
+			ready:    true,
+			expected: "rollout exceeded its progress deadline",
+		},
+		{
+			description: "pod not ready while status still reports ready",
+			ready:       false,
+			expected:    "0 of 1 pods ready, Pod " + name + "-abc is not ready",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			statuses := getTestComponentStatuses(t,
+				newDeployment(name, 1, test.mutate),
+				newPod(name+"-abc", name, test.ready, nil),
+			)
+			if statuses[name] != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, statuses[name])
+			}
+		})
+	}
+}
+
+func TestKafkaComponents(t *testing.T) {
+	kafka := newStatefulSet("hlf-kube--simple-kafka", map[string]string{"app": "kafka"}, 2, func(sts *appsv1.StatefulSet) {
+		sts.Status.ReadyReplicas = 1
+	})
+	zookeeper := newStatefulSet("hlf-kube--simple-zookeeper", map[string]string{"app": "zookeeper"}, 1, nil)
+
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+		kafka, zookeeper,
+		newPod("hlf-kube--simple-zookeeper-0", "hlf-kube--simple-zookeeper", true, nil),
+	).Build()
+	components, err := getComponentStatuses(context.Background(), c, c, testNamespace, testRelease)
+	if err != nil {
+		t.Fatalf("getComponentStatuses failed: %v", err)
+	}
+	if len(components) != 2 {
+		t.Fatalf("expected 2 components, got %v", components)
+	}
+
+	types := map[string]string{}
+	for _, component := range components {
+		types[component.Name] = component.Type
+	}
+	if types[kafka.Name] != "kafka" || types[zookeeper.Name] != "zookeeper" {
+		t.Errorf("Kafka and ZooKeeper types are not detected: %v", types)
+	}
+
+	if componentsReady(components) {
+		t.Errorf("components should not be ready while Kafka is not ready")
+	}
+	notReady := notReadyComponents(components)
+	if len(notReady) != 1 || !strings.HasPrefix(notReady[0], "StatefulSet "+kafka.Name+": 1 of 2 replicas ready") {
+		t.Errorf("unexpected not ready components: %v", notReady)
+	}
+}
@@ -0,0 +1,366 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/releaseutil"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/yaml"
+
+	"github.com/raftAtGit/hl-fabric-operator/api/v1alpha1"
+	"github.com/raftAtGit/hl-fabric-operator/validation"
+)
+
+// default timeout of atomic Helm actions and pending Helm releases
+const defaultHelmTimeout = 10 * time.Minute
+
+// at most this many drifted resources are reported in status
+const maxReportedDrift = 10
+
+func helmTimeout(network *v1alpha1.FabricNetwork) time.Duration {
+	if network.Spec.Helm.Timeout != nil {
+		return network.Spec.Helm.Timeout.Duration
+	}
+	return defaultHelmTimeout
+}
+
+// returns true if the hlf-kube Helm release should exist in the current state of FabricNetwork
+func releaseExpected(state v1alpha1.State) bool {
+	switch state {
+	case "", v1alpha1.StateNew, v1alpha1.StateInvalid, v1alpha1.StateRejected, v1alpha1.StateFailed:
+		return false
+	}
+	return true
+}
+
+// inspects the hlf-kube Helm release before any state transition. returns false if FabricNetwork should not continue,
+// either because the release is being recovered from a pending state or it's failed
+func (r *FabricNetworkReconciler) checkHelmRelease(ctx context.Context, network *v1alpha1.FabricNetwork) (bool, ctrl.Result, error) {
+	_, actionConfig, err := r.initHelmClient(network.Namespace)
+	if err != nil {
+		return false, ctrl.Result{}, err
+	}
+
+	releaseName := validation.HelmRelease(network)
+	rel, err := action.NewStatus(actionConfig).Run(releaseName)
+	if err != nil {
+		if !strings.Contains(err.Error(), "release: not found") {
+			r.Log.Error(err, "Failed to get Helm release status", "name", releaseName)
+			return false, ctrl.Result{}, err
+		}
+		r.Log.Info("Helm release is not found", "name", releaseName)
+		network.Status.HelmReleaseStatus = ""
+		network.Status.HelmReleaseRevision = 0
+		network.Status.FailedState = v1alpha1.StateNew
+		return false, ctrl.Result{}, r.saveStatus(ctx, network, v1alpha1.FabricNetworkStatus{
+			State:   v1alpha1.StateFailed,
+			Message: fmt.Sprintf("Helm release %v is not found, resume to install it again", releaseName),
+		})
+	}
+
+	status := rel.Info.Status
+	if network.Status.HelmReleaseStatus != status.String() || network.Status.HelmReleaseRevision != int32(rel.Version) {
+		network.Status.HelmReleaseStatus = status.String()
+		network.Status.HelmReleaseRevision = int32(rel.Version)
+		if err := r.Status().Update(ctx, network); err != nil {
+			r.Log.Error(err, "Unable to update FabricNetwork status")
+			return false, ctrl.Result{}, err
+		}
+	}
+
+	switch {
+	case status == release.StatusDeployed:
+		return true, ctrl.Result{}, nil
+
+	case status.IsPending():
+		timeout := helmTimeout(network)
+		if pending := time.Since(rel.Info.LastDeployed.Time); pending < timeout {
+			r.Log.Info("Helm release is in a pending state, waiting", "name", releaseName, "status", status, "for", pending)
+			return false, ctrl.Result{RequeueAfter: timeout - pending}, nil
+		}
+		if err := r.recoverPendingRelease(network, actionConfig, rel); err != nil {
+			return false, ctrl.Result{}, err
+		}
+		// upgrade again to apply the desired state
+		state := v1alpha1.StateHelmChartNeedsUpdate
+		if network.Status.State == v1alpha1.StateHelmChartNeedsDoubleUpdate {
+			state = network.Status.State
+		}
+		return false, ctrl.Result{}, r.saveStatus(ctx, network, v1alpha1.FabricNetworkStatus{
+			State:   state,
+			Message: fmt.Sprintf("Recovered Helm release %v from %v", releaseName, status),
+		})
+
+	default:
+		failedState := releaseFailedState(status)
+		if failedState == v1alpha1.StateHelmChartNeedsUpdate {
+			switch network.Status.State {
+			case v1alpha1.StateHelmChartNeedsUpdate, v1alpha1.StateHelmChartNeedsDoubleUpdate:
+				// upgrading a failed or superseded release is fine
+				return true, ctrl.Result{}, nil
+			}
+		}
+		r.Log.Info("Helm release cannot be continued", "name", releaseName, "status", status, "description", rel.Info.Description)
+		var message string
+		switch {
+		case status == release.StatusFailed:
+			message = fmt.Sprintf("Helm release %v revision %d failed: %v", releaseName, rel.Version, rel.Info.Description)
+		case failedState == v1alpha1.StateHelmChartNeedsUpdate:
+			message = fmt.Sprintf("Helm release %v revision %d is %v, resume to upgrade it again", releaseName, rel.Version, status)
+		default:
+			message = fmt.Sprintf("Helm release %v revision %d is %v, uninstall it and resume to install it again", releaseName, rel.Version, status)
+		}
+		network.Status.FailedState = failedState
+		return false, ctrl.Result{}, r.saveStatus(ctx, network, v1alpha1.FabricNetworkStatus{
+			State:   v1alpha1.StateFailed,
+			Message: message,
+		})
+	}
+}
+
+// returns the state FabricNetwork resumes from when the hlf-kube Helm release is neither deployed nor pending.
+// failed and superseded releases can be upgraded, uninstalling, uninstalled and unknown ones should be installed again
+func releaseFailedState(status release.Status) v1alpha1.State {
+	switch status {
+	case release.StatusFailed, release.StatusSuperseded:
+		return v1alpha1.StateHelmChartNeedsUpdate
+	}
+	return v1alpha1.StateNew
+}
+
+// recovers a Helm release stuck in a pending state, most probably because Fabric Operator is restarted during a Helm action.
+// rolls back to the last deployed revision if there is one, otherwise marks the release as failed so it can be upgraded
+func (r *FabricNetworkReconciler) recoverPendingRelease(network *v1alpha1.FabricNetwork, actionConfig *action.Configuration, rel *release.Release) error {
+	history, err := action.NewHistory(actionConfig).Run(rel.Name)
+	if err != nil {
+		r.Log.Error(err, "Failed to get Helm release history", "name", rel.Name)
+		return err
+	}
+	releaseutil.Reverse(history, releaseutil.SortByRevision)
+
+	for _, h := range history {
+		if h.Version >= rel.Version || h.Info.Status != release.StatusDeployed {
+			continue
+		}
+		client := action.NewRollback(actionConfig)
+		client.Version = h.Version
+		client.Wait = network.Spec.Helm.Atomic
+		client.Timeout = helmTimeout(network)
+
+		r.Log.Info("Rolling back pending Helm release", "name", rel.Name, "status", rel.Info.Status, "to", h.Version)
+		if err := client.Run(rel.Name); err != nil {
+			helmFailuresCounter.WithLabelValues("rollback").Inc()
+			r.Recorder.Eventf(network, corev1.EventTypeWarning, "HelmRollbackFailed", "Rolling back Helm release %v to revision %d failed: %v", rel.Name, h.Version, err)
+			return err
+		}
+		r.Recorder.Eventf(network, corev1.EventTypeWarning, "HelmReleaseRecovered", "Helm release %v was stuck in %v, rolled back to revision %d", rel.Name, rel.Info.Status, h.Version)
+		return nil
+	}
+
+	pendingStatus := rel.Info.Status
+	r.Log.Info("No deployed revision to roll back, marking Helm release as failed", "name", rel.Name, "status", pendingStatus)
+	rel.SetStatus(release.StatusFailed, fmt.Sprintf("Marked as failed by Fabric Operator, was stuck in %v", pendingStatus))
+	if err := actionConfig.Releases.Update(rel); err != nil {
+		return err
+	}
+	r.Recorder.Eventf(network, corev1.EventTypeWarning, "HelmReleaseRecovered", "Helm release %v was stuck in %v, marked as failed", rel.Name, pendingStatus)
+	return nil
+}
+
+// detects out of band changes to the resources of the hlf-kube Helm release. changes are reported in status,
+// and reverted if the drift policy is Revert. returns true if the reported drift changed
+func (r *FabricNetworkReconciler) checkHelmDrift(ctx context.Context, network *v1alpha1.FabricNetwork) (bool, error) {
+	_, actionConfig, err := r.initHelmClient(network.Namespace)
+	if err != nil {
+		return false, err
+	}
+	releaseName := validation.HelmRelease(network)
+	rel, err := action.NewGet(actionConfig).Run(releaseName)
+	if err != nil {
+		r.Log.Error(err, "Failed to get Helm release", "name", releaseName)
+		return false, err
+	}
+
+	drift, err := r.getDrift(ctx, network.Namespace, rel.Manifest)
+	if err != nil {
+		return false, err
+	}
+
+	if len(drift) != 0 && network.Spec.Helm.DriftPolicy == v1alpha1.DriftPolicyRevert {
+		r.Log.Info("Reverting out of band changes to Helm release", "name", releaseName, "drift", drift)
+		client := action.NewUpgrade(actionConfig)
+		client.Namespace = network.Namespace
+		client.Wait = network.Spec.Helm.Atomic
+		client.Atomic = network.Spec.Helm.Atomic
+		client.Timeout = helmTimeout(network)
+		if _, err := client.Run(releaseName, rel.Chart, rel.Config); err != nil {
+			helmFailuresCounter.WithLabelValues("revert").Inc()
+			r.Recorder.Eventf(network, corev1.EventTypeWarning, "HelmRevertFailed", "Reverting out of band changes to Helm release %v failed: %v", releaseName, err)
+			return false, err
+		}
+		r.Recorder.Eventf(network, corev1.EventTypeNormal, "HelmReverted", "Reverted out of band changes to Helm release %v: %v", releaseName, strings.Join(drift, ", "))
+		drift = nil
+	}
+
+	if reflect.DeepEqual(network.Status.HelmDrift, drift) || (len(network.Status.HelmDrift) == 0 && len(drift) == 0) {
+		return false, nil
+	}
+	if len(drift) != 0 {
+		r.Recorder.Eventf(network, corev1.EventTypeWarning, "HelmReleaseDrifted", "Resources of Helm release %v are changed out of band: %v", releaseName, strings.Join(drift, ", "))
+	}
+	network.Status.HelmDrift = drift
+	return true, nil
+}
+
+// compares the resources in the manifest with the live ones. only the fields in the manifest are compared,
+// so fields defaulted by Kubernetes are not reported
+func (r *FabricNetworkReconciler) getDrift(ctx context.Context, namespace string, manifest string) ([]string, error) {
+	manifests := releaseutil.SplitManifests(manifest)
+	keys := make([]string, 0, len(manifests))
+	for k := range manifests {
+		keys = append(keys, k)
+	}
+	sort.Sort(releaseutil.BySplitManifestsOrder(keys))
+
+	drift := []string{}
+	for _, k := range keys {
+		desired := &unstructured.Unstructured{}
+		if err := yaml.Unmarshal([]byte(manifests[k]), &desired.Object); err != nil {
+			return nil, err
+		}
+		if desired.Object == nil || desired.GetKind() == "" {
+			continue
+		}
+		ns := desired.GetNamespace()
+		if ns == "" {
+			ns = namespace
+		}
+
+		live := &unstructured.Unstructured{}
+		live.SetGroupVersionKind(desired.GroupVersionKind())
+		if err := r.APIReader.Get(ctx, types.NamespacedName{Namespace: ns, Name: desired.GetName()}, live); err != nil {
+			if errors.IsNotFound(err) {
+				drift = append(drift, fmt.Sprintf("%v/%v is deleted", desired.GetKind(), desired.GetName()))
+				continue
+			}
+			return nil, err
+		}
+
+		if path, changed := diffResource(desired.Object, live.Object); changed {
+			drift = append(drift, fmt.Sprintf("%v/%v %v is changed", desired.GetKind(), desired.GetName(), path))
+		}
+		if len(drift) >= maxReportedDrift {
+			break
+		}
+	}
+	return drift, nil
+}
+
+// returns the path of the first field of desired resource which differs in live resource.
+// metadata other than labels and annotations, and status are ignored
+func diffResource(desired map[string]interface{}, live map[string]interface{}) (string, bool) {
+	// normalize numbers of both sides
+	normalize := func(in map[string]interface{}) (map[string]interface{}, error) {
+		bytes, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		out := map[string]interface{}{}
+		return out, json.Unmarshal(bytes, &out)
+	}
+	d, err := normalize(desired)
+	if err != nil {
+		return "", true
+	}
+	l, err := normalize(live)
+	if err != nil {
+		return "", true
+	}
+
+	if metadata, ok := d["metadata"].(map[string]interface{}); ok {
+		d["metadata"] = map[string]interface{}{
+			"labels":      metadata["labels"],
+			"annotations": metadata["annotations"],
+		}
+	}
+	delete(d, "status")
+	// stringData of Secrets is write only
+	delete(d, "stringData")
+	return diffValue("", d, l)
+}
+
+// paths of resource quantities, i.e. .spec.template.spec.containers[0].resources.limits.cpu
+var quantityPath = regexp.MustCompile(`\.(requests|limits|hard|capacity)\.[^\[]+$|\.sizeLimit$`)
+
+func diffValue(path string, desired interface{}, live interface{}) (string, bool) {
+	switch desiredValue := desired.(type) {
+	case nil:
+		return "", false
+	case map[string]interface{}:
+		liveValue, ok := live.(map[string]interface{})
+		if !ok {
+			return path, len(desiredValue) != 0
+		}
+		keys := make([]string, 0, len(desiredValue))
+		for k := range desiredValue {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if p, changed := diffValue(path+"."+k, desiredValue[k], liveValue[k]); changed {
+				return p, true
+			}
+		}
+		return "", false
+	case []interface{}:
+		liveValue, ok := live.([]interface{})
+		if !ok {
+			return path, len(desiredValue) != 0
+		}
+		if len(desiredValue) != len(liveValue) {
+			return path, true
+		}
+		for i := range desiredValue {
+			if p, changed := diffValue(fmt.Sprintf("%v[%d]", path, i), desiredValue[i], liveValue[i]); changed {
+				return p, true
+			}
+		}
+		return "", false
+	default:
+		if live == nil {
+			// empty values are omitted by API server
+			switch fmt.Sprint(desired) {
+			case "", "false", "0":
+				return "", false
+			}
+			return path, true
+		}
+		if quantityPath.MatchString(path) {
+			// quantities are canonicalized by API server, i.e. 0.5 is 500m
+			desiredQuantity, err1 := resource.ParseQuantity(fmt.Sprint(desired))
+			liveQuantity, err2 := resource.ParseQuantity(fmt.Sprint(live))
+			if err1 == nil && err2 == nil {
+				return path, desiredQuantity.Cmp(liveQuantity) != 0
+			}
+		}
+		// numbers may be written as strings
+		if fmt.Sprint(desired) != fmt.Sprint(live) {
+			return path, true
+		}
+		return "", false
+	}
+}
@@ -0,0 +1,152 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/release"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+
+	"github.com/raftAtGit/hl-fabric-operator/api/v1alpha1"
+)
+
+func TestDiffResource(t *testing.T) {
+	resources := func(cpu interface{}, memory interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"spec": map[string]interface{}{
+				"containers": []interface{}{map[string]interface{}{
+					"name":      "peer",
+					"resources": map[string]interface{}{"limits": map[string]interface{}{"cpu": cpu, "memory": memory}},
+				}},
+			},
+		}
+	}
+	tests := []struct {
+		name    string
+		desired map[string]interface{}
+		live    map[string]interface{}
+		path    string
+		changed bool
+	}{
+		{"same", resources("500m", "1Gi"), resources("500m", "1Gi"), "", false},
+		{"canonicalized cpu", resources(0.5, "1Gi"), resources("500m", "1Gi"), "", false},
+		{"canonicalized memory", resources("1", "1024Mi"), resources(1, "1Gi"), "", false},
+		{"changed cpu", resources(0.5, "1Gi"), resources("1", "1Gi"), ".spec.containers[0].resources.limits.cpu", true},
+		{"changed memory", resources(0.5, "1Gi"), resources(0.5, "2Gi"), ".spec.containers[0].resources.limits.memory", true},
+		{"defaulted fields", map[string]interface{}{
+			"metadata": map[string]interface{}{"name": "peer0", "creationTimestamp": nil},
+			"spec":     map[string]interface{}{"replicas": 1, "paused": false},
+		}, map[string]interface{}{
+			"metadata": map[string]interface{}{"name": "peer0", "uid": "1234", "creationTimestamp": "2021-03-01T12:00:00Z"},
+			"spec":     map[string]interface{}{"replicas": int64(1), "revisionHistoryLimit": int64(10)},
+		}, "", false},
+		{"changed label", map[string]interface{}{
+			"metadata": map[string]interface{}{"labels": map[string]interface{}{"app": "peer"}},
+		}, map[string]interface{}{
+			"metadata": map[string]interface{}{"labels": map[string]interface{}{"app": "orderer"}},
+		}, ".metadata.labels.app", true},
+		// quantities are only parsed in resource fields
+		{"string in other field", map[string]interface{}{"data": map[string]interface{}{"value": "0.5"}},
+			map[string]interface{}{"data": map[string]interface{}{"value": "500m"}}, ".data.value", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path, changed := diffResource(test.desired, test.live)
+			if path != test.path || changed != test.changed {
+				t.Errorf("diff is %q %v, expected %q %v", path, changed, test.path, test.changed)
+			}
+		})
+	}
+}
+
+func TestGetDrift(t *testing.T) {
+	live := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "hlf-ca--karga"},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{
+					Name:  "ca",
+					Image: "hyperledger/fabric-ca:1.4.9",
+					Resources: corev1.ResourceRequirements{Limits: corev1.ResourceList{
+						corev1.ResourceCPU:    resource.MustParse("500m"),
+						corev1.ResourceMemory: resource.MustParse("1Gi"),
+					}},
+				}},
+			}},
+		},
+	}
+	manifest := func(image string) string {
+		deployment := map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata":   map[string]interface{}{"name": "hlf-ca--karga"},
+			"spec": map[string]interface{}{
+				"template": map[string]interface{}{"spec": map[string]interface{}{
+					"containers": []interface{}{map[string]interface{}{
+						"name":      "ca",
+						"image":     image,
+						"resources": map[string]interface{}{"limits": map[string]interface{}{"cpu": 0.5, "memory": "1024Mi"}},
+					}},
+				}},
+			},
+		}
+		bytes, err := yaml.Marshal(deployment)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return "---\n# Source: hlf-kube/templates/ca.yaml\n" + string(bytes) +
+			"---\n# Source: hlf-kube/templates/ca-service.yaml\napiVersion: v1\nkind: Service\nmetadata:\n  name: hlf-ca--karga\n"
+	}
+
+	// live resources are read with APIReader, not the cached client
+	r := testReconciler(t)
+	r.APIReader = testReconciler(t, live).Client
+
+	tests := []struct {
+		name  string
+		image string
+		drift []string
+	}{
+		{"unchanged", "hyperledger/fabric-ca:1.4.9", []string{"Service/hlf-ca--karga is deleted"}},
+		{"changed image", "hyperledger/fabric-ca:1.4.8", []string{
+			"Deployment/hlf-ca--karga .spec.template.spec.containers[0].image is changed",
+			"Service/hlf-ca--karga is deleted",
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			drift, err := r.getDrift(context.Background(), "default", manifest(test.image))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(drift, test.drift) {
+				t.Errorf("drift is %v, expected %v", drift, test.drift)
+			}
+		})
+	}
+}
+
+func TestReleaseFailedState(t *testing.T) {
+	tests := []struct {
+		status   release.Status
+		expected v1alpha1.State
+	}{
+		{release.StatusFailed, v1alpha1.StateHelmChartNeedsUpdate},
+		{release.StatusSuperseded, v1alpha1.StateHelmChartNeedsUpdate},
+		{release.StatusUninstalling, v1alpha1.StateNew},
+		{release.StatusUninstalled, v1alpha1.StateNew},
+		{release.StatusUnknown, v1alpha1.StateNew},
+	}
+	for _, test := range tests {
+		t.Run(test.status.String(), func(t *testing.T) {
+			if state := releaseFailedState(test.status); state != test.expected {
+				t.Errorf("failed state is %v, expected %v", state, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+
+	"github.com/raftAtGit/hl-fabric-operator/api/v1alpha1"
+)
+
+// deletes the finished flows of the network which are not retained by spec.argo.retention.
+// running flows and the flows referenced in status are never deleted
+func (r *FabricNetworkReconciler) enforceRetention(ctx context.Context, network *v1alpha1.FabricNetwork) error {
+	retention := network.Spec.Argo.Retention
+	if retention == nil {
+		return nil
+	}
+	protected := map[string]bool{}
+	for _, name := range []string{network.Status.Workflow, network.Status.FailedWorkflow} {
+		if name != "" {
+			protected[name] = true
+		}
+	}
+
+	// only the flows of the engine in spec are listed on each reconcile,
+	// flows of a previously used engine are deleted with the FabricNetwork
+	engine := r.flowEngine(network.Spec.FlowEngine)
+	flows, err := engine.List(ctx, network.Namespace, map[string]string{"raft.io/fabric-operator-created-for": network.Name})
+	if err != nil {
+		if meta.IsNoMatchError(err) {
+			return nil
+		}
+		return err
+	}
+	for _, name := range expiredFlows(flows, retention, protected, time.Now()) {
+		if err := engine.Delete(ctx, network.Namespace, name); err != nil {
+			r.Log.Error(err, "Failed to delete expired flow", "flow", name)
+			return err
+		}
+		r.Log.Info("Deleted expired flow", "flow", name, "engine", network.Spec.FlowEngine)
+	}
+	return nil
+}
+
+// returns the names of the finished flows which are not retained.
+// protected flows count towards keepSuccessful and keepFailed but are never returned
+func expiredFlows(flows []flowInfo, retention *v1alpha1.Retention, protected map[string]bool, now time.Time) []string {
+	sorted := append([]flowInfo{}, flows...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].CreatedAt.After(sorted[j].CreatedAt)
+	})
+
+	kept := map[string]int32{}
+	expired := []string{}
+	for _, flow := range sorted {
+		var keep *int32
+		switch flow.Status {
+		case wfCompleted:
+			keep = retention.KeepSuccessful
+		case wfFailed:
+			keep = retention.KeepFailed
+		default:
+			continue
+		}
+		key := flow.Type + "/" + string(flow.Status)
+		kept[key]++
+
+		if protected[flow.Name] {
+			continue
+		}
+		tooMany := keep != nil && kept[key] > *keep
+		tooOld := retention.TTL != nil && !flow.FinishedAt.IsZero() && now.Sub(flow.FinishedAt) > retention.TTL.Duration
+		if tooMany || tooOld {
+			expired = append(expired, flow.Name)
+			// an expired flow is not kept, so it does not count
+			kept[key]--
+		}
+	}
+	return expired
+}
@@ -0,0 +1,129 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	"github.com/raftAtGit/hl-fabric-operator/api/v1alpha1"
+)
+
+func TestExpiredFlows(t *testing.T) {
+	now := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	flow := func(name string, flowType string, status wfStatus, age time.Duration) flowInfo {
+		info := flowInfo{Name: name, Type: flowType, Status: status, CreatedAt: now.Add(-age - time.Minute)}
+		if status != wfSubmitted {
+			info.FinishedAt = now.Add(-age)
+		}
+		return info
+	}
+	one, zero := int32(1), int32(0)
+	flows := []flowInfo{
+		flow("channels-old", "channel-flow", wfCompleted, 3*time.Hour),
+		flow("channels-new", "channel-flow", wfCompleted, time.Hour),
+		flow("channels-failed", "channel-flow", wfFailed, 2*time.Hour),
+		flow("chaincodes", "chaincode-flow", wfCompleted, 4*time.Hour),
+		flow("chaincodes-running", "chaincode-flow", wfSubmitted, 5*time.Hour),
+	}
+
+	tests := []struct {
+		name      string
+		retention v1alpha1.Retention
+		protected map[string]bool
+		expired   []string
+	}{
+		{"keep all", v1alpha1.Retention{}, nil, []string{}},
+		{"keep last successful per type", v1alpha1.Retention{KeepSuccessful: &one}, nil, []string{"channels-old"}},
+		{"keep no failed", v1alpha1.Retention{KeepFailed: &zero}, nil, []string{"channels-failed"}},
+		{"protected failed", v1alpha1.Retention{KeepFailed: &zero}, map[string]bool{"channels-failed": true}, []string{}},
+		{"protected successful", v1alpha1.Retention{KeepSuccessful: &one}, map[string]bool{"channels-old": true}, []string{}},
+		{"ttl", v1alpha1.Retention{TTL: &metav1.Duration{Duration: 150 * time.Minute}}, nil, []string{"channels-old", "chaincodes"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expired := expiredFlows(flows, &test.retention, test.protected, now)
+			if !reflect.DeepEqual(expired, test.expired) {
+				t.Errorf("expired flows are %v, expected %v", expired, test.expired)
+			}
+		})
+	}
+}
+
+func TestEnforceRetention(t *testing.T) {
+	ctx := context.Background()
+	zero := int32(0)
+	network := &v1alpha1.FabricNetwork{
+		ObjectMeta: metav1.ObjectMeta{Name: "simple", Namespace: "retention-test"},
+		Spec:       v1alpha1.FabricNetworkSpec{FlowEngine: v1alpha1.FlowEngineJobs},
+	}
+	r := testReconciler(t, network)
+
+	// three failed channel flows, the last one is in status
+	failed := []string{}
+	for i := 0; i < 3; i++ {
+		network.Generation++
+		name, err := r.startFlow(ctx, network, "channel-flow", renderTestFlow)
+		if err != nil {
+			t.Fatal(err)
+		}
+		network.Status.State = v1alpha1.StateChannelFlowSubmitted
+		network.Status.Workflow = name
+		if err := r.cancelFlow(ctx, network); err != nil {
+			t.Fatal(err)
+		}
+		failed = append(failed, name)
+	}
+	network.Generation++
+	running, err := r.startFlow(ctx, network, "chaincode-flow", renderTestFlow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	network.Status.State = v1alpha1.StateFailed
+	network.Status.Workflow = ""
+	network.Status.FailedWorkflow = failed[2]
+
+	network.Spec.Argo.Retention = &v1alpha1.Retention{KeepSuccessful: &zero, KeepFailed: &zero}
+	if err := r.enforceRetention(ctx, network); err != nil {
+		t.Fatal(err)
+	}
+
+	flows, err := r.flowEngine(v1alpha1.FlowEngineJobs).List(ctx, network.Namespace, map[string]string{"raft.io/fabric-operator-created-for": network.Name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	left := map[string]bool{}
+	for _, flow := range flows {
+		left[flow.Name] = true
+	}
+	if len(left) != 2 || !left[failed[2]] || !left[running] {
+		t.Errorf("flows left are %v, expected failed flow in status %v and running flow %v", left, failed[2], running)
+	}
+}
+
+func TestEnforceRetentionListsOnlyEngineInSpec(t *testing.T) {
+	zero := int32(0)
+	network := &v1alpha1.FabricNetwork{
+		ObjectMeta: metav1.ObjectMeta{Name: "simple", Namespace: "retention-test"},
+		Spec:       v1alpha1.FabricNetworkSpec{FlowEngine: v1alpha1.FlowEngineArgo},
+	}
+	network.Spec.Argo.Retention = &v1alpha1.Retention{KeepSuccessful: &zero}
+	r := testReconciler(t, network)
+	r.Client = interceptor.NewClient(r.Client.(client.WithWatch), interceptor.Funcs{
+		List: func(ctx context.Context, cl client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+			if _, ok := list.(*corev1.ConfigMapList); ok {
+				t.Error("flow ConfigMaps of Jobs flow engine are listed for an Argo FabricNetwork")
+			}
+			return cl.List(ctx, list, opts...)
+		},
+	})
+
+	if err := r.enforceRetention(context.Background(), network); err != nil {
+		t.Fatal(err)
+	}
+}
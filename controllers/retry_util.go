@@ -0,0 +1,224 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"github.com/raftAtGit/hl-fabric-operator/api/v1alpha1"
+)
+
+const (
+	defaultRetryBackoff    = 30 * time.Second
+	defaultRetryMaxBackoff = 10 * time.Minute
+)
+
+// handles the failure of the submitted flow. re-submits the flow after a backoff if the retry policy allows,
+// otherwise sets the state to Failed
+func (r *FabricNetworkReconciler) handleFailedFlow(ctx context.Context, network *v1alpha1.FabricNetwork, failure string) (ctrl.Result, error) {
+	status := &network.Status
+	state := status.State
+	flow := flowsBySubmittedState[state]
+	maxRetries, backoff, maxBackoff := retrySettings(network.Spec.RetryPolicy, flow)
+
+	if status.NextRetryTime == nil {
+		// first time we see this failure
+		status.FlowAttempts++
+		status.LastFailureReason = failure
+
+		// failed step is only for diagnostics, it should not block handling the failure
+		failedStep, err := r.captureFailedStep(ctx, network)
+		if err != nil {
+			r.Log.Error(err, "Failed to get failed step of flow", "workflow", status.Workflow)
+		}
+		status.LastFailedStep = failedStep
+
+		if status.FlowAttempts > maxRetries {
+			message := flow + " failed"
+			if maxRetries > 0 {
+				message = fmt.Sprintf("%v failed, gave up after %d attempts", flow, status.FlowAttempts)
+			}
+			if failedStep != nil {
+				message += fmt.Sprintf(", step %v failed", failedStep.Name)
+				if failedStep.Message != "" {
+					message += ": " + failedStep.Message
+				}
+			}
+			status.FailedState = state
+			status.FailedWorkflow = status.Workflow
+			if err := r.saveStatus(ctx, network, v1alpha1.FabricNetworkStatus{State: v1alpha1.StateFailed, Message: message}); err != nil {
+				return ctrl.Result{}, err
+			}
+			return ctrl.Result{Requeue: false}, nil
+		}
+
+		// the failed attempt is observed here, since the state does not change until the flow is re-submitted
+		observeFlowAttempt(network, state, "failed")
+
+		delay := retryDelay(backoff, maxBackoff, status.FlowAttempts)
+		nextRetryTime := metav1.NewTime(time.Now().Add(delay))
+		status.NextRetryTime = &nextRetryTime
+
+		r.Log.Info("Flow failed, will retry", "flow", flow, "workflow", status.Workflow, "after", delay, "attempts", status.FlowAttempts)
+		if err := r.saveStatus(ctx, network, v1alpha1.FabricNetworkStatus{
+			State:    state,
+			Workflow: status.Workflow,
+			Message:  fmt.Sprintf("%v failed, will retry in %v (retry %d of %d)", flow, delay, status.FlowAttempts, maxRetries),
+		}); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{RequeueAfter: delay}, nil
+	}
+
+	if wait := time.Until(status.NextRetryTime.Time); wait > 0 {
+		return ctrl.Result{RequeueAfter: wait}, nil
+	}
+
+	wfName, err := r.resubmitFlow(ctx, network)
+	if err != nil {
+		r.Log.Error(err, "Re-submitting flow failed", "flow", flow)
+		return ctrl.Result{}, err
+	}
+	r.Log.Info("Re-submitted flow", "flow", flow, "name", wfName)
+	r.Recorder.Eventf(network, corev1.EventTypeNormal, "FlowRetried", "Re-submitted %v as %v, retry %d of %d", flow, wfName, status.FlowAttempts, maxRetries)
+
+	status.NextRetryTime = nil
+	// duration of the new attempt is measured from now, not from the first submission
+	setPhaseTimestamp(network)
+	if err := r.saveStatus(ctx, network, v1alpha1.FabricNetworkStatus{
+		State:    state,
+		Workflow: wfName,
+		Message:  fmt.Sprintf("Retrying %v (retry %d of %d)", flow, status.FlowAttempts, maxRetries),
+	}); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+// returns a human readable reason of the flow failure
+func failureReason(flow string, workflow string, wfMessage string) string {
+	reason := fmt.Sprintf("%v %v failed", flow, workflow)
+	if wfMessage != "" {
+		reason += ": " + wfMessage
+	}
+	return reason
+}
+
+// renders and submits the flow of the current state again
+func (r *FabricNetworkReconciler) resubmitFlow(ctx context.Context, network *v1alpha1.FabricNetwork) (string, error) {
+	switch network.Status.State {
+	case v1alpha1.StateChannelFlowSubmitted:
+		return r.startChannelFlow(ctx, network)
+	case v1alpha1.StateChaincodeFlowSubmitted:
+		return r.startChaincodeFlow(ctx, network, network.Status.ChaincodeFlowIncludes)
+	case v1alpha1.StatePeerOrgFlowSubmitted:
+		return r.startPeerOrgFlow(ctx, network)
+	default:
+		return "", fmt.Errorf("No flow to re-submit in state %v", network.Status.State)
+	}
+}
+
+// resumes a Failed FabricNetwork from the state it failed in. Flows are re-submitted with the same parameters
+func (r *FabricNetworkReconciler) resume(ctx context.Context, network *v1alpha1.FabricNetwork) error {
+	status := &network.Status
+	if status.State != v1alpha1.StateFailed || status.FailedState == "" {
+		r.Log.Info("FabricNetwork is not failed, ignoring resume", "state", status.State)
+		r.Recorder.Eventf(network, corev1.EventTypeWarning, "ResumeIgnored", "Only Failed FabricNetworks can be resumed, state is %v", status.State)
+		return nil
+	}
+
+	failedState := status.FailedState
+	r.Log.Info("Resuming FabricNetwork", "failedState", failedState, "failedWorkflow", status.FailedWorkflow)
+
+	if _, ok := flowsBySubmittedState[failedState]; !ok {
+		// not a flow, just go back to failed state and let the state machine retry it
+		return r.saveStatus(ctx, network, v1alpha1.FabricNetworkStatus{State: failedState, Message: "Resumed"})
+	}
+
+	// render the flow as if FabricNetwork is still in the failed state
+	status.State = failedState
+	wfName, err := r.resubmitFlow(ctx, network)
+	status.State = v1alpha1.StateFailed
+	if err != nil {
+		r.Log.Error(err, "Re-submitting flow failed", "flow", flowsBySubmittedState[failedState])
+		return err
+	}
+	r.Log.Info("Re-submitted flow", "flow", flowsBySubmittedState[failedState], "name", wfName)
+
+	// manual resume starts a fresh round of retries
+	status.FlowAttempts = 0
+	status.NextRetryTime = nil
+	return r.saveStatus(ctx, network, v1alpha1.FabricNetworkStatus{
+		State:    failedState,
+		Workflow: wfName,
+		Message:  fmt.Sprintf("Resumed %v", flowsBySubmittedState[failedState]),
+	})
+}
+
+// clears the retry status of the last flow, unless FabricNetwork is still running or just failed the flow
+func resetFlowRetry(network *v1alpha1.FabricNetwork) {
+	state := network.Status.State
+	if state != v1alpha1.StateFailed {
+		network.Status.FailedState = ""
+		network.Status.FailedWorkflow = ""
+	}
+	if _, ok := flowsBySubmittedState[state]; ok || state == v1alpha1.StateFailed {
+		return
+	}
+	network.Status.FlowAttempts = 0
+	network.Status.NextRetryTime = nil
+	network.Status.ChaincodeFlowIncludes = nil
+}
+
+// returns the retry settings of the flow after applying the flow specific overrides
+func retrySettings(policy *v1alpha1.RetryPolicy, flow string) (int32, time.Duration, time.Duration) {
+	if policy == nil {
+		return 0, 0, 0
+	}
+
+	maxRetries := policy.MaxRetries
+	backoff := defaultRetryBackoff
+	maxBackoff := defaultRetryMaxBackoff
+	if policy.Backoff != nil {
+		backoff = policy.Backoff.Duration
+	}
+	if policy.MaxBackoff != nil {
+		maxBackoff = policy.MaxBackoff.Duration
+	}
+
+	var override *v1alpha1.FlowRetryPolicy
+	switch flow {
+	case "channel-flow":
+		override = policy.ChannelFlow
+	case "chaincode-flow":
+		override = policy.ChaincodeFlow
+	case "peer-org-flow":
+		override = policy.PeerOrgFlow
+	}
+	if override != nil {
+		if override.MaxRetries != nil {
+			maxRetries = *override.MaxRetries
+		}
+		if override.Backoff != nil {
+			backoff = override.Backoff.Duration
+		}
+	}
+
+	return maxRetries, backoff, maxBackoff
+}
+
+// exponential backoff, doubled after each failed attempt up to maxBackoff
+func retryDelay(backoff time.Duration, maxBackoff time.Duration, attempts int32) time.Duration {
+	delay := backoff
+	for i := int32(1); i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+	return delay
+}
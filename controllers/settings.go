@@ -3,17 +3,12 @@ package controllers
 import "os"
 
 var settings = operatorSettings{
-	PivtDir:    envOr("FBOP_PIVT_DIR", "/opt/fabric-operator/PIVT"),
-	NetworkDir: envOr("FBOP_NETWORK_DIR", "/var/fabric-operator/network"),
+	PivtDir: envOr("FBOP_PIVT_DIR", "/opt/fabric-operator/PIVT"),
 }
 
 type operatorSettings struct {
-	// directory PIVT repository resides
+	// directory PIVT repository resides. charts are read once and rendered in memory
 	PivtDir string
-
-	// parent directory fabric-operator will create fabric-network files.
-	// NetworkDir/<namespace>/<fabric-network-name>/
-	NetworkDir string
 }
 
 func envOr(name, def string) string {
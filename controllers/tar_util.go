@@ -118,3 +118,35 @@ func uncompress(src io.Reader, dst string) error {
 	}
 	return nil
 }
+
+// reads the regular files of gzipped TAR archive into memory, keyed by their relative names
+func readTar(src io.Reader) (map[string][]byte, error) {
+	zr, err := gzip.NewReader(src)
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(zr)
+
+	files := make(map[string][]byte)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !validRelPath(header.Name) {
+			return nil, fmt.Errorf("tar contained invalid name: %v", header.Name)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		files[header.Name] = data
+	}
+	return files, nil
+}
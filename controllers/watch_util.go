@@ -0,0 +1,96 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+
+	"github.com/raftAtGit/hl-fabric-operator/api/v1alpha1"
+	"github.com/raftAtGit/hl-fabric-operator/validation"
+)
+
+// maps Argo workflows and flow Jobs to the FabricNetwork they are created for
+func (r *FabricNetworkReconciler) mapWorkflow(ctx context.Context, obj client.Object) []reconcile.Request {
+	name := obj.GetLabels()["raft.io/fabric-operator-created-for"]
+	if name == "" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: obj.GetNamespace(), Name: name}}}
+}
+
+// maps hlf-kube StatefulSets and Deployments to the FabricNetwork owning the Helm release
+func (r *FabricNetworkReconciler) mapReleaseObject(ctx context.Context, obj client.Object) []reconcile.Request {
+	release := obj.GetAnnotations()["meta.helm.sh/release-name"]
+	return r.mapNetworks(ctx, obj.GetNamespace(), func(network *v1alpha1.FabricNetwork) bool {
+		return validation.HelmRelease(network) == release
+	})
+}
+
+// maps configtx and crypto-config Secrets to the FabricNetworks using them
+func (r *FabricNetworkReconciler) mapSecret(ctx context.Context, obj client.Object) []reconcile.Request {
+	name := obj.GetName()
+	return r.mapNetworks(ctx, obj.GetNamespace(), func(network *v1alpha1.FabricNetwork) bool {
+		return network.Spec.Configtx.Secret == name || validation.CryptoConfigSecret(network) == name
+	})
+}
+
+func (r *FabricNetworkReconciler) mapNetworks(ctx context.Context, namespace string, matches func(*v1alpha1.FabricNetwork) bool) []reconcile.Request {
+	networkList := &v1alpha1.FabricNetworkList{}
+	if err := r.List(ctx, networkList, client.InNamespace(namespace)); err != nil {
+		r.Log.Error(err, "Failed to get FabricNetworkList")
+		return nil
+	}
+
+	requests := []reconcile.Request{}
+	for i := range networkList.Items {
+		if matches(&networkList.Items[i]) {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: namespace, Name: networkList.Items[i].Name}})
+		}
+	}
+	return requests
+}
+
+// watch of a resource FabricNetworks depend on
+type watch struct {
+	object    client.Object
+	handler   handler.EventHandler
+	predicate predicate.Predicate
+	// only the metadata of the objects is watched and cached
+	metadataOnly bool
+}
+
+// watches of the resources FabricNetworks depend on, each mapped back to the owning FabricNetwork
+func (r *FabricNetworkReconciler) watches(argoInstalled bool) []watch {
+	hasLabel := predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		return obj.GetLabels()["raft.io/fabric-operator-created-for"] != ""
+	})
+	isHlfKube := predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		return strings.HasPrefix(obj.GetAnnotations()["meta.helm.sh/release-name"], validation.LegacyHelmRelease)
+	})
+	isHlfSecret := predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		return strings.HasPrefix(obj.GetName(), "hlf-")
+	})
+
+	watches := []watch{
+		{&batchv1.Job{}, handler.EnqueueRequestsFromMapFunc(r.mapWorkflow), hasLabel, false},
+		{&appsv1.StatefulSet{}, handler.EnqueueRequestsFromMapFunc(r.mapReleaseObject), isHlfKube, false},
+		{&appsv1.Deployment{}, handler.EnqueueRequestsFromMapFunc(r.mapReleaseObject), isHlfKube, false},
+		// Secrets are watched by name and not all of them have a label, so all Secrets in the cluster are watched.
+		// only their metadata is cached, Secrets are read from the API server, see main.go
+		{&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.mapSecret), isHlfSecret, true},
+	}
+	if argoInstalled {
+		watches = append(watches, watch{&wfv1.Workflow{}, handler.EnqueueRequestsFromMapFunc(r.mapWorkflow), hasLabel, false})
+	}
+	return watches
+}
@@ -0,0 +1,234 @@
+package cryptogen
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// subject fields of certificates, same as cryptogen
+const (
+	country  = "US"
+	province = "California"
+	locality = "San Francisco"
+)
+
+// certificates are valid for 10 years
+const certValidity = 10 * 365 * 24 * time.Hour
+
+// name of private key files. cryptogen of Fabric 1.4 names them <SKI>_sk, both match *_sk
+const privateKeyFilename = "priv_sk"
+
+// a certificate authority of an organization
+type ca struct {
+	name   string
+	signer *ecdsa.PrivateKey
+	cert   *x509.Certificate
+}
+
+// creates a self signed CA, writes its private key and certificate to dir
+func newCA(dir string, org string, name string) (*ca, error) {
+	priv, err := generatePrivateKey(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	template, err := x509Template()
+	if err != nil {
+		return nil, err
+	}
+	template.KeyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth}
+	template.IsCA = true
+	template.Subject = pkix.Name{
+		Country:      []string{country},
+		Province:     []string{province},
+		Locality:     []string{locality},
+		Organization: []string{org},
+		CommonName:   name,
+	}
+	template.SubjectKeyId = computeSKI(&priv.PublicKey)
+
+	cert, err := createCertificate(dir, name, template, template, &priv.PublicKey, priv)
+	if err != nil {
+		return nil, err
+	}
+	return &ca{name: name, signer: priv, cert: cert}, nil
+}
+
+// loads the CA from dir, as created by newCA or cryptogen
+func loadCA(dir string, name string) (*ca, error) {
+	cert, err := loadCertificate(filepath.Join(dir, certFilename(name)))
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), "_sk") {
+			continue
+		}
+		priv, err := loadPrivateKey(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if priv.PublicKey.Equal(cert.PublicKey) {
+			return &ca{name: name, signer: priv, cert: cert}, nil
+		}
+	}
+	return nil, fmt.Errorf("private key of CA %v is not found in %v", name, dir)
+}
+
+// signs a certificate for the public key and writes it to dir/<name>-cert.pem.
+// alternate names are added as IP or DNS subject alternative names
+func (c *ca) signCertificate(dir string, name string, orgUnits []string, alternateNames []string, pub *ecdsa.PublicKey,
+	keyUsage x509.KeyUsage, extKeyUsage []x509.ExtKeyUsage) (*x509.Certificate, error) {
+
+	template, err := x509Template()
+	if err != nil {
+		return nil, err
+	}
+	template.KeyUsage = keyUsage
+	template.ExtKeyUsage = extKeyUsage
+	template.Subject = pkix.Name{
+		Country:            []string{country},
+		Province:           []string{province},
+		Locality:           []string{locality},
+		OrganizationalUnit: orgUnits,
+		CommonName:         name,
+	}
+	for _, san := range alternateNames {
+		if ip := net.ParseIP(san); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, san)
+		}
+	}
+
+	return createCertificate(dir, name, template, c.cert, pub, c.signer)
+}
+
+func x509Template() (*x509.Certificate, error) {
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	// backdate the certificates a bit for clock skew
+	notBefore := time.Now().Round(time.Minute).Add(-5 * time.Minute).UTC()
+
+	return &x509.Certificate{
+		SerialNumber:          serialNumber,
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.Add(certValidity),
+		BasicConstraintsValid: true,
+	}, nil
+}
+
+func createCertificate(dir string, name string, template *x509.Certificate, parent *x509.Certificate, pub *ecdsa.PublicKey, priv *ecdsa.PrivateKey) (*x509.Certificate, error) {
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, pub, lowSSigner{priv})
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFile(filepath.Join(dir, certFilename(name)), certPEM(cert), 0644); err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+// signs with low-S ECDSA signatures as Fabric's BCCSP does. Fabric MSPs convert high-S signatures of certificates to low-S,
+// and the modified self-signed CA certificates are no longer verified against themselves
+type lowSSigner struct {
+	*ecdsa.PrivateKey
+}
+
+func (s lowSSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	r, sig, err := ecdsa.Sign(rand, s.PrivateKey, digest)
+	if err != nil {
+		return nil, err
+	}
+	order := s.Curve.Params().N
+	if sig.Cmp(new(big.Int).Rsh(order, 1)) > 0 {
+		sig.Sub(order, sig)
+	}
+	return asn1.Marshal(struct{ R, S *big.Int }{r, sig})
+}
+
+// generates an ECDSA P-256 private key and writes it to dir/priv_sk
+func generatePrivateKey(dir string) (*ecdsa.PrivateKey, error) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := writeFile(filepath.Join(dir, privateKeyFilename), data, 0600); err != nil {
+		return nil, err
+	}
+	return priv, nil
+}
+
+func loadPrivateKey(file string) (*ecdsa.PrivateKey, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %v", file)
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		if priv, ok := key.(*ecdsa.PrivateKey); ok {
+			return priv, nil
+		}
+		return nil, fmt.Errorf("private key in %v is not an ECDSA key", file)
+	}
+	return x509.ParseECPrivateKey(block.Bytes)
+}
+
+func loadCertificate(file string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("no certificate found in " + file)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func certPEM(cert *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+}
+
+// subject key identifier of the public key, same as cryptogen
+func computeSKI(pub *ecdsa.PublicKey) []byte {
+	raw := elliptic.Marshal(pub.Curve, pub.X, pub.Y)
+	hash := sha256.Sum256(raw)
+	return hash[:]
+}
@@ -0,0 +1,239 @@
+// Package cryptogen generates the crypto material of Fabric organizations, in the same folder layout as Fabric's cryptogen tool
+package cryptogen
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Config is the crypto configuration of Fabric organizations, same as cryptogen's crypto-config.yaml
+type Config struct {
+	// Orderer organizations
+	OrdererOrgs []OrdererOrg `json:"OrdererOrgs"`
+	// Peer organizations
+	PeerOrgs []PeerOrg `json:"PeerOrgs"`
+}
+
+// OrdererOrg is an orderer organization
+type OrdererOrg struct {
+	Name          string `json:"Name"`
+	Domain        string `json:"Domain"`
+	EnableNodeOUs bool   `json:"EnableNodeOUs"`
+
+	Specs []Host `json:"Specs"`
+}
+
+// Host is an orderer node
+type Host struct {
+	Hostname string `json:"Hostname"`
+}
+
+// PeerOrg is a peer organization
+type PeerOrg struct {
+	Name          string `json:"Name"`
+	Domain        string `json:"Domain"`
+	EnableNodeOUs bool   `json:"EnableNodeOUs"`
+	Template      Count  `json:"Template"`
+	Users         Count  `json:"Users"`
+}
+
+// Count is the number of peers or users
+type Count struct {
+	Count int32 `json:"Count"`
+}
+
+// node types, used as organizational units of signing certificates when NodeOUs are enabled
+const (
+	nodeTypeClient  = "client"
+	nodeTypePeer    = "peer"
+	nodeTypeOrderer = "orderer"
+	nodeTypeAdmin   = "admin"
+)
+
+const adminBaseName = "Admin"
+
+// a node or user of an organization
+type node struct {
+	commonName string
+	// subject alternative names of TLS certificate
+	sans     []string
+	nodeType string
+}
+
+// an organization to generate, either orderer or peer organization
+type org struct {
+	// parent folder of the organization, ordererOrganizations or peerOrganizations
+	kind     string
+	domain   string
+	nodeOUs  bool
+	nodesDir string
+	nodes    []node
+	users    []node
+}
+
+// Generate creates the crypto material of all organizations in baseDir, same as cryptogen generate.
+// Existing organizations are overwritten
+func Generate(config *Config, baseDir string) error {
+	for _, o := range orgs(config) {
+		orgDir := filepath.Join(baseDir, o.kind, o.domain)
+		if err := os.RemoveAll(orgDir); err != nil {
+			return err
+		}
+		if err := generateOrg(orgDir, o); err != nil {
+			return fmt.Errorf("failed generating organization %v: %w", o.domain, err)
+		}
+	}
+	return nil
+}
+
+// Extend creates the crypto material of organizations, nodes and users which do not exist in baseDir yet, same as cryptogen extend.
+// New nodes and users of existing organizations are signed by the existing CAs
+func Extend(config *Config, baseDir string) error {
+	for _, o := range orgs(config) {
+		orgDir := filepath.Join(baseDir, o.kind, o.domain)
+		if _, err := os.Stat(orgDir); os.IsNotExist(err) {
+			if err := generateOrg(orgDir, o); err != nil {
+				return fmt.Errorf("failed generating organization %v: %w", o.domain, err)
+			}
+			continue
+		}
+		if err := extendOrg(orgDir, o); err != nil {
+			return fmt.Errorf("failed extending organization %v: %w", o.domain, err)
+		}
+	}
+	return nil
+}
+
+// returns the organizations in config with their nodes and users, named same as cryptogen does
+func orgs(config *Config) []org {
+	orgs := []org{}
+	for _, o := range config.OrdererOrgs {
+		nodes := make([]node, len(o.Specs))
+		for i, spec := range o.Specs {
+			nodes[i] = hostNode(spec.Hostname, o.Domain, nodeTypeOrderer)
+		}
+		orgs = append(orgs, org{
+			kind:     "ordererOrganizations",
+			domain:   o.Domain,
+			nodeOUs:  o.EnableNodeOUs,
+			nodesDir: "orderers",
+			nodes:    nodes,
+			users:    []node{adminUser(o.Domain)},
+		})
+	}
+	for _, o := range config.PeerOrgs {
+		nodes := make([]node, o.Template.Count)
+		for i := range nodes {
+			nodes[i] = hostNode(fmt.Sprintf("peer%d", i), o.Domain, nodeTypePeer)
+		}
+		users := []node{}
+		for i := 1; i <= int(o.Users.Count); i++ {
+			users = append(users, node{commonName: fmt.Sprintf("User%d@%v", i, o.Domain), nodeType: nodeTypeClient})
+		}
+		users = append(users, adminUser(o.Domain))
+		orgs = append(orgs, org{
+			kind:     "peerOrganizations",
+			domain:   o.Domain,
+			nodeOUs:  o.EnableNodeOUs,
+			nodesDir: "peers",
+			nodes:    nodes,
+			users:    users,
+		})
+	}
+	return orgs
+}
+
+func hostNode(hostname string, domain string, nodeType string) node {
+	commonName := hostname + "." + domain
+	return node{commonName: commonName, sans: []string{commonName, hostname}, nodeType: nodeType}
+}
+
+func adminUser(domain string) node {
+	return node{commonName: adminBaseName + "@" + domain, nodeType: nodeTypeAdmin}
+}
+
+func generateOrg(orgDir string, o org) error {
+	signCA, err := newCA(filepath.Join(orgDir, "ca"), o.domain, "ca."+o.domain)
+	if err != nil {
+		return err
+	}
+	tlsCA, err := newCA(filepath.Join(orgDir, "tlsca"), o.domain, "tlsca."+o.domain)
+	if err != nil {
+		return err
+	}
+	if err := generateVerifyingMSP(filepath.Join(orgDir, "msp"), signCA, tlsCA, o.nodeOUs); err != nil {
+		return err
+	}
+	return generateNodes(orgDir, o, signCA, tlsCA)
+}
+
+func extendOrg(orgDir string, o org) error {
+	signCA, err := loadCA(filepath.Join(orgDir, "ca"), "ca."+o.domain)
+	if err != nil {
+		return err
+	}
+	tlsCA, err := loadCA(filepath.Join(orgDir, "tlsca"), "tlsca."+o.domain)
+	if err != nil {
+		return err
+	}
+	return generateNodes(orgDir, o, signCA, tlsCA)
+}
+
+// generates the nodes and users of the organization which do not exist yet.
+// without NodeOUs, admin certificate is copied to admincerts of the organization and its nodes
+func generateNodes(orgDir string, o org, signCA *ca, tlsCA *ca) error {
+	for _, n := range o.nodes {
+		if err := generateNode(filepath.Join(orgDir, o.nodesDir, n.commonName), n, signCA, tlsCA, o.nodeOUs); err != nil {
+			return err
+		}
+	}
+	for _, u := range o.users {
+		if err := generateNode(filepath.Join(orgDir, "users", u.commonName), u, signCA, tlsCA, o.nodeOUs); err != nil {
+			return err
+		}
+	}
+	if o.nodeOUs {
+		return nil
+	}
+
+	admin := adminUser(o.domain).commonName
+	adminCert, err := os.ReadFile(filepath.Join(orgDir, "users", admin, "msp", "signcerts", certFilename(admin)))
+	if err != nil {
+		return err
+	}
+	mspDirs := []string{filepath.Join(orgDir, "msp")}
+	for _, n := range o.nodes {
+		mspDirs = append(mspDirs, filepath.Join(orgDir, o.nodesDir, n.commonName, "msp"))
+	}
+	for _, mspDir := range mspDirs {
+		if err := writeFile(filepath.Join(mspDir, "admincerts", certFilename(admin)), adminCert, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// generates the node if it does not exist yet
+func generateNode(nodeDir string, n node, signCA *ca, tlsCA *ca, nodeOUs bool) error {
+	if _, err := os.Stat(nodeDir); err == nil {
+		return nil
+	}
+	nodeType := n.nodeType
+	if !nodeOUs && nodeType == nodeTypeAdmin {
+		nodeType = nodeTypeClient
+	}
+	return generateLocalMSP(nodeDir, n.commonName, n.sans, signCA, tlsCA, nodeType, nodeOUs)
+}
+
+func certFilename(name string) string {
+	return name + "-cert.pem"
+}
+
+// writes the file, creating its folder if needed
+func writeFile(file string, data []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(file, data, perm)
+}
@@ -0,0 +1,326 @@
+package cryptogen
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"io/fs"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+func testConfig(peerCount int32) *Config {
+	return &Config{
+		OrdererOrgs: []OrdererOrg{{
+			Name:          "Groeifabriek",
+			Domain:        "groeifabriek.nl",
+			EnableNodeOUs: true,
+			Specs:         []Host{{Hostname: "orderer0"}},
+		}},
+		PeerOrgs: []PeerOrg{{
+			Name:          "Karga",
+			Domain:        "aptalkarga.tr",
+			EnableNodeOUs: true,
+			Template:      Count{Count: peerCount},
+			Users:         Count{Count: 1},
+		}},
+	}
+}
+
+// files of a local MSP and TLS folder, as cryptogen creates them with NodeOUs enabled
+func localMSPFiles(dir string, name string, caDomain string, tlsPrefix string) []string {
+	return []string{
+		dir + "/msp/cacerts/ca." + caDomain + "-cert.pem",
+		dir + "/msp/config.yaml",
+		dir + "/msp/keystore/priv_sk",
+		dir + "/msp/signcerts/" + name + "-cert.pem",
+		dir + "/msp/tlscacerts/tlsca." + caDomain + "-cert.pem",
+		dir + "/tls/ca.crt",
+		dir + "/tls/" + tlsPrefix + ".crt",
+		dir + "/tls/" + tlsPrefix + ".key",
+	}
+}
+
+func orgFiles(dir string, domain string) []string {
+	return []string{
+		dir + "/ca/ca." + domain + "-cert.pem",
+		dir + "/ca/priv_sk",
+		dir + "/msp/cacerts/ca." + domain + "-cert.pem",
+		dir + "/msp/config.yaml",
+		dir + "/msp/tlscacerts/tlsca." + domain + "-cert.pem",
+		dir + "/tlsca/priv_sk",
+		dir + "/tlsca/tlsca." + domain + "-cert.pem",
+	}
+}
+
+func listFiles(t *testing.T, baseDir string) []string {
+	t.Helper()
+	files := []string{}
+	err := filepath.WalkDir(baseDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			rel, _ := filepath.Rel(baseDir, path)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	return files
+}
+
+func readCert(t *testing.T, file string) *x509.Certificate {
+	t.Helper()
+	cert, err := loadCertificate(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func verifyChain(t *testing.T, cert *x509.Certificate, caCert *x509.Certificate, usage x509.ExtKeyUsage) {
+	t.Helper()
+	roots := x509.NewCertPool()
+	roots.AddCert(caCert)
+	if _, err := cert.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{usage}}); err != nil {
+		t.Errorf("%v is not signed by %v: %v", cert.Subject.CommonName, caCert.Subject.CommonName, err)
+	}
+}
+
+// Fabric MSPs only accept low-S signatures
+func verifyLowS(t *testing.T, cert *x509.Certificate) {
+	t.Helper()
+	var sig struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(cert.Signature, &sig); err != nil {
+		t.Fatal(err)
+	}
+	if sig.S.Cmp(new(big.Int).Rsh(elliptic.P256().Params().N, 1)) > 0 {
+		t.Errorf("signature of %v is not low-S", cert.Subject.CommonName)
+	}
+}
+
+func verifyKeyPair(t *testing.T, certFile string, keyFile string) {
+	t.Helper()
+	priv, err := loadPrivateKey(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !priv.PublicKey.Equal(readCert(t, certFile).PublicKey) {
+		t.Errorf("private key %v does not belong to certificate %v", keyFile, certFile)
+	}
+}
+
+func TestGenerateLayout(t *testing.T) {
+	baseDir := t.TempDir()
+	if err := Generate(testConfig(2), baseDir); err != nil {
+		t.Fatal(err)
+	}
+
+	orderer := "ordererOrganizations/groeifabriek.nl"
+	peer := "peerOrganizations/aptalkarga.tr"
+	expected := []string{}
+	expected = append(expected, orgFiles(orderer, "groeifabriek.nl")...)
+	expected = append(expected, localMSPFiles(orderer+"/orderers/orderer0.groeifabriek.nl", "orderer0.groeifabriek.nl", "groeifabriek.nl", "server")...)
+	expected = append(expected, localMSPFiles(orderer+"/users/Admin@groeifabriek.nl", "Admin@groeifabriek.nl", "groeifabriek.nl", "client")...)
+	expected = append(expected, orgFiles(peer, "aptalkarga.tr")...)
+	expected = append(expected, localMSPFiles(peer+"/peers/peer0.aptalkarga.tr", "peer0.aptalkarga.tr", "aptalkarga.tr", "server")...)
+	expected = append(expected, localMSPFiles(peer+"/peers/peer1.aptalkarga.tr", "peer1.aptalkarga.tr", "aptalkarga.tr", "server")...)
+	expected = append(expected, localMSPFiles(peer+"/users/Admin@aptalkarga.tr", "Admin@aptalkarga.tr", "aptalkarga.tr", "client")...)
+	expected = append(expected, localMSPFiles(peer+"/users/User1@aptalkarga.tr", "User1@aptalkarga.tr", "aptalkarga.tr", "client")...)
+	sort.Strings(expected)
+
+	if files := listFiles(t, baseDir); !reflect.DeepEqual(files, expected) {
+		t.Errorf("unexpected layout\ngot:      %v\nexpected: %v", files, expected)
+	}
+}
+
+func TestGenerateCertificates(t *testing.T) {
+	baseDir := t.TempDir()
+	if err := Generate(testConfig(1), baseDir); err != nil {
+		t.Fatal(err)
+	}
+	orgDir := baseDir + "/peerOrganizations/aptalkarga.tr"
+
+	caCert := readCert(t, orgDir+"/ca/ca.aptalkarga.tr-cert.pem")
+	if !caCert.IsCA || caCert.Subject.CommonName != "ca.aptalkarga.tr" || !reflect.DeepEqual(caCert.Subject.Organization, []string{"aptalkarga.tr"}) {
+		t.Errorf("unexpected CA certificate: %v", caCert.Subject)
+	}
+	if !bytes.Equal(caCert.SubjectKeyId, computeSKI(caCert.PublicKey.(*ecdsa.PublicKey))) {
+		t.Errorf("CA subject key identifier is not computed as cryptogen does")
+	}
+	verifyKeyPair(t, orgDir+"/ca/ca.aptalkarga.tr-cert.pem", orgDir+"/ca/priv_sk")
+	verifyLowS(t, caCert)
+	tlsCACert := readCert(t, orgDir+"/tlsca/tlsca.aptalkarga.tr-cert.pem")
+
+	nodes := []struct {
+		dir       string
+		name      string
+		orgUnit   string
+		tlsPrefix string
+		sans      []string
+	}{
+		{"peers/peer0.aptalkarga.tr", "peer0.aptalkarga.tr", "peer", "server", []string{"peer0.aptalkarga.tr", "peer0"}},
+		{"users/Admin@aptalkarga.tr", "Admin@aptalkarga.tr", "admin", "client", nil},
+		{"users/User1@aptalkarga.tr", "User1@aptalkarga.tr", "client", "client", nil},
+	}
+	for _, n := range nodes {
+		dir := orgDir + "/" + n.dir
+
+		signCert := readCert(t, dir+"/msp/signcerts/"+n.name+"-cert.pem")
+		verifyChain(t, signCert, caCert, x509.ExtKeyUsageAny)
+		verifyLowS(t, signCert)
+		if signCert.Subject.CommonName != n.name || !reflect.DeepEqual(signCert.Subject.OrganizationalUnit, []string{n.orgUnit}) {
+			t.Errorf("unexpected signing certificate subject of %v: %v", n.name, signCert.Subject)
+		}
+		if signCert.KeyUsage != x509.KeyUsageDigitalSignature {
+			t.Errorf("unexpected key usage of %v: %v", n.name, signCert.KeyUsage)
+		}
+		verifyKeyPair(t, dir+"/msp/signcerts/"+n.name+"-cert.pem", dir+"/msp/keystore/priv_sk")
+
+		tlsCert := readCert(t, dir+"/tls/"+n.tlsPrefix+".crt")
+		verifyChain(t, tlsCert, tlsCACert, x509.ExtKeyUsageServerAuth)
+		verifyChain(t, tlsCert, tlsCACert, x509.ExtKeyUsageClientAuth)
+		if !reflect.DeepEqual(tlsCert.DNSNames, n.sans) {
+			t.Errorf("unexpected TLS SANs of %v: %v", n.name, tlsCert.DNSNames)
+		}
+		verifyKeyPair(t, dir+"/tls/"+n.tlsPrefix+".crt", dir+"/tls/"+n.tlsPrefix+".key")
+
+		caCopy, err := os.ReadFile(dir + "/tls/ca.crt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(caCopy, certPEM(tlsCACert)) {
+			t.Errorf("tls/ca.crt of %v is not the TLS CA certificate", n.name)
+		}
+	}
+
+	data, err := os.ReadFile(orgDir + "/msp/config.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := nodeOUsConfig{}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		t.Fatal(err)
+	}
+	ous := config.NodeOUs
+	if !ous.Enable || ous.PeerOUIdentifier.Certificate != "cacerts/ca.aptalkarga.tr-cert.pem" ||
+		ous.ClientOUIdentifier.OrganizationalUnitIdentifier != "client" || ous.PeerOUIdentifier.OrganizationalUnitIdentifier != "peer" ||
+		ous.AdminOUIdentifier.OrganizationalUnitIdentifier != "admin" || ous.OrdererOUIdentifier.OrganizationalUnitIdentifier != "orderer" {
+		t.Errorf("unexpected NodeOUs config: %v", string(data))
+	}
+}
+
+func TestGenerateWithoutNodeOUs(t *testing.T) {
+	config := testConfig(1)
+	config.PeerOrgs[0].EnableNodeOUs = false
+	baseDir := t.TempDir()
+	if err := Generate(config, baseDir); err != nil {
+		t.Fatal(err)
+	}
+	orgDir := baseDir + "/peerOrganizations/aptalkarga.tr"
+
+	adminCert, err := os.ReadFile(orgDir + "/users/Admin@aptalkarga.tr/msp/signcerts/Admin@aptalkarga.tr-cert.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{orgDir + "/msp", orgDir + "/peers/peer0.aptalkarga.tr/msp"} {
+		data, err := os.ReadFile(dir + "/admincerts/Admin@aptalkarga.tr-cert.pem")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, adminCert) {
+			t.Errorf("admin certificate is not copied to %v", dir)
+		}
+		if _, err := os.Stat(dir + "/config.yaml"); !os.IsNotExist(err) {
+			t.Errorf("%v should not have config.yaml", dir)
+		}
+	}
+	cert := readCert(t, orgDir+"/peers/peer0.aptalkarga.tr/msp/signcerts/peer0.aptalkarga.tr-cert.pem")
+	if len(cert.Subject.OrganizationalUnit) != 0 {
+		t.Errorf("signing certificate should not have organizational units: %v", cert.Subject)
+	}
+}
+
+func TestExtend(t *testing.T) {
+	baseDir := t.TempDir()
+	if err := Generate(testConfig(1), baseDir); err != nil {
+		t.Fatal(err)
+	}
+	orgDir := baseDir + "/peerOrganizations/aptalkarga.tr"
+
+	// CA keys of cryptogen in Fabric 1.4 are named by their subject key identifier
+	caCert := readCert(t, orgDir+"/ca/ca.aptalkarga.tr-cert.pem")
+	skiKey := orgDir + "/ca/" + hex.EncodeToString(caCert.SubjectKeyId) + "_sk"
+	if err := os.Rename(orgDir+"/ca/priv_sk", skiKey); err != nil {
+		t.Fatal(err)
+	}
+
+	before := map[string][]byte{}
+	for _, file := range listFiles(t, baseDir) {
+		data, err := os.ReadFile(baseDir + "/" + file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		before[file] = data
+	}
+
+	config := testConfig(2)
+	config.PeerOrgs = append(config.PeerOrgs, PeerOrg{
+		Name:          "Nevergreen",
+		Domain:        "nevergreen.nl",
+		EnableNodeOUs: true,
+		Template:      Count{Count: 1},
+		Users:         Count{Count: 1},
+	})
+	if err := Extend(config, baseDir); err != nil {
+		t.Fatal(err)
+	}
+
+	after := map[string]bool{}
+	for _, file := range listFiles(t, baseDir) {
+		after[file] = true
+	}
+	for file, data := range before {
+		current, err := os.ReadFile(baseDir + "/" + file)
+		if err != nil {
+			t.Errorf("%v is deleted: %v", file, err)
+			continue
+		}
+		if !bytes.Equal(current, data) {
+			t.Errorf("%v is changed", file)
+		}
+	}
+
+	newPeer := "peerOrganizations/aptalkarga.tr/peers/peer1.aptalkarga.tr"
+	for _, file := range localMSPFiles(newPeer, "peer1.aptalkarga.tr", "aptalkarga.tr", "server") {
+		if !after[file] {
+			t.Errorf("%v is not created", file)
+		}
+	}
+	verifyChain(t, readCert(t, baseDir+"/"+newPeer+"/msp/signcerts/peer1.aptalkarga.tr-cert.pem"), caCert, x509.ExtKeyUsageAny)
+
+	newOrg := 0
+	for file := range after {
+		if strings.HasPrefix(file, "peerOrganizations/nevergreen.nl/") {
+			newOrg++
+		}
+	}
+	// organization, a peer, a user and an admin
+	if expected := len(orgFiles("", "")) + 3*len(localMSPFiles("", "", "", "")); newOrg != expected {
+		t.Errorf("expected %v files of new organization, got %v", expected, newOrg)
+	}
+}
@@ -0,0 +1,122 @@
+package cryptogen
+
+import (
+	"crypto/x509"
+	"os"
+	"path/filepath"
+
+	"sigs.k8s.io/yaml"
+)
+
+// NodeOUs configuration of an MSP, written to config.yaml
+type nodeOUsConfig struct {
+	NodeOUs nodeOUs `json:"NodeOUs"`
+}
+
+type nodeOUs struct {
+	Enable              bool                   `json:"Enable"`
+	ClientOUIdentifier  orgUnitIdentifiersConf `json:"ClientOUIdentifier"`
+	PeerOUIdentifier    orgUnitIdentifiersConf `json:"PeerOUIdentifier"`
+	AdminOUIdentifier   orgUnitIdentifiersConf `json:"AdminOUIdentifier"`
+	OrdererOUIdentifier orgUnitIdentifiersConf `json:"OrdererOUIdentifier"`
+}
+
+type orgUnitIdentifiersConf struct {
+	Certificate                  string `json:"Certificate"`
+	OrganizationalUnitIdentifier string `json:"OrganizationalUnitIdentifier"`
+}
+
+// generates the local MSP and TLS material of a node or user:
+//
+//	msp/cacerts, msp/tlscacerts, msp/keystore, msp/signcerts and msp/config.yaml if NodeOUs are enabled
+//	tls/ca.crt and server.crt, server.key for nodes or client.crt, client.key for users
+func generateLocalMSP(baseDir string, name string, sans []string, signCA *ca, tlsCA *ca, nodeType string, nodeOUs bool) error {
+	mspDir := filepath.Join(baseDir, "msp")
+	tlsDir := filepath.Join(baseDir, "tls")
+
+	priv, err := generatePrivateKey(filepath.Join(mspDir, "keystore"))
+	if err != nil {
+		return err
+	}
+	var orgUnits []string
+	if nodeOUs {
+		orgUnits = []string{nodeType}
+	}
+	cert, err := signCA.signCertificate(filepath.Join(mspDir, "signcerts"), name, orgUnits, nil, &priv.PublicKey,
+		x509.KeyUsageDigitalSignature, nil)
+	if err != nil {
+		return err
+	}
+	if err := writeCACerts(mspDir, signCA, tlsCA); err != nil {
+		return err
+	}
+	if nodeOUs {
+		if err := writeNodeOUsConfig(mspDir, signCA); err != nil {
+			return err
+		}
+	} else {
+		// without NodeOUs, the signing identity is also an admin of its own MSP
+		if err := writeFile(filepath.Join(mspDir, "admincerts", certFilename(name)), certPEM(cert), 0644); err != nil {
+			return err
+		}
+	}
+
+	tlsPriv, err := generatePrivateKey(tlsDir)
+	if err != nil {
+		return err
+	}
+	_, err = tlsCA.signCertificate(tlsDir, name, nil, sans, &tlsPriv.PublicKey,
+		x509.KeyUsageDigitalSignature|x509.KeyUsageKeyEncipherment,
+		[]x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth})
+	if err != nil {
+		return err
+	}
+	if err := writeFile(filepath.Join(tlsDir, "ca.crt"), certPEM(tlsCA.cert), 0644); err != nil {
+		return err
+	}
+
+	prefix := "server"
+	if nodeType == nodeTypeClient || nodeType == nodeTypeAdmin {
+		prefix = "client"
+	}
+	if err := os.Rename(filepath.Join(tlsDir, certFilename(name)), filepath.Join(tlsDir, prefix+".crt")); err != nil {
+		return err
+	}
+	return os.Rename(filepath.Join(tlsDir, privateKeyFilename), filepath.Join(tlsDir, prefix+".key"))
+}
+
+// generates the MSP of an organization, which only contains the CA certificates
+func generateVerifyingMSP(mspDir string, signCA *ca, tlsCA *ca, nodeOUs bool) error {
+	if err := writeCACerts(mspDir, signCA, tlsCA); err != nil {
+		return err
+	}
+	if nodeOUs {
+		return writeNodeOUsConfig(mspDir, signCA)
+	}
+	return nil
+}
+
+func writeCACerts(mspDir string, signCA *ca, tlsCA *ca) error {
+	if err := writeFile(filepath.Join(mspDir, "cacerts", certFilename(signCA.name)), certPEM(signCA.cert), 0644); err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(mspDir, "tlscacerts", certFilename(tlsCA.name)), certPEM(tlsCA.cert), 0644)
+}
+
+func writeNodeOUsConfig(mspDir string, signCA *ca) error {
+	caCert := "cacerts/" + certFilename(signCA.name)
+	config := nodeOUsConfig{
+		NodeOUs: nodeOUs{
+			Enable:              true,
+			ClientOUIdentifier:  orgUnitIdentifiersConf{Certificate: caCert, OrganizationalUnitIdentifier: nodeTypeClient},
+			PeerOUIdentifier:    orgUnitIdentifiersConf{Certificate: caCert, OrganizationalUnitIdentifier: nodeTypePeer},
+			AdminOUIdentifier:   orgUnitIdentifiersConf{Certificate: caCert, OrganizationalUnitIdentifier: nodeTypeAdmin},
+			OrdererOUIdentifier: orgUnitIdentifiersConf{Certificate: caCert, OrganizationalUnitIdentifier: nodeTypeOrderer},
+		},
+	}
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(mspDir, "config.yaml"), data, 0644)
+}
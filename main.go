@@ -8,16 +8,20 @@ import (
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 
 	"github.com/raftAtGit/hl-fabric-operator/api/v1alpha1"
 	"github.com/raftAtGit/hl-fabric-operator/controllers"
+	"github.com/raftAtGit/hl-fabric-operator/webhooks"
 
 	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
 	// +kubebuilder:scaffold:imports
@@ -40,11 +44,28 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var enableWebhooks bool
+	var maxConcurrentReconciles int
+	var argoServer controllers.ArgoServerOptions
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.BoolVar(&enableWebhooks, "enable-webhooks", false,
+		"Enable defaulting and validating admission webhooks for FabricNetworks. "+
+			"Requires the webhook server certificates, see config/certmanager.")
+	flag.IntVar(&maxConcurrentReconciles, "max-concurrent-reconciles", 1,
+		"Maximum number of FabricNetworks reconciled concurrently. A single FabricNetwork is never reconciled concurrently.")
+	flag.StringVar(&argoServer.URL, "argo-server-url", "",
+		"URL of Argo Server, i.e. https://argo-server.argo:2746. If set, Argo workflows are managed through Argo Server "+
+			"instead of the Kubernetes API.")
+	flag.StringVar(&argoServer.TokenFile, "argo-server-token-file", "",
+		"File containing the bearer token to authenticate to Argo Server with.")
+	flag.StringVar(&argoServer.CAFile, "argo-server-ca-file", "",
+		"File containing the PEM encoded CA certificates to verify Argo Server with. System CAs are used if not set.")
+	flag.BoolVar(&argoServer.InsecureSkipVerify, "argo-server-insecure-skip-verify", false,
+		"Skip verifying the TLS certificate of Argo Server.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -61,20 +82,51 @@ func main() {
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
 		LeaderElectionID:       "fabric-operator",
+		Client: client.Options{
+			Cache: &client.CacheOptions{
+				// Secrets and ConfigMaps are read from the API server, otherwise the contents of all of them in the cluster are cached,
+				// including the TAR archived chaincodes
+				DisableFor: []client.Object{&corev1.Secret{}, &corev1.ConfigMap{}},
+			},
+		},
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
+	var argoServerClient *controllers.ArgoServerClient
+	if argoServer.URL != "" {
+		if argoServerClient, err = controllers.NewArgoServerClient(argoServer); err != nil {
+			setupLog.Error(err, "unable to create Argo Server client")
+			os.Exit(1)
+		}
+		setupLog.Info("managing Argo workflows through Argo Server", "url", argoServer.URL)
+	}
+
 	if err = (&controllers.FabricNetworkReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("FabricNetwork"),
-		Scheme: mgr.GetScheme(),
+		Client:     mgr.GetClient(),
+		Log:        ctrl.Log.WithName("controllers").WithName("FabricNetwork"),
+		Scheme:     mgr.GetScheme(),
+		Recorder:   mgr.GetEventRecorderFor("fabric-operator"),
+		Clientset:  kubernetes.NewForConfigOrDie(mgr.GetConfig()),
+		APIReader:  mgr.GetAPIReader(),
+		ArgoServer: argoServerClient,
+
+		MaxConcurrentReconciles: maxConcurrentReconciles,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "FabricNetwork")
 		os.Exit(1)
 	}
+	if enableWebhooks {
+		if err = (&webhooks.FabricNetworkWebhook{
+			Client: mgr.GetClient(),
+			Log:    ctrl.Log.WithName("webhooks").WithName("FabricNetwork"),
+		}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "FabricNetwork")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("health", healthz.Ping); err != nil {
@@ -0,0 +1,83 @@
+package validation
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/raftAtGit/hl-fabric-operator/api/v1alpha1"
+)
+
+// anchor peer hosts used by PIVT, i.e. peer1.atlantis.com with useActualDomains, otherwise hlf-peer--atlantis--peer1
+var (
+	actualDomainPeerHost = regexp.MustCompile(`^peer(\d+)\.(.+)$`)
+	servicePeerHost      = regexp.MustCompile(`^hlf-peer--(.+)--peer(\d+)$`)
+)
+
+// only the anchor peers of channel profiles in configtx.yaml
+type configtxAnchorPeers struct {
+	Profiles map[string]*struct {
+		Application *struct {
+			Organizations []*struct {
+				AnchorPeers []struct {
+					Host string `json:"Host"`
+				} `json:"AnchorPeers"`
+			} `json:"Organizations"`
+		} `json:"Application"`
+	} `json:"Profiles"`
+}
+
+// AnchorPeerCounts returns the minimum peerCount of the peer organizations with anchor peers in the channels of the FabricNetwork.
+// channel-flow creates each channel from the configtx.yaml profile named after the channel.
+// Anchor peers are matched to organizations by domain or by PIVT service name, i.e. peer1.atlantis.com needs peerCount 2
+func AnchorPeerCounts(network *v1alpha1.FabricNetwork, configtx []byte) (map[string]int32, error) {
+	config := configtxAnchorPeers{}
+	if err := yaml.Unmarshal(configtx, &config); err != nil {
+		return nil, fmt.Errorf("failed parsing configtx.yaml: %w", err)
+	}
+
+	counts := make(map[string]int32)
+	for _, channel := range network.Spec.Network.Channels {
+		profile := config.Profiles[channel.Name]
+		if profile == nil || profile.Application == nil {
+			continue
+		}
+		for _, org := range profile.Application.Organizations {
+			if org == nil {
+				continue
+			}
+			for _, anchorPeer := range org.AnchorPeers {
+				name, count := anchorPeerOrg(&network.Spec.Topology, anchorPeer.Host)
+				if name != "" && count > counts[name] {
+					counts[name] = count
+				}
+			}
+		}
+	}
+	return counts, nil
+}
+
+// returns the peer organization of the anchor peer host and the peerCount it needs, empty name if not known
+func anchorPeerOrg(topology *v1alpha1.Topology, host string) (string, int32) {
+	var domain, orgName, index string
+	if match := actualDomainPeerHost.FindStringSubmatch(host); match != nil {
+		index, domain = match[1], match[2]
+	} else if match := servicePeerHost.FindStringSubmatch(host); match != nil {
+		orgName, index = match[1], match[2]
+	} else {
+		return "", 0
+	}
+	i, err := strconv.Atoi(index)
+	if err != nil {
+		return "", 0
+	}
+	for _, p := range topology.PeerOrgs {
+		if (domain != "" && p.Domain == domain) || (orgName != "" && strings.ToLower(p.Name) == orgName) {
+			return p.Name, int32(i) + 1
+		}
+	}
+	return "", 0
+}
@@ -0,0 +1,162 @@
+package validation
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"github.com/raftAtGit/hl-fabric-operator/api/v1alpha1"
+)
+
+const (
+	// LegacyHelmRelease is the name of the hlf-kube Helm release of FabricNetworks created before names are derived from FabricNetwork name
+	LegacyHelmRelease = "hlf-kube"
+	// LegacyConfigtxSecret is the name of the Secret containing configtx.yaml of FabricNetworks created before names are derived from FabricNetwork name
+	LegacyConfigtxSecret = "hlf-configtx.yaml"
+	// LegacyCryptoConfigSecret is the name of the Secret containing the TAR archived crypto material of FabricNetworks created before names are derived from FabricNetwork name
+	LegacyCryptoConfigSecret = "hlf-crypto-config"
+
+	// GenesisSecret is the name of the Secret containing the genesis block.
+	// PIVT charts use this fixed name, so it's shared by all FabricNetworks in a namespace
+	GenesisSecret = "hlf-genesis.block"
+
+	// PIVT charts read chaincode ConfigMaps with this prefix and the chaincode name
+	chaincodeConfigMapPrefix = "hlf-chaincode--"
+
+	helmReleasePrefix  = "hlf-kube--"
+	configtxPrefix     = "hlf-configtx--"
+	cryptoConfigPrefix = "hlf-crypto-config--"
+
+	// Helm release names are limited to 53 characters
+	maxNameLength = 53 - len(helmReleasePrefix)
+)
+
+// HelmReleaseName returns the name of the hlf-kube Helm release of the FabricNetwork
+func HelmReleaseName(network string) string {
+	return helmReleasePrefix + network
+}
+
+// ConfigtxSecretName returns the name of the Secret containing configtx.yaml of the FabricNetwork
+func ConfigtxSecretName(network string) string {
+	return configtxPrefix + network
+}
+
+// CryptoConfigSecretName returns the name of the Secret containing the TAR archived crypto material of the FabricNetwork
+func CryptoConfigSecretName(network string) string {
+	return cryptoConfigPrefix + network
+}
+
+// ChaincodeConfigMapName returns the name of the ConfigMap containing the TAR archived chaincode
+func ChaincodeConfigMapName(chaincode string) string {
+	return chaincodeConfigMapPrefix + strings.ToLower(chaincode)
+}
+
+// UsesLegacyNames returns true if the FabricNetwork is installed before Helm release and Secret names are derived from FabricNetwork name
+func UsesLegacyNames(network *v1alpha1.FabricNetwork) bool {
+	if network.Status.HelmRelease != "" {
+		return network.Status.HelmRelease == LegacyHelmRelease
+	}
+	switch network.Status.State {
+	case "", v1alpha1.StateInvalid, v1alpha1.StateRejected:
+		// nothing is installed yet
+		return false
+	}
+	return true
+}
+
+// HelmRelease returns the name of the hlf-kube Helm release of the FabricNetwork, considering the legacy FabricNetworks
+func HelmRelease(network *v1alpha1.FabricNetwork) string {
+	if network.Status.HelmRelease != "" {
+		return network.Status.HelmRelease
+	}
+	if UsesLegacyNames(network) {
+		return LegacyHelmRelease
+	}
+	return HelmReleaseName(network.Name)
+}
+
+// CryptoConfigSecret returns the name of the Secret the crypto material of the FabricNetwork is read from and stored to
+func CryptoConfigSecret(network *v1alpha1.FabricNetwork) string {
+	if network.Spec.CryptoConfig.Secret != "" {
+		return network.Spec.CryptoConfig.Secret
+	}
+	if UsesLegacyNames(network) {
+		return LegacyCryptoConfigSecret
+	}
+	return CryptoConfigSecretName(network.Name)
+}
+
+// ValidateNoConflicts checks the FabricNetwork does not conflict with other FabricNetworks in the same namespace.
+// Helm release and Secret names are derived from FabricNetwork name,
+// but PIVT charts name their resources after organizations and use fixed names for the genesis block and chaincodes.
+func ValidateNoConflicts(network *v1alpha1.FabricNetwork, others []v1alpha1.FabricNetwork) field.ErrorList {
+	allErrs := field.ErrorList{}
+	specPath := field.NewPath("spec")
+	topologyPath := specPath.Child("topology")
+
+	for i := range others {
+		other := &others[i]
+		if other.Name == network.Name || other.Status.State == v1alpha1.StateRejected {
+			continue
+		}
+		if !installedBefore(other, network) {
+			continue
+		}
+		detail := fmt.Sprintf("conflicts with FabricNetwork %v in the same namespace", other.Name)
+
+		ordererOrgs := other.Spec.Topology.OrdererOrgNames()
+		for j, o := range network.Spec.Topology.OrdererOrgs {
+			if ordererOrgs[o.Name] || other.Spec.Topology.PeerOrgByName(o.Name) != nil {
+				allErrs = append(allErrs, field.Invalid(topologyPath.Child("ordererOrgs").Index(j).Child("name"), o.Name, detail))
+			}
+		}
+		peerOrgs := other.Spec.Topology.PeerOrgNames()
+		for j, p := range network.Spec.Topology.PeerOrgs {
+			if peerOrgs[p.Name] || other.Spec.Topology.OrdererOrgByName(p.Name) != nil {
+				allErrs = append(allErrs, field.Invalid(topologyPath.Child("peerOrgs").Index(j).Child("name"), p.Name, detail))
+			}
+		}
+
+		chaincodes := make(map[string]bool)
+		for _, c := range other.Spec.Network.Chaincodes {
+			chaincodes[ChaincodeConfigMapName(c.Name)] = true
+		}
+		for j, c := range network.Spec.Network.Chaincodes {
+			if chaincodes[ChaincodeConfigMapName(c.Name)] {
+				allErrs = append(allErrs, field.Invalid(specPath.Child("network", "chaincodes").Index(j).Child("name"), c.Name, detail+", ConfigMap "+ChaincodeConfigMapName(c.Name)))
+			}
+		}
+
+		allErrs = append(allErrs, field.Invalid(specPath.Child("genesis"), GenesisSecret, detail+", genesis Secret has a fixed name in PIVT charts"))
+	}
+
+	return allErrs
+}
+
+// returns true if other FabricNetwork is installed or accepted before the FabricNetwork.
+// between two new FabricNetworks, the older one wins
+func installedBefore(other *v1alpha1.FabricNetwork, network *v1alpha1.FabricNetwork) bool {
+	switch other.Status.State {
+	case "", v1alpha1.StateInvalid:
+	default:
+		return true
+	}
+	if network.CreationTimestamp.IsZero() {
+		// not submitted yet
+		return true
+	}
+	if other.CreationTimestamp.Equal(&network.CreationTimestamp) {
+		return other.Name < network.Name
+	}
+	return other.CreationTimestamp.Before(&network.CreationTimestamp)
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package validation
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/raftAtGit/hl-fabric-operator/api/v1alpha1"
+)
+
+func TestNames(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       v1alpha1.FabricNetworkStatus
+		cryptoSecret string
+		legacy       bool
+		helmRelease  string
+		cryptoConfig string
+	}{
+		{"new", v1alpha1.FabricNetworkStatus{}, "", false, "hlf-kube--simple", "hlf-crypto-config--simple"},
+		{"invalid", v1alpha1.FabricNetworkStatus{State: v1alpha1.StateInvalid}, "", false, "hlf-kube--simple", "hlf-crypto-config--simple"},
+		{"installed before derived names", v1alpha1.FabricNetworkStatus{State: v1alpha1.StateReady}, "", true, "hlf-kube", "hlf-crypto-config"},
+		{"release in status", v1alpha1.FabricNetworkStatus{State: v1alpha1.StateReady, HelmRelease: "hlf-kube--simple"}, "", false, "hlf-kube--simple", "hlf-crypto-config--simple"},
+		{"legacy release in status", v1alpha1.FabricNetworkStatus{State: v1alpha1.StateReady, HelmRelease: "hlf-kube"}, "", true, "hlf-kube", "hlf-crypto-config"},
+		{"crypto-config secret in spec", v1alpha1.FabricNetworkStatus{State: v1alpha1.StateReady}, "hlf-crypto-config--simple", true, "hlf-kube", "hlf-crypto-config--simple"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			network := &v1alpha1.FabricNetwork{ObjectMeta: metav1.ObjectMeta{Name: "simple"}, Status: test.status}
+			network.Spec.CryptoConfig.Secret = test.cryptoSecret
+			if legacy := UsesLegacyNames(network); legacy != test.legacy {
+				t.Errorf("legacy names is %v, expected %v", legacy, test.legacy)
+			}
+			if release := HelmRelease(network); release != test.helmRelease {
+				t.Errorf("Helm release is %v, expected %v", release, test.helmRelease)
+			}
+			if secret := CryptoConfigSecret(network); secret != test.cryptoConfig {
+				t.Errorf("crypto-config Secret is %v, expected %v", secret, test.cryptoConfig)
+			}
+		})
+	}
+
+	if name := ChaincodeConfigMapName("Even-Simpler"); name != "hlf-chaincode--even-simpler" {
+		t.Errorf("chaincode ConfigMap is %v", name)
+	}
+}
+
+func TestValidateNoConflicts(t *testing.T) {
+	now := time.Now()
+	other := func(name string, state v1alpha1.State, created time.Time) v1alpha1.FabricNetwork {
+		network := testNetwork()
+		network.Name = name
+		network.CreationTimestamp = metav1.NewTime(created)
+		network.Status.State = state
+		return *network
+	}
+
+	tests := []struct {
+		name   string
+		others []v1alpha1.FabricNetwork
+		errors []string
+	}{
+		{"alone", nil, []string{}},
+		{"itself", []v1alpha1.FabricNetwork{other("simple", v1alpha1.StateReady, now)}, []string{}},
+		{"rejected other", []v1alpha1.FabricNetwork{other("other", v1alpha1.StateRejected, now)}, []string{}},
+		{"newer other", []v1alpha1.FabricNetwork{other("other", "", now.Add(time.Minute))}, []string{}},
+		{"same orgs and chaincode", []v1alpha1.FabricNetwork{other("other", v1alpha1.StateReady, now.Add(time.Minute))}, []string{
+			"FieldValueInvalid spec.topology.ordererOrgs[0].name",
+			"FieldValueInvalid spec.topology.peerOrgs[0].name",
+			"FieldValueInvalid spec.topology.peerOrgs[1].name",
+			"FieldValueInvalid spec.network.chaincodes[0].name",
+			"FieldValueInvalid spec.genesis",
+		}},
+		{"older new other", []v1alpha1.FabricNetwork{other("other", "", now.Add(-time.Minute))}, []string{
+			"FieldValueInvalid spec.topology.ordererOrgs[0].name",
+			"FieldValueInvalid spec.topology.peerOrgs[0].name",
+			"FieldValueInvalid spec.topology.peerOrgs[1].name",
+			"FieldValueInvalid spec.network.chaincodes[0].name",
+			"FieldValueInvalid spec.genesis",
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			network := testNetwork()
+			network.CreationTimestamp = metav1.NewTime(now)
+			if fields := errorFields(ValidateNoConflicts(network, test.others)); !equalFields(fields, test.errors) {
+				t.Errorf("errors are %v, expected %v", fields, test.errors)
+			}
+		})
+	}
+}
@@ -0,0 +1,370 @@
+// Package validation contains the FabricNetwork validation shared by Fabric Operator and the CLI
+package validation
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	corev1 "k8s.io/api/core/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/raftAtGit/hl-fabric-operator/api/v1alpha1"
+)
+
+// ValidateSpec validates the FabricNetwork spec without accessing the cluster.
+// Both local file system references and Kubernetes references are accepted.
+func ValidateSpec(network *v1alpha1.FabricNetwork) field.ErrorList {
+	allErrs := field.ErrorList{}
+	specPath := field.NewPath("spec")
+
+	allErrs = append(allErrs, validateName(network.Name, field.NewPath("metadata", "name"))...)
+	allErrs = append(allErrs, validateSources(network, specPath)...)
+	allErrs = append(allErrs, validateTopology(&network.Spec.Topology, specPath.Child("topology"))...)
+	allErrs = append(allErrs, validateNetwork(network, specPath.Child("network"))...)
+	allErrs = append(allErrs, validateRetryPolicy(network.Spec.RetryPolicy, specPath.Child("retryPolicy"))...)
+	allErrs = append(allErrs, validatePositiveDuration(network.Spec.Helm.Timeout, specPath.Child("helm", "timeout"))...)
+	allErrs = append(allErrs, validateCharts(&network.Spec.Charts, specPath.Child("charts"))...)
+
+	return allErrs
+}
+
+// ValidateNoLocalReferences checks there are no references to local file system in the FabricNetwork spec.
+// Local file system references can only be used via CLI, which replaces them with Secrets and ConfigMaps.
+func ValidateNoLocalReferences(network *v1alpha1.FabricNetwork) field.ErrorList {
+	allErrs := field.ErrorList{}
+	specPath := field.NewPath("spec")
+	detail := "local file system references can only be used via CLI"
+
+	if network.Spec.Configtx.File != "" {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("configtx", "file"), detail))
+	}
+	if network.Spec.Genesis.File != "" {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("genesis", "file"), detail))
+	}
+	if network.Spec.CryptoConfig.Folder != "" {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("crypto-config", "folder"), detail))
+	}
+	if network.Spec.Chaincode.Folder != "" {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("chaincode", "folder"), detail))
+	}
+	return allErrs
+}
+
+// ValidateReferences checks the Secrets and ConfigMaps referenced by the FabricNetwork exist in the given namespace.
+// References to local file system are skipped. Returned error is only set if accessing the cluster fails.
+func ValidateReferences(ctx context.Context, cl client.Client, namespace string, network *v1alpha1.FabricNetwork) (field.ErrorList, error) {
+	allErrs := field.ErrorList{}
+	specPath := field.NewPath("spec")
+
+	secrets := []struct {
+		path *field.Path
+		name string
+	}{
+		{specPath.Child("configtx", "secret"), network.Spec.Configtx.Secret},
+		{specPath.Child("genesis", "secret"), network.Spec.Genesis.Secret},
+		{specPath.Child("crypto-config", "secret"), network.Spec.CryptoConfig.Secret},
+	}
+	for _, s := range secrets {
+		if s.name == "" {
+			continue
+		}
+		exists, err := objectExists(ctx, cl, namespace, s.name, &corev1.Secret{})
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			allErrs = append(allErrs, field.NotFound(s.path, s.name))
+		}
+	}
+
+	if network.Spec.Chaincode.Folder == "" {
+		ccPath := specPath.Child("network", "chaincodes")
+		for i, chaincode := range network.Spec.Network.Chaincodes {
+			name := ChaincodeConfigMapName(chaincode.Name)
+			exists, err := objectExists(ctx, cl, namespace, name, &corev1.ConfigMap{})
+			if err != nil {
+				return nil, err
+			}
+			if !exists {
+				allErrs = append(allErrs, field.NotFound(ccPath.Index(i).Child("name"), "ConfigMap "+name))
+			}
+		}
+	}
+
+	return allErrs, nil
+}
+
+// ValidateTransition validates the changes from old to new FabricNetwork spec,
+// which cannot be handled by Fabric Operator once the network is running.
+// anchorPeerCounts is the minimum peerCount of peer organizations as returned by AnchorPeerCounts, peerCount decreases are not checked if nil
+func ValidateTransition(old *v1alpha1.FabricNetwork, new *v1alpha1.FabricNetwork, anchorPeerCounts map[string]int32) field.ErrorList {
+	allErrs := field.ErrorList{}
+	topologyPath := field.NewPath("spec", "topology")
+
+	newOrdererOrgs := new.Spec.Topology.OrdererOrgNames()
+	for _, o := range old.Spec.Topology.OrdererOrgs {
+		if !newOrdererOrgs[o.Name] {
+			allErrs = append(allErrs, field.Forbidden(topologyPath.Child("ordererOrgs"),
+				fmt.Sprintf("orderer organization %v cannot be removed", o.Name)))
+		}
+	}
+
+	for i, p := range new.Spec.Topology.PeerOrgs {
+		oldOrg := old.Spec.Topology.PeerOrgByName(p.Name)
+		if oldOrg == nil || p.PeerCount >= oldOrg.PeerCount {
+			continue
+		}
+		// anchor peers of channels should remain
+		if required := anchorPeerCounts[p.Name]; p.PeerCount < required {
+			allErrs = append(allErrs, field.Forbidden(topologyPath.Child("peerOrgs").Index(i).Child("peerCount"),
+				fmt.Sprintf("peer organization %v has anchor peer peer%d in channels, peerCount cannot be decreased below %d", p.Name, required-1, required)))
+		}
+	}
+
+	oldChaincodes := old.Spec.Network.Chaincodes
+	newChaincodes := new.Spec.Network.Chaincodes
+	if len(oldChaincodes) == len(newChaincodes) {
+		newNames := make(map[string]bool)
+		for _, cc := range newChaincodes {
+			newNames[cc.Name] = true
+		}
+		for i, cc := range oldChaincodes {
+			if newChaincodes[i].Name != cc.Name && !newNames[cc.Name] {
+				allErrs = append(allErrs, field.Forbidden(field.NewPath("spec", "network", "chaincodes").Index(i).Child("name"),
+					fmt.Sprintf("chaincode %v cannot be renamed in place, remove it and add a new chaincode instead", cc.Name)))
+			}
+		}
+	}
+
+	return allErrs
+}
+
+func validateName(name string, namePath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if len(name) > maxNameLength {
+		allErrs = append(allErrs, field.TooLong(namePath, name, maxNameLength))
+	}
+	return allErrs
+}
+
+func validateSources(network *v1alpha1.FabricNetwork, specPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	spec := &network.Spec
+
+	configtxPath := specPath.Child("configtx")
+	if spec.Configtx.Secret == "" && spec.Configtx.File == "" {
+		allErrs = append(allErrs, field.Required(configtxPath, "either configtx.secret or configtx.file is required"))
+	}
+	if spec.Configtx.Secret != "" && spec.Configtx.File != "" {
+		allErrs = append(allErrs, field.Invalid(configtxPath, spec.Configtx, "both configtx.secret and configtx.file are provided, only either one is required"))
+	}
+	if supported := []string{LegacyConfigtxSecret, ConfigtxSecretName(network.Name)}; spec.Configtx.Secret != "" && !contains(supported, spec.Configtx.Secret) {
+		allErrs = append(allErrs, field.NotSupported(configtxPath.Child("secret"), spec.Configtx.Secret, supported))
+	}
+
+	genesisPath := specPath.Child("genesis")
+	if spec.Genesis.IsProvided() && !spec.CryptoConfig.IsProvided() {
+		allErrs = append(allErrs, field.Invalid(genesisPath, spec.Genesis, "genesis block is provided but crypto-config is not provided. Genesis block will not match generated certificates"))
+	}
+	if spec.Genesis.Secret != "" && spec.Genesis.File != "" {
+		allErrs = append(allErrs, field.Invalid(genesisPath, spec.Genesis, "both genesis.secret and genesis.file are provided, at most one is allowed"))
+	}
+	if spec.Genesis.Secret != "" && spec.Genesis.Secret != GenesisSecret {
+		allErrs = append(allErrs, field.NotSupported(genesisPath.Child("secret"), spec.Genesis.Secret, []string{GenesisSecret}))
+	}
+
+	cryptoConfigPath := specPath.Child("crypto-config")
+	if spec.CryptoConfig.Secret != "" && spec.CryptoConfig.Folder != "" {
+		allErrs = append(allErrs, field.Invalid(cryptoConfigPath, spec.CryptoConfig, "both crypto-config.secret and crypto-config.folder are provided, at most one is allowed"))
+	}
+	if supported := []string{LegacyCryptoConfigSecret, CryptoConfigSecretName(network.Name)}; spec.CryptoConfig.Secret != "" && !contains(supported, spec.CryptoConfig.Secret) {
+		allErrs = append(allErrs, field.NotSupported(cryptoConfigPath.Child("secret"), spec.CryptoConfig.Secret, supported))
+	}
+
+	return allErrs
+}
+
+func validateTopology(topology *v1alpha1.Topology, topologyPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	if topology.Version == "" {
+		allErrs = append(allErrs, field.Required(topologyPath.Child("version"), "Hyperledger Fabric version is required"))
+	}
+	if topology.TLSEnabled && !topology.UseActualDomains {
+		allErrs = append(allErrs, field.Invalid(topologyPath.Child("tlsEnabled"), topology.TLSEnabled, "tlsEnabled is true but useActualDomains is false"))
+	}
+
+	// org names and domains should be unique across both orderer and peer organizations
+	names := make(map[string]bool)
+	domains := make(map[string]bool)
+
+	ordererPath := topologyPath.Child("ordererOrgs")
+	for i, o := range topology.OrdererOrgs {
+		allErrs = append(allErrs, validateOrg(o.Name, o.Domain, ordererPath.Index(i), names, domains)...)
+
+		if len(o.Hosts) == 0 {
+			allErrs = append(allErrs, field.Required(ordererPath.Index(i).Child("hosts"), "at least one orderer host is required"))
+		}
+		hosts := make(map[string]bool)
+		for j, h := range o.Hosts {
+			if hosts[h] {
+				allErrs = append(allErrs, field.Duplicate(ordererPath.Index(i).Child("hosts").Index(j), h))
+			}
+			hosts[h] = true
+		}
+	}
+
+	peerPath := topologyPath.Child("peerOrgs")
+	for i, p := range topology.PeerOrgs {
+		allErrs = append(allErrs, validateOrg(p.Name, p.Domain, peerPath.Index(i), names, domains)...)
+
+		if p.PeerCount <= 0 {
+			allErrs = append(allErrs, field.Invalid(peerPath.Index(i).Child("peerCount"), p.PeerCount, "must be greater than 0"))
+		}
+	}
+
+	return allErrs
+}
+
+func validateOrg(name string, domain string, orgPath *field.Path, names map[string]bool, domains map[string]bool) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	if name == "" {
+		allErrs = append(allErrs, field.Required(orgPath.Child("name"), ""))
+	} else if names[name] {
+		allErrs = append(allErrs, field.Duplicate(orgPath.Child("name"), name))
+	}
+	names[name] = true
+
+	if domain == "" {
+		allErrs = append(allErrs, field.Required(orgPath.Child("domain"), ""))
+	} else if domains[domain] {
+		allErrs = append(allErrs, field.Duplicate(orgPath.Child("domain"), domain))
+	}
+	domains[domain] = true
+
+	return allErrs
+}
+
+func validateNetwork(network *v1alpha1.FabricNetwork, networkPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	peerOrgs := network.Spec.Topology.PeerOrgNames()
+
+	channels := make(map[string]bool)
+	for i, channel := range network.Spec.Network.Channels {
+		channelPath := networkPath.Child("channels").Index(i)
+		if channels[channel.Name] {
+			allErrs = append(allErrs, field.Duplicate(channelPath.Child("name"), channel.Name))
+		}
+		channels[channel.Name] = true
+
+		allErrs = append(allErrs, validateOrgReferences(channel.Orgs, peerOrgs, channelPath.Child("orgs"))...)
+	}
+
+	chaincodes := make(map[string]bool)
+	for i, chaincode := range network.Spec.Network.Chaincodes {
+		ccPath := networkPath.Child("chaincodes").Index(i)
+		if chaincodes[chaincode.Name] {
+			allErrs = append(allErrs, field.Duplicate(ccPath.Child("name"), chaincode.Name))
+		}
+		chaincodes[chaincode.Name] = true
+
+		if network.Spec.Chaincode.Language == "" && chaincode.Language == "" {
+			allErrs = append(allErrs, field.Required(ccPath.Child("language"), "global chaincode language is not specified"))
+		}
+		if network.Spec.Chaincode.Version == "" && chaincode.Version == "" {
+			allErrs = append(allErrs, field.Required(ccPath.Child("version"), "global chaincode version is not specified"))
+		}
+
+		allErrs = append(allErrs, validateOrgReferences(chaincode.Orgs, peerOrgs, ccPath.Child("orgs"))...)
+		for j, ccChannel := range chaincode.CcChannel {
+			allErrs = append(allErrs, validateOrgReferences(ccChannel.Orgs, peerOrgs, ccPath.Child("channels").Index(j).Child("orgs"))...)
+		}
+	}
+
+	return allErrs
+}
+
+func validateRetryPolicy(policy *v1alpha1.RetryPolicy, policyPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if policy == nil {
+		return allErrs
+	}
+
+	if policy.MaxRetries < 0 {
+		allErrs = append(allErrs, field.Invalid(policyPath.Child("maxRetries"), policy.MaxRetries, "must be greater than or equal to 0"))
+	}
+	allErrs = append(allErrs, validatePositiveDuration(policy.Backoff, policyPath.Child("backoff"))...)
+	allErrs = append(allErrs, validatePositiveDuration(policy.MaxBackoff, policyPath.Child("maxBackoff"))...)
+
+	flows := []struct {
+		name   string
+		policy *v1alpha1.FlowRetryPolicy
+	}{
+		{"channel-flow", policy.ChannelFlow},
+		{"chaincode-flow", policy.ChaincodeFlow},
+		{"peer-org-flow", policy.PeerOrgFlow},
+	}
+	for _, f := range flows {
+		flow := f.policy
+		if flow == nil {
+			continue
+		}
+		flowPath := policyPath.Child(f.name)
+		if flow.MaxRetries != nil && *flow.MaxRetries < 0 {
+			allErrs = append(allErrs, field.Invalid(flowPath.Child("maxRetries"), *flow.MaxRetries, "must be greater than or equal to 0"))
+		}
+		allErrs = append(allErrs, validatePositiveDuration(flow.Backoff, flowPath.Child("backoff"))...)
+	}
+
+	return allErrs
+}
+
+func validateCharts(charts *v1alpha1.Charts, chartsPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if charts.Repository == "" {
+		return allErrs
+	}
+
+	u, err := url.Parse(charts.Repository)
+	if err != nil || u.Host == "" {
+		allErrs = append(allErrs, field.Invalid(chartsPath.Child("repository"), charts.Repository, "must be a valid URL"))
+	} else if u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "oci" {
+		allErrs = append(allErrs, field.NotSupported(chartsPath.Child("repository"), u.Scheme, []string{"http", "https", "oci"}))
+	}
+	return allErrs
+}
+
+func validatePositiveDuration(duration *metav1.Duration, durationPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if duration != nil && duration.Duration <= 0 {
+		allErrs = append(allErrs, field.Invalid(durationPath, duration.Duration.String(), "must be greater than 0"))
+	}
+	return allErrs
+}
+
+func validateOrgReferences(orgs []string, peerOrgs map[string]bool, orgsPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	for i, org := range orgs {
+		if !peerOrgs[org] {
+			allErrs = append(allErrs, field.Invalid(orgsPath.Index(i), org, "unknown peer organization"))
+		}
+	}
+	return allErrs
+}
+
+func objectExists(ctx context.Context, cl client.Client, namespace string, name string, obj client.Object) (bool, error) {
+	err := cl.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, obj)
+	if err != nil {
+		if apiErrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
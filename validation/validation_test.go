@@ -0,0 +1,364 @@
+package validation
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/raftAtGit/hl-fabric-operator/api/v1alpha1"
+)
+
+// a valid FabricNetwork, tests break it one field at a time
+func testNetwork() *v1alpha1.FabricNetwork {
+	return &v1alpha1.FabricNetwork{
+		ObjectMeta: metav1.ObjectMeta{Name: "simple", Namespace: "validation-test"},
+		Spec: v1alpha1.FabricNetworkSpec{
+			Configtx:  v1alpha1.Configtx{Secret: "hlf-configtx--simple"},
+			Chaincode: v1alpha1.ChaincodeConfig{Version: "1.0", Language: "golang"},
+			Topology: v1alpha1.Topology{
+				Version:          "1.4.9",
+				TLSEnabled:       true,
+				UseActualDomains: true,
+				OrdererOrgs: []v1alpha1.OrdererOrg{
+					{Name: "Groeifabriek", Domain: "groeifabriek.nl", Hosts: []string{"orderer0", "orderer1"}},
+				},
+				PeerOrgs: []v1alpha1.PeerOrg{
+					{Name: "Karga", Domain: "aptalkarga.tr", PeerCount: 2},
+					{Name: "Atlantis", Domain: "atlantis.com", PeerCount: 1},
+				},
+			},
+			Network: v1alpha1.Network{
+				Channels: []v1alpha1.Channel{
+					{Name: "common", Orgs: []string{"Karga", "Atlantis"}},
+				},
+				Chaincodes: []v1alpha1.Chaincode{
+					{
+						Name: "even-simpler",
+						Orgs: []string{"Karga", "Atlantis"},
+						CcChannel: []v1alpha1.CcChannel{
+							{Name: "common", Orgs: []string{"Karga", "Atlantis"}, Policy: "OR('KargaMSP.member','AtlantisMSP.member')"},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// returns the type and field of the errors, i.e. "FieldValueDuplicate spec.topology.peerOrgs[1].name"
+func errorFields(allErrs field.ErrorList) []string {
+	fields := []string{}
+	for _, err := range allErrs {
+		fields = append(fields, string(err.Type)+" "+err.Field)
+	}
+	return fields
+}
+
+func equalFields(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestValidateSpec(t *testing.T) {
+	negative := int32(-1)
+	tests := []struct {
+		name   string
+		modify func(network *v1alpha1.FabricNetwork)
+		errors []string
+	}{
+		{"valid", func(network *v1alpha1.FabricNetwork) {}, []string{}},
+		{"long name", func(network *v1alpha1.FabricNetwork) {
+			network.Name = "a-very-long-fabric-network-name-exceeding-limits-x"
+			network.Spec.Configtx.Secret = ConfigtxSecretName(network.Name)
+		}, []string{"FieldValueTooLong metadata.name"}},
+		{"missing configtx", func(network *v1alpha1.FabricNetwork) {
+			network.Spec.Configtx.Secret = ""
+		}, []string{"FieldValueRequired spec.configtx"}},
+		{"both configtx sources", func(network *v1alpha1.FabricNetwork) {
+			network.Spec.Configtx.File = "configtx.yaml"
+		}, []string{"FieldValueInvalid spec.configtx"}},
+		{"unsupported configtx secret", func(network *v1alpha1.FabricNetwork) {
+			network.Spec.Configtx.Secret = "my-configtx"
+		}, []string{"FieldValueNotSupported spec.configtx.secret"}},
+		{"legacy configtx secret", func(network *v1alpha1.FabricNetwork) {
+			network.Spec.Configtx.Secret = LegacyConfigtxSecret
+		}, []string{}},
+		{"genesis without crypto-config", func(network *v1alpha1.FabricNetwork) {
+			network.Spec.Genesis.File = "genesis.block"
+		}, []string{"FieldValueInvalid spec.genesis"}},
+		{"both genesis sources", func(network *v1alpha1.FabricNetwork) {
+			network.Spec.CryptoConfig.Folder = "crypto-config"
+			network.Spec.Genesis = v1alpha1.Genesis{File: "genesis.block", Secret: GenesisSecret}
+		}, []string{"FieldValueInvalid spec.genesis"}},
+		{"unsupported genesis secret", func(network *v1alpha1.FabricNetwork) {
+			network.Spec.CryptoConfig.Folder = "crypto-config"
+			network.Spec.Genesis.Secret = "my-genesis"
+		}, []string{"FieldValueNotSupported spec.genesis.secret"}},
+		{"both crypto-config sources", func(network *v1alpha1.FabricNetwork) {
+			network.Spec.CryptoConfig = v1alpha1.CryptoConfig{Folder: "crypto-config", Secret: CryptoConfigSecretName(network.Name)}
+		}, []string{"FieldValueInvalid spec.crypto-config"}},
+		{"unsupported crypto-config secret", func(network *v1alpha1.FabricNetwork) {
+			network.Spec.CryptoConfig.Secret = "my-crypto-config"
+		}, []string{"FieldValueNotSupported spec.crypto-config.secret"}},
+		{"missing version", func(network *v1alpha1.FabricNetwork) {
+			network.Spec.Topology.Version = ""
+		}, []string{"FieldValueRequired spec.topology.version"}},
+		{"tls without actual domains", func(network *v1alpha1.FabricNetwork) {
+			network.Spec.Topology.UseActualDomains = false
+		}, []string{"FieldValueInvalid spec.topology.tlsEnabled"}},
+		{"missing org name and domain", func(network *v1alpha1.FabricNetwork) {
+			network.Spec.Topology.OrdererOrgs[0].Name = ""
+			network.Spec.Topology.OrdererOrgs[0].Domain = ""
+		}, []string{"FieldValueRequired spec.topology.ordererOrgs[0].name", "FieldValueRequired spec.topology.ordererOrgs[0].domain"}},
+		{"duplicate org name and domain across orderer and peer orgs", func(network *v1alpha1.FabricNetwork) {
+			network.Spec.Topology.PeerOrgs[1].Name = "Groeifabriek"
+			network.Spec.Topology.PeerOrgs[1].Domain = "groeifabriek.nl"
+		}, []string{
+			"FieldValueDuplicate spec.topology.peerOrgs[1].name",
+			"FieldValueDuplicate spec.topology.peerOrgs[1].domain",
+			// channel and chaincode orgs refer to the renamed org
+			"FieldValueInvalid spec.network.channels[0].orgs[1]",
+			"FieldValueInvalid spec.network.chaincodes[0].orgs[1]",
+			"FieldValueInvalid spec.network.chaincodes[0].channels[0].orgs[1]",
+		}},
+		{"no orderer hosts", func(network *v1alpha1.FabricNetwork) {
+			network.Spec.Topology.OrdererOrgs[0].Hosts = nil
+		}, []string{"FieldValueRequired spec.topology.ordererOrgs[0].hosts"}},
+		{"duplicate orderer hosts", func(network *v1alpha1.FabricNetwork) {
+			network.Spec.Topology.OrdererOrgs[0].Hosts = []string{"orderer0", "orderer0"}
+		}, []string{"FieldValueDuplicate spec.topology.ordererOrgs[0].hosts[1]"}},
+		{"zero peerCount", func(network *v1alpha1.FabricNetwork) {
+			network.Spec.Topology.PeerOrgs[1].PeerCount = 0
+		}, []string{"FieldValueInvalid spec.topology.peerOrgs[1].peerCount"}},
+		{"duplicate channel", func(network *v1alpha1.FabricNetwork) {
+			network.Spec.Network.Channels = append(network.Spec.Network.Channels, network.Spec.Network.Channels[0])
+		}, []string{"FieldValueDuplicate spec.network.channels[1].name"}},
+		{"unknown channel org", func(network *v1alpha1.FabricNetwork) {
+			network.Spec.Network.Channels[0].Orgs = []string{"Karga", "Nevermore"}
+		}, []string{"FieldValueInvalid spec.network.channels[0].orgs[1]"}},
+		{"duplicate chaincode", func(network *v1alpha1.FabricNetwork) {
+			network.Spec.Network.Chaincodes = append(network.Spec.Network.Chaincodes, network.Spec.Network.Chaincodes[0])
+		}, []string{"FieldValueDuplicate spec.network.chaincodes[1].name"}},
+		{"missing chaincode language and version", func(network *v1alpha1.FabricNetwork) {
+			network.Spec.Chaincode = v1alpha1.ChaincodeConfig{}
+		}, []string{"FieldValueRequired spec.network.chaincodes[0].language", "FieldValueRequired spec.network.chaincodes[0].version"}},
+		{"chaincode language and version override", func(network *v1alpha1.FabricNetwork) {
+			network.Spec.Chaincode = v1alpha1.ChaincodeConfig{}
+			network.Spec.Network.Chaincodes[0].Language = "node"
+			network.Spec.Network.Chaincodes[0].Version = "2.0"
+		}, []string{}},
+		{"unknown chaincode orgs", func(network *v1alpha1.FabricNetwork) {
+			network.Spec.Network.Chaincodes[0].Orgs = []string{"Nevermore"}
+			network.Spec.Network.Chaincodes[0].CcChannel[0].Orgs = []string{"Atlantis", "Nevermore"}
+		}, []string{"FieldValueInvalid spec.network.chaincodes[0].orgs[0]", "FieldValueInvalid spec.network.chaincodes[0].channels[0].orgs[1]"}},
+		{"invalid retry policy", func(network *v1alpha1.FabricNetwork) {
+			network.Spec.RetryPolicy = &v1alpha1.RetryPolicy{
+				MaxRetries:    -1,
+				Backoff:       &metav1.Duration{Duration: 0},
+				MaxBackoff:    &metav1.Duration{Duration: -time.Second},
+				ChaincodeFlow: &v1alpha1.FlowRetryPolicy{MaxRetries: &negative, Backoff: &metav1.Duration{}},
+			}
+		}, []string{
+			"FieldValueInvalid spec.retryPolicy.maxRetries",
+			"FieldValueInvalid spec.retryPolicy.backoff",
+			"FieldValueInvalid spec.retryPolicy.maxBackoff",
+			"FieldValueInvalid spec.retryPolicy.chaincode-flow.maxRetries",
+			"FieldValueInvalid spec.retryPolicy.chaincode-flow.backoff",
+		}},
+		{"invalid helm timeout", func(network *v1alpha1.FabricNetwork) {
+			network.Spec.Helm.Timeout = &metav1.Duration{}
+		}, []string{"FieldValueInvalid spec.helm.timeout"}},
+		{"invalid chart repository", func(network *v1alpha1.FabricNetwork) {
+			network.Spec.Charts.Repository = "charts"
+		}, []string{"FieldValueInvalid spec.charts.repository"}},
+		{"unsupported chart repository scheme", func(network *v1alpha1.FabricNetwork) {
+			network.Spec.Charts.Repository = "ftp://charts.example.com"
+		}, []string{"FieldValueNotSupported spec.charts.repository"}},
+		{"oci chart repository", func(network *v1alpha1.FabricNetwork) {
+			network.Spec.Charts.Repository = "oci://registry.example.com/charts"
+		}, []string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			network := testNetwork()
+			test.modify(network)
+			if fields := errorFields(ValidateSpec(network)); !equalFields(fields, test.errors) {
+				t.Errorf("errors are %v, expected %v", fields, test.errors)
+			}
+		})
+	}
+}
+
+func TestValidateNoLocalReferences(t *testing.T) {
+	network := testNetwork()
+	if allErrs := ValidateNoLocalReferences(network); len(allErrs) != 0 {
+		t.Errorf("unexpected errors %v", allErrs)
+	}
+
+	network.Spec.Configtx.File = "configtx.yaml"
+	network.Spec.Genesis.File = "genesis.block"
+	network.Spec.CryptoConfig.Folder = "crypto-config"
+	network.Spec.Chaincode.Folder = "chaincode"
+	expected := []string{
+		"FieldValueForbidden spec.configtx.file",
+		"FieldValueForbidden spec.genesis.file",
+		"FieldValueForbidden spec.crypto-config.folder",
+		"FieldValueForbidden spec.chaincode.folder",
+	}
+	if fields := errorFields(ValidateNoLocalReferences(network)); !equalFields(fields, expected) {
+		t.Errorf("errors are %v, expected %v", fields, expected)
+	}
+}
+
+func TestValidateReferences(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	network := testNetwork()
+	network.Spec.CryptoConfig.Secret = CryptoConfigSecretName(network.Name)
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: network.Namespace, Name: network.Spec.Configtx.Secret}},
+	).Build()
+
+	allErrs, err := ValidateReferences(context.Background(), cl, network.Namespace, network)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"FieldValueNotFound spec.crypto-config.secret", "FieldValueNotFound spec.network.chaincodes[0].name"}
+	if fields := errorFields(allErrs); !equalFields(fields, expected) {
+		t.Errorf("errors are %v, expected %v", fields, expected)
+	}
+
+	// chaincodes are read from local folder by CLI
+	network.Spec.Chaincode.Folder = "chaincode"
+	allErrs, err = ValidateReferences(context.Background(), cl, network.Namespace, network)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fields := errorFields(allErrs); !equalFields(fields, expected[:1]) {
+		t.Errorf("errors are %v, expected %v", fields, expected[:1])
+	}
+}
+
+func TestValidateTransition(t *testing.T) {
+	// Karga has anchor peer peer1, Atlantis peer0
+	anchorPeerCounts := map[string]int32{"Karga": 2, "Atlantis": 1}
+	tests := []struct {
+		name   string
+		modify func(network *v1alpha1.FabricNetwork)
+		errors []string
+		// modifies the old FabricNetwork, if set
+		modifyOld func(old *v1alpha1.FabricNetwork)
+	}{
+		{"unchanged", func(network *v1alpha1.FabricNetwork) {}, []string{}, nil},
+		{"remove orderer org", func(network *v1alpha1.FabricNetwork) {
+			network.Spec.Topology.OrdererOrgs = nil
+		}, []string{"FieldValueForbidden spec.topology.ordererOrgs"}, nil},
+		{"add peer org", func(network *v1alpha1.FabricNetwork) {
+			network.Spec.Topology.PeerOrgs = append(network.Spec.Topology.PeerOrgs, v1alpha1.PeerOrg{Name: "Nevermore", Domain: "nevermore.io", PeerCount: 1})
+		}, []string{}, nil},
+		{"decrease peerCount below anchor peer", func(network *v1alpha1.FabricNetwork) {
+			network.Spec.Topology.PeerOrgs[0].PeerCount = 1
+		}, []string{"FieldValueForbidden spec.topology.peerOrgs[0].peerCount"}, nil},
+		{"decrease peerCount keeping anchor peer", func(network *v1alpha1.FabricNetwork) {}, []string{}, func(old *v1alpha1.FabricNetwork) {
+			old.Spec.Topology.PeerOrgs[1].PeerCount = 3
+		}},
+		{"rename chaincode in place", func(network *v1alpha1.FabricNetwork) {
+			network.Spec.Network.Chaincodes[0].Name = "simpler"
+		}, []string{"FieldValueForbidden spec.network.chaincodes[0].name"}, nil},
+		{"replace chaincode", func(network *v1alpha1.FabricNetwork) {
+			network.Spec.Network.Chaincodes = append(network.Spec.Network.Chaincodes, v1alpha1.Chaincode{Name: "simpler"})
+		}, []string{}, nil},
+		{"reorder chaincodes", func(network *v1alpha1.FabricNetwork) {
+			network.Spec.Network.Chaincodes = []v1alpha1.Chaincode{{Name: "simpler"}, network.Spec.Network.Chaincodes[0]}
+		}, []string{}, func(old *v1alpha1.FabricNetwork) {
+			old.Spec.Network.Chaincodes = append(old.Spec.Network.Chaincodes, v1alpha1.Chaincode{Name: "simpler"})
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			old := testNetwork()
+			if test.modifyOld != nil {
+				test.modifyOld(old)
+			}
+			network := testNetwork()
+			test.modify(network)
+			if fields := errorFields(ValidateTransition(old, network, anchorPeerCounts)); !equalFields(fields, test.errors) {
+				t.Errorf("errors are %v, expected %v", fields, test.errors)
+			}
+		})
+	}
+
+	// peerCount is not checked without configtx.yaml
+	old := testNetwork()
+	network := testNetwork()
+	network.Spec.Topology.PeerOrgs[0].PeerCount = 1
+	if allErrs := ValidateTransition(old, network, nil); len(allErrs) != 0 {
+		t.Errorf("unexpected errors %v", allErrs)
+	}
+}
+
+// channel profiles of configtx.yaml, anchor peers are YAML anchors as in PIVT samples
+const testConfigtx = `
+Organizations:
+- &Karga
+  Name: Karga
+  AnchorPeers:
+  - Host: peer1.aptalkarga.tr
+    Port: 7051
+- &Atlantis
+  Name: Atlantis
+  AnchorPeers:
+  - Host: hlf-peer--atlantis--peer2
+    Port: 7051
+- &Nevergreen
+  Name: Nevergreen
+  AnchorPeers:
+  - Host: peer0.nevergreen.nl
+    Port: 7051
+Profiles:
+  common:
+    Consortium: SampleConsortium
+    Application:
+      Organizations:
+      - *Karga
+      - *Atlantis
+  private-nevergreen:
+    Consortium: SampleConsortium
+    Application:
+      Organizations:
+      - *Nevergreen
+`
+
+func TestAnchorPeerCounts(t *testing.T) {
+	network := testNetwork()
+	counts, err := AnchorPeerCounts(network, []byte(testConfigtx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// private-nevergreen is not a channel of the FabricNetwork
+	expected := map[string]int32{"Karga": 2, "Atlantis": 3}
+	if !reflect.DeepEqual(counts, expected) {
+		t.Errorf("anchor peer counts are %v, expected %v", counts, expected)
+	}
+
+	if _, err := AnchorPeerCounts(network, []byte("Profiles: [")); err == nil {
+		t.Error("expected an error for invalid configtx.yaml")
+	}
+}
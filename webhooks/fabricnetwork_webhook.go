@@ -0,0 +1,231 @@
+// Package webhooks contains the admission webhooks of Fabric Operator
+package webhooks
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/go-logr/logr"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/raftAtGit/hl-fabric-operator/api/v1alpha1"
+	"github.com/raftAtGit/hl-fabric-operator/validation"
+)
+
+const (
+	// PIVT Helm charts defaults
+	defaultChaincodeVersion  = "1.0"
+	defaultChaincodeLanguage = "node"
+)
+
+// FabricNetworkWebhook defaults and validates FabricNetworks before they are persisted
+type FabricNetworkWebhook struct {
+	Client client.Client
+	Log    logr.Logger
+}
+
+// +kubebuilder:webhook:path=/mutate-hyperledger-org-v1alpha1-fabricnetwork,mutating=true,failurePolicy=fail,sideEffects=None,groups=hyperledger.org,resources=fabricnetworks,verbs=create,versions=v1alpha1,name=mfabricnetwork.kb.io,admissionReviewVersions=v1
+// +kubebuilder:webhook:path=/validate-hyperledger-org-v1alpha1-fabricnetwork,mutating=false,failurePolicy=fail,sideEffects=None,groups=hyperledger.org,resources=fabricnetworks,verbs=create;update,versions=v1alpha1,name=vfabricnetwork.kb.io,admissionReviewVersions=v1
+
+var _ admission.CustomDefaulter = &FabricNetworkWebhook{}
+var _ admission.CustomValidator = &FabricNetworkWebhook{}
+
+// SetupWebhookWithManager registers the webhooks with the Manager.
+func (w *FabricNetworkWebhook) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&v1alpha1.FabricNetwork{}).
+		WithDefaulter(w).
+		WithValidator(w).
+		Complete()
+}
+
+// Default fills the missing fields of a new FabricNetwork.
+// Defaults are only applied on creation, otherwise they would be detected as changes of a running network.
+func (w *FabricNetworkWebhook) Default(ctx context.Context, obj runtime.Object) error {
+	network, ok := obj.(*v1alpha1.FabricNetwork)
+	if !ok {
+		return fmt.Errorf("expected a FabricNetwork but got a %T", obj)
+	}
+
+	req, err := admission.RequestFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	if req.Operation != admissionv1.Create {
+		return nil
+	}
+	w.Log.Info("Defaulting FabricNetwork", "namespace", req.Namespace, "name", network.Name)
+
+	spec := &network.Spec
+
+	if spec.Configtx.Secret == "" && spec.Configtx.File == "" {
+		// prefer the derived name, fallback to legacy name if only that one exists
+		spec.Configtx.Secret = validation.ConfigtxSecretName(network.Name)
+		exists, err := w.secretExists(ctx, req.Namespace, spec.Configtx.Secret)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			legacyExists, err := w.secretExists(ctx, req.Namespace, validation.LegacyConfigtxSecret)
+			if err != nil {
+				return err
+			}
+			if legacyExists {
+				spec.Configtx.Secret = validation.LegacyConfigtxSecret
+			}
+		}
+	}
+
+	// only fill the secrets if they are created by CLI for this FabricNetwork,
+	// otherwise Fabric Operator creates them
+	if !spec.Genesis.IsProvided() {
+		exists, err := w.cliSecretExists(ctx, req.Namespace, validation.GenesisSecret, network.Name)
+		if err != nil {
+			return err
+		}
+		if exists {
+			spec.Genesis.Secret = validation.GenesisSecret
+		}
+	}
+	if !spec.CryptoConfig.IsProvided() {
+		for _, name := range []string{validation.CryptoConfigSecretName(network.Name), validation.LegacyCryptoConfigSecret} {
+			exists, err := w.cliSecretExists(ctx, req.Namespace, name, network.Name)
+			if err != nil {
+				return err
+			}
+			if exists {
+				spec.CryptoConfig.Secret = name
+				break
+			}
+		}
+	}
+
+	if len(spec.Network.Chaincodes) != 0 {
+		if spec.Chaincode.Version == "" {
+			spec.Chaincode.Version = defaultChaincodeVersion
+		}
+		if spec.Chaincode.Language == "" {
+			spec.Chaincode.Language = defaultChaincodeLanguage
+		}
+	}
+
+	return nil
+}
+
+// ValidateCreate validates a new FabricNetwork
+func (w *FabricNetworkWebhook) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	network, ok := obj.(*v1alpha1.FabricNetwork)
+	if !ok {
+		return nil, fmt.Errorf("expected a FabricNetwork but got a %T", obj)
+	}
+	w.Log.Info("Validating new FabricNetwork", "name", network.Name)
+
+	allErrs := validation.ValidateSpec(network)
+	allErrs = append(allErrs, validation.ValidateNoLocalReferences(network)...)
+
+	return nil, toInvalidError(network, allErrs)
+}
+
+// ValidateUpdate validates the updated FabricNetwork and the transition from the old one
+func (w *FabricNetworkWebhook) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	old, ok := oldObj.(*v1alpha1.FabricNetwork)
+	if !ok {
+		return nil, fmt.Errorf("expected a FabricNetwork but got a %T", oldObj)
+	}
+	network, ok := newObj.(*v1alpha1.FabricNetwork)
+	if !ok {
+		return nil, fmt.Errorf("expected a FabricNetwork but got a %T", newObj)
+	}
+
+	if !specChanged(old, network) {
+		// Fabric Operator itself updates the FabricNetwork to clear the forceState, dont block it
+		return nil, nil
+	}
+	w.Log.Info("Validating updated FabricNetwork", "name", network.Name)
+
+	allErrs := validation.ValidateSpec(network)
+	allErrs = append(allErrs, validation.ValidateNoLocalReferences(network)...)
+	anchorPeerCounts, err := w.anchorPeerCounts(ctx, old.Namespace, network)
+	if err != nil {
+		return nil, err
+	}
+	allErrs = append(allErrs, validation.ValidateTransition(old, network, anchorPeerCounts)...)
+
+	return nil, toInvalidError(network, allErrs)
+}
+
+// ValidateDelete allows all deletions
+func (w *FabricNetworkWebhook) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// returns the peerCount needed by the anchor peers of the channels, read from configtx.yaml Secret.
+// returns nil if the Secret does not exist or is not valid, those are reported by Fabric Operator
+func (w *FabricNetworkWebhook) anchorPeerCounts(ctx context.Context, namespace string, network *v1alpha1.FabricNetwork) (map[string]int32, error) {
+	if network.Spec.Configtx.Secret == "" {
+		return nil, nil
+	}
+	secret := &corev1.Secret{}
+	if err := w.Client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: network.Spec.Configtx.Secret}, secret); err != nil {
+		if apiErrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	counts, err := validation.AnchorPeerCounts(network, secret.Data["configtx.yaml"])
+	if err != nil {
+		w.Log.Info("Skipping anchor peer validation", "secret", secret.Name, "error", err.Error())
+		return nil, nil
+	}
+	return counts, nil
+}
+
+func (w *FabricNetworkWebhook) secretExists(ctx context.Context, namespace string, name string) (bool, error) {
+	secret := &corev1.Secret{}
+	err := w.Client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, secret)
+	if err != nil {
+		if apiErrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (w *FabricNetworkWebhook) cliSecretExists(ctx context.Context, namespace string, name string, network string) (bool, error) {
+	secret := &corev1.Secret{}
+	err := w.Client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, secret)
+	if err != nil {
+		if apiErrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return secret.Labels["raft.io/fabric-operator-cli-created-for"] == network, nil
+}
+
+// returns true if the spec changed other than the forceState
+func specChanged(old *v1alpha1.FabricNetwork, new *v1alpha1.FabricNetwork) bool {
+	oldSpec := old.Spec.DeepCopy()
+	newSpec := new.Spec.DeepCopy()
+	oldSpec.ForceState = ""
+	newSpec.ForceState = ""
+
+	return !reflect.DeepEqual(oldSpec, newSpec)
+}
+
+func toInvalidError(network *v1alpha1.FabricNetwork, allErrs field.ErrorList) error {
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apiErrors.NewInvalid(v1alpha1.GroupVersion.WithKind("FabricNetwork").GroupKind(), network.Name, allErrs)
+}
@@ -0,0 +1,299 @@
+package webhooks
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/raftAtGit/hl-fabric-operator/api/v1alpha1"
+	"github.com/raftAtGit/hl-fabric-operator/validation"
+)
+
+const testNamespace = "webhook-test"
+
+// configtx.yaml with anchor peer peer1 of Karga in common channel
+const testConfigtx = `
+Profiles:
+  common:
+    Application:
+      Organizations:
+      - Name: Karga
+        AnchorPeers:
+        - Host: peer1.aptalkarga.tr
+`
+
+func testWebhook(t *testing.T, objects ...client.Object) *FabricNetworkWebhook {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return &FabricNetworkWebhook{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build(),
+		Log:    ctrl.Log.WithName("test"),
+	}
+}
+
+func testNetwork() *v1alpha1.FabricNetwork {
+	return &v1alpha1.FabricNetwork{
+		ObjectMeta: metav1.ObjectMeta{Name: "simple", Namespace: testNamespace},
+		Spec: v1alpha1.FabricNetworkSpec{
+			Configtx: v1alpha1.Configtx{Secret: validation.ConfigtxSecretName("simple")},
+			Topology: v1alpha1.Topology{
+				Version:     "1.4.9",
+				OrdererOrgs: []v1alpha1.OrdererOrg{{Name: "Groeifabriek", Domain: "groeifabriek.nl", Hosts: []string{"orderer0"}}},
+				PeerOrgs:    []v1alpha1.PeerOrg{{Name: "Karga", Domain: "aptalkarga.tr", PeerCount: 2}},
+			},
+			Network: v1alpha1.Network{
+				Channels:   []v1alpha1.Channel{{Name: "common", Orgs: []string{"Karga"}}},
+				Chaincodes: []v1alpha1.Chaincode{{Name: "even-simpler", Orgs: []string{"Karga"}}},
+			},
+		},
+	}
+}
+
+func testSecret(name string, cliCreatedFor string, data map[string][]byte) *corev1.Secret {
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: name}, Data: data}
+	if cliCreatedFor != "" {
+		secret.Labels = map[string]string{"raft.io/fabric-operator-cli-created-for": cliCreatedFor}
+	}
+	return secret
+}
+
+func admissionContext(operation admissionv1.Operation) context.Context {
+	return admission.NewContextWithRequest(context.Background(), admission.Request{
+		AdmissionRequest: admissionv1.AdmissionRequest{Operation: operation, Namespace: testNamespace},
+	})
+}
+
+func TestDefault(t *testing.T) {
+	tests := []struct {
+		name      string
+		operation admissionv1.Operation
+		objects   []client.Object
+		modify    func(network *v1alpha1.FabricNetwork)
+		expected  func(network *v1alpha1.FabricNetwork)
+	}{
+		{
+			name:      "derived configtx secret and chaincode defaults",
+			operation: admissionv1.Create,
+			modify: func(network *v1alpha1.FabricNetwork) {
+				network.Spec.Configtx.Secret = ""
+			},
+			expected: func(network *v1alpha1.FabricNetwork) {
+				network.Spec.Chaincode = v1alpha1.ChaincodeConfig{Version: "1.0", Language: "node"}
+			},
+		},
+		{
+			name:      "legacy configtx secret",
+			operation: admissionv1.Create,
+			objects:   []client.Object{testSecret(validation.LegacyConfigtxSecret, "", nil)},
+			modify: func(network *v1alpha1.FabricNetwork) {
+				network.Spec.Configtx.Secret = ""
+				network.Spec.Network.Chaincodes = nil
+			},
+			expected: func(network *v1alpha1.FabricNetwork) {
+				network.Spec.Configtx.Secret = validation.LegacyConfigtxSecret
+				network.Spec.Network.Chaincodes = nil
+			},
+		},
+		{
+			name:      "secrets created by CLI for this network",
+			operation: admissionv1.Create,
+			objects: []client.Object{
+				testSecret(validation.GenesisSecret, "simple", nil),
+				testSecret(validation.CryptoConfigSecretName("simple"), "simple", nil),
+			},
+			modify: func(network *v1alpha1.FabricNetwork) {
+				network.Spec.Chaincode.Version = "2.0"
+			},
+			expected: func(network *v1alpha1.FabricNetwork) {
+				network.Spec.Genesis.Secret = validation.GenesisSecret
+				network.Spec.CryptoConfig.Secret = validation.CryptoConfigSecretName("simple")
+				network.Spec.Chaincode = v1alpha1.ChaincodeConfig{Version: "2.0", Language: "node"}
+			},
+		},
+		{
+			name:      "secrets created by CLI for another network",
+			operation: admissionv1.Create,
+			objects: []client.Object{
+				testSecret(validation.GenesisSecret, "other", nil),
+				testSecret(validation.LegacyCryptoConfigSecret, "other", nil),
+			},
+			modify: func(network *v1alpha1.FabricNetwork) {},
+			expected: func(network *v1alpha1.FabricNetwork) {
+				network.Spec.Chaincode = v1alpha1.ChaincodeConfig{Version: "1.0", Language: "node"}
+			},
+		},
+		{
+			name:      "update is not defaulted",
+			operation: admissionv1.Update,
+			modify: func(network *v1alpha1.FabricNetwork) {
+				network.Spec.Configtx.Secret = ""
+			},
+			expected: func(network *v1alpha1.FabricNetwork) {
+				network.Spec.Configtx.Secret = ""
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := testWebhook(t, test.objects...)
+			network := testNetwork()
+			test.modify(network)
+			expected := testNetwork()
+			test.expected(expected)
+
+			if err := w.Default(admissionContext(test.operation), network); err != nil {
+				t.Fatal(err)
+			}
+			if !equalSpecs(network, expected) {
+				t.Errorf("spec is %+v, expected %+v", network.Spec, expected.Spec)
+			}
+		})
+	}
+}
+
+func equalSpecs(a *v1alpha1.FabricNetwork, b *v1alpha1.FabricNetwork) bool {
+	return !specChanged(a, b)
+}
+
+// returns the fields of the errors in the Invalid error, nil if there is no error
+func invalidFields(t *testing.T, err error) []string {
+	if err == nil {
+		return nil
+	}
+	status, ok := err.(apiErrors.APIStatus)
+	if !ok || !apiErrors.IsInvalid(err) {
+		t.Fatalf("expected an Invalid error, got %v", err)
+	}
+	fields := []string{}
+	for _, cause := range status.Status().Details.Causes {
+		fields = append(fields, cause.Field)
+	}
+	return fields
+}
+
+func TestValidateCreate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(network *v1alpha1.FabricNetwork)
+		fields []string
+	}{
+		{"valid", func(network *v1alpha1.FabricNetwork) {}, nil},
+		{"invalid spec", func(network *v1alpha1.FabricNetwork) {
+			network.Spec.Topology.TLSEnabled = true
+			network.Spec.Topology.PeerOrgs[0].PeerCount = 0
+		}, []string{"spec.topology.tlsEnabled", "spec.topology.peerOrgs[0].peerCount"}},
+		{"local reference", func(network *v1alpha1.FabricNetwork) {
+			network.Spec.Chaincode.Folder = "chaincode"
+		}, []string{"spec.chaincode.folder"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			network := testNetwork()
+			network.Spec.Chaincode = v1alpha1.ChaincodeConfig{Version: "1.0", Language: "node"}
+			test.modify(network)
+
+			_, err := testWebhook(t).ValidateCreate(admissionContext(admissionv1.Create), network)
+			if fields := invalidFields(t, err); strings.Join(fields, ",") != strings.Join(test.fields, ",") {
+				t.Errorf("invalid fields are %v, expected %v", fields, test.fields)
+			}
+		})
+	}
+}
+
+func TestValidateUpdate(t *testing.T) {
+	configtx := testSecret(validation.ConfigtxSecretName("simple"), "", map[string][]byte{"configtx.yaml": []byte(testConfigtx)})
+	tests := []struct {
+		name    string
+		objects []client.Object
+		old     func(old *v1alpha1.FabricNetwork)
+		modify  func(network *v1alpha1.FabricNetwork)
+		fields  []string
+	}{
+		{
+			name: "only forceState changed",
+			// old FabricNetwork is invalid, Fabric Operator clearing forceState should not be blocked
+			old: func(old *v1alpha1.FabricNetwork) {
+				old.Spec.Topology.Version = ""
+				old.Spec.ForceState = v1alpha1.StateNew
+			},
+			modify: func(network *v1alpha1.FabricNetwork) {
+				network.Spec.Topology.Version = ""
+			},
+		},
+		{
+			name: "invalid spec",
+			modify: func(network *v1alpha1.FabricNetwork) {
+				network.Spec.Topology.Version = ""
+			},
+			fields: []string{"spec.topology.version"},
+		},
+		{
+			name: "remove orderer org and rename chaincode",
+			old: func(old *v1alpha1.FabricNetwork) {
+				old.Spec.Topology.OrdererOrgs = append(old.Spec.Topology.OrdererOrgs, v1alpha1.OrdererOrg{Name: "Nevergreen", Domain: "nevergreen.nl", Hosts: []string{"orderer0"}})
+			},
+			modify: func(network *v1alpha1.FabricNetwork) {
+				network.Spec.Topology.OrdererOrgs = network.Spec.Topology.OrdererOrgs[:1]
+				network.Spec.Network.Chaincodes[0].Name = "simpler"
+			},
+			fields: []string{"spec.topology.ordererOrgs", "spec.network.chaincodes[0].name"},
+		},
+		{
+			name:    "decrease peerCount below anchor peer",
+			objects: []client.Object{configtx},
+			modify: func(network *v1alpha1.FabricNetwork) {
+				network.Spec.Topology.PeerOrgs[0].PeerCount = 1
+			},
+			fields: []string{"spec.topology.peerOrgs[0].peerCount"},
+		},
+		{
+			name: "decrease peerCount without configtx secret",
+			modify: func(network *v1alpha1.FabricNetwork) {
+				network.Spec.Topology.PeerOrgs[0].PeerCount = 1
+			},
+		},
+		{
+			name:    "increase peerCount",
+			objects: []client.Object{configtx},
+			modify: func(network *v1alpha1.FabricNetwork) {
+				network.Spec.Topology.PeerOrgs[0].PeerCount = 3
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			old := testNetwork()
+			old.Spec.Chaincode = v1alpha1.ChaincodeConfig{Version: "1.0", Language: "node"}
+			if test.old != nil {
+				test.old(old)
+			}
+			network := old.DeepCopy()
+			network.Spec.ForceState = ""
+			test.modify(network)
+
+			_, err := testWebhook(t, test.objects...).ValidateUpdate(admissionContext(admissionv1.Update), old, network)
+			if fields := invalidFields(t, err); strings.Join(fields, ",") != strings.Join(test.fields, ",") {
+				t.Errorf("invalid fields are %v, expected %v", fields, test.fields)
+			}
+		})
+	}
+}
+
+func TestValidateDelete(t *testing.T) {
+	if _, err := testWebhook(t).ValidateDelete(admissionContext(admissionv1.Delete), testNetwork()); err != nil {
+		t.Errorf("delete is not allowed: %v", err)
+	}
+}